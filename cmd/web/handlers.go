@@ -3,9 +3,15 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/AguilaMike/snippetbox/internal/diff"
+	"github.com/AguilaMike/snippetbox/internal/highlight"
 	"github.com/AguilaMike/snippetbox/internal/models"
 	"github.com/AguilaMike/snippetbox/internal/validator"
 )
@@ -17,28 +23,1588 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = app.countComments(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Fetch the most used tags for the tag cloud on the home page.
+	cloud, err := app.tags.Cloud(30)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	// Call the newTemplateData() helper to get a templateData struct containing
 	// the 'default' data (which for now is just the current year), and add the
 	// snippets slice to it.
 	data := app.newTemplateData(r)
-	data.Snippets = snippets
+	data.Snippets = snippets
+	data.TagCloud = newTagCloud(cloud)
+
+	// Use the new render helper.
+	app.render(w, r, http.StatusOK, "home.gohtml", data)
+}
+
+// Define a snippetBrowseForm struct to hold the query string parameters for
+// the browse page.
+type snippetBrowseForm struct {
+	Sort   string
+	Cursor string
+}
+
+func (app *application) snippetBrowse(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	form := snippetBrowseForm{
+		Sort:   qs.Get("sort"),
+		Cursor: qs.Get("cursor"),
+	}
+
+	// Fall back to the default sort order if none (or an unknown one) was
+	// requested.
+	if !validator.PermittedValue(form.Sort, models.SnippetSorts...) {
+		form.Sort = models.SortNewest
+	}
+
+	page, err := app.snippets.Browse(models.SnippetQuery{
+		Sort:   form.Sort,
+		Cursor: form.Cursor,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.countComments(page.Snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Snippets = page.Snippets
+	data.Pagination = newPagination(r.URL, "cursor", page.Prev, page.Next)
+	app.render(w, r, http.StatusOK, "browse.gohtml", data)
+}
+
+// Define a trendingForm struct to hold the period which the trending
+// snippets are ranked over.
+type trendingForm struct {
+	Period string
+}
+
+// trendingLimit is the number of snippets on the trending page.
+const trendingLimit = 20
+
+func (app *application) snippetTrending(w http.ResponseWriter, r *http.Request) {
+	form := trendingForm{
+		Period: r.URL.Query().Get("period"),
+	}
+
+	// Fall back to the last day if no period (or an unknown one) was
+	// requested.
+	if !validator.PermittedValue(form.Period, models.TrendingPeriods...) {
+		form.Period = models.TrendingDay
+	}
+
+	snippets, err := app.snippets.Trending(form.Period, trendingLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.countComments(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Snippets = snippets
+	app.render(w, r, http.StatusOK, "trending.gohtml", data)
+}
+
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	tag := r.PathValue("tag")
+	if !validator.Matches(tag, validator.TagRX) {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The tag pages always list the newest snippets first, reusing the
+	// cursor pagination from the browse page.
+	page, err := app.snippets.Browse(models.SnippetQuery{
+		Sort:   models.SortNewest,
+		Cursor: r.URL.Query().Get("cursor"),
+		Tag:    tag,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.countComments(page.Snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Data = tag
+	data.Snippets = page.Snippets
+	data.Pagination = newPagination(r.URL, "cursor", page.Prev, page.Next)
+	app.render(w, r, http.StatusOK, "tag.gohtml", data)
+}
+
+func (app *application) tagSuggest(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("prefix")))
+
+	// Always respond with a JSON array, even when there's nothing to
+	// suggest, so that the JavaScript doesn't need to special case null.
+	suggestions := []string{}
+
+	if prefix != "" {
+		tags, err := app.tags.Suggest(prefix, 10)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		suggestions = append(suggestions, tags...)
+	}
+
+	app.writeJSON(w, http.StatusOK, suggestions)
+}
+
+// Define a searchForm struct to hold the search query and the words and
+// phrases from it which should be highlighted in the results.
+type searchForm struct {
+	Q     string
+	Terms []string
+}
+
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	page, err := app.readInt(qs, "page", 1)
+	if err != nil || page < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := searchForm{Q: qs.Get("q")}
+	terms := models.ParseSearch(form.Q)
+	form.Terms = terms.Highlights()
+
+	results, err := app.searchIndex.Query(models.SearchQuery{
+		Terms: terms,
+		Page:  page,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.countComments(results.Snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Work out the page numbers for the previous and next links, if there
+	// are pages in those directions.
+	var prev, next string
+	if results.Page > 1 {
+		prev = strconv.Itoa(results.Page - 1)
+	}
+	if results.HasNext {
+		next = strconv.Itoa(results.Page + 1)
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Snippets = results.Snippets
+	data.Pagination = newPagination(r.URL, "page", prev, next)
+	app.render(w, r, http.StatusOK, "search.gohtml", data)
+}
+
+// Add a snippetView handler function.
+func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+	// Use the readSnippet helper to retrieve the data for a specific record
+	// based on its ID. If no matching record is found, or it's a private
+	// snippet belonging to somebody else, a 404 Not Found response is sent.
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// Password-protected snippets show a form for entering the password
+	// instead, until it's been entered.
+	if !app.unlocked(r, snippet) {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = snippetUnlockForm{}
+		app.render(w, r, http.StatusOK, "unlock.gohtml", data)
+		return
+	}
+
+	app.showSnippet(w, r, snippet)
+}
+
+// The snippetViewPost handler shows a view of a "burn after reading" snippet,
+// once the reader has confirmed it on the warning page. Using a POST request
+// means that link previews, prefetching and HEAD requests can't use the
+// views up.
+func (app *application) snippetViewPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.unlocked(r, snippet) {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+		return
+	}
+
+	app.showSnippet(w, r, snippet)
+}
+
+// The showSnippet helper renders the page for a snippet. If the snippet's
+// views are limited, the view is counted first, unless it's the author who's
+// looking. The views are only given out to POST requests; for anything else a
+// warning page is shown which asks the reader to confirm the view.
+func (app *application) showSnippet(w http.ResponseWriter, r *http.Request, snippet models.Snippet) {
+	// The page data is loaded before the view is counted, because the tags,
+	// files and comments are deleted along with the snippet after the last
+	// view.
+	data, err := app.snippetPageData(r, snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if snippet.ViewsLeft > 0 && !app.isAuthor(r, snippet) {
+		if r.Method != http.MethodPost {
+			app.render(w, r, http.StatusOK, "burn.gohtml", data)
+			return
+		}
+
+		viewed, err := app.snippets.View(snippet.ID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				// Somebody else had the last view first.
+				http.NotFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		// View() returns the snippet as it was before this view.
+		viewed.Tags = data.Snippet.Tags
+		viewed.Files = data.Snippet.Files
+		viewed.ViewsLeft--
+		if viewed.ViewsLeft == 0 {
+			data.Flash = "This was the last view, and the snippet has now been deleted."
+		}
+		data.Snippet = viewed
+	}
+
+	// The count on the page includes the views which haven't been saved to
+	// the database yet, so that readers see their own view counted. HEAD
+	// requests aren't counted, because nobody reads the response.
+	if r.Method != http.MethodHead {
+		app.countView(r, data.Snippet)
+	}
+	data.Snippet.ViewCount += app.viewCounter.unflushed(snippet.ID)
+
+	// Use the new render helper.
+	app.render(w, r, http.StatusOK, "view.gohtml", data)
+}
+
+// The snippetPageData helper returns the template data for a snippet's page,
+// with everything shown alongside the snippet loaded in: its tags and files,
+// its forks and the snippet it was forked from, and its comments.
+func (app *application) snippetPageData(r *http.Request, snippet models.Snippet) (templateData, error) {
+	var err error
+
+	snippet.Tags, err = app.tags.ForSnippet(snippet.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	snippet.Files, err = app.files.ForSnippet(snippet.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	// And do the same thing again here...
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	data.Forks, err = app.snippets.Forks(snippet.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	data.ForkSource, err = app.forkSource(r, snippet)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	if snippet.Commentable() {
+		data.Comments, err = app.comments.ForSnippet(snippet.ID)
+		if err != nil {
+			return templateData{}, err
+		}
+
+		err = app.anchorComments(snippet, data.Comments)
+		if err != nil {
+			return templateData{}, err
+		}
+		data.CommentsOpen = true
+	}
+
+	// The user's collections are listed in the form for adding the snippet
+	// to one of them.
+	if data.IsAuthenticated {
+		data.Starred, err = app.stars.Exists(data.AuthenticatedUserID, snippet.ID)
+		if err != nil {
+			return templateData{}, err
+		}
+
+		data.Collections, err = app.collections.ByUser(data.AuthenticatedUserID)
+		if err != nil {
+			return templateData{}, err
+		}
+	}
+
+	// The view page always has the form for a new comment, so there has to
+	// be a form for it to use. Any lines picked on it are lines of the
+	// version being shown.
+	data.Form = commentForm{Version: snippet.Version}
+
+	return data, nil
+}
+
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.requireReadable(w, r, snippet) {
+		return
+	}
+
+	// Fetch the earlier versions of the snippet. The current version isn't
+	// stored as a revision, so the template lists it separately.
+	revisions, err := app.revisions.All(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	app.render(w, r, http.StatusOK, "history.gohtml", data)
+}
+
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.requireReadable(w, r, snippet) {
+		return
+	}
+
+	// By default compare the current version with the one before it. Either
+	// end of the comparison can be overridden with the "from" and "to" query
+	// string parameters.
+	qs := r.URL.Query()
+
+	from, err := app.readInt(qs, "from", max(1, snippet.Version-1))
+	if err != nil || from < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	to, err := app.readInt(qs, "to", snippet.Version)
+	if err != nil || to < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	fromRevision, err := app.snippetVersion(snippet, from)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	toRevision, err := app.snippetVersion(snippet, to)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Diff = revisionDiff{
+		From:  fromRevision,
+		To:    toRevision,
+		Hunks: diff.Hunks(fromRevision.Content, toRevision.Content, 3),
+	}
+	app.render(w, r, http.StatusOK, "diff.gohtml", data)
+}
+
+// Add a snippetCreate handler function.
+func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	// Set the 'default' data for the template.
+	data := app.newTemplateData(r)
+
+	// Initialize a new createSnippetForm instance and pass it to the template.
+	// Notice how this is also a great opportunity to set any default or
+	// 'initial' values for the form --- here we set the initial value for the
+	// snippet expiry to one year, and show the content as code by default.
+	data.Form = snippetCreateForm{
+		Format:       models.FormatCode,
+		Visibility:   models.VisibilityPublic,
+		Expires:      expiresAfter,
+		ExpiresAfter: 1,
+		ExpiresUnit:  "years",
+	}
+
+	// Use the new render helper.
+	// Pass in the name of the template (create.page.tmpl), and the
+	// templateData struct containing the default data.
+	app.render(w, r, http.StatusOK, "create.gohtml", data)
+}
+
+// Define a snippetCreateForm struct to represent the form data and validation
+// errors for the form fields. Note that all the struct fields are deliberately
+// exported (i.e. start with a capital letter). This is because struct fields
+// must be exported in order to be read by the html/template package when
+// rendering the template.
+// Remove the explicit FieldErrors struct field and instead embed the Validator
+// struct. Embedding this means that our snippetCreateForm "inherits" all the
+// fields and methods of our Validator struct (including the FieldErrors field).
+// Update our snippetCreateForm struct to include struct tags which tell the
+// decoder how to map HTML form values into the different struct fields. So, for
+// example, here we're telling the decoder to store the value from the HTML form
+// input with the name "title" in the Title field. The struct tag `form:"-"`
+// tells the decoder to completely ignore a field during decoding.
+// The same form is also used when editing a snippet, in which case the
+// Version field carries the version of the snippet that the user started
+// editing.
+type snippetCreateForm struct {
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	Format              string            `form:"format"`
+	Language            string            `form:"language"`
+	Visibility          string            `form:"visibility"`
+	Expires             string            `form:"expires"`
+	ExpiresAfter        int               `form:"expires_after"`
+	ExpiresUnit         string            `form:"expires_unit"`
+	ExpiresAt           string            `form:"expires_at"`
+	ViewLimit           int               `form:"view_limit"`
+	Version             int               `form:"version"`
+	Tags                string            `form:"tags"`
+	Files               []snippetFileForm `form:"files"`
+	Password            string            `form:"password"`
+	RemovePassword      bool              `form:"remove_password"`
+	validator.Validator `form:"-"`
+
+	// expiry holds the expiry time worked out by validate(), or nil if the
+	// snippet never expires. Unexported fields are ignored by the decoder.
+	expiry *time.Time
+	// currentExpiry holds the expiry time of the snippet being edited, if it
+	// has one, so that it can be kept as it is.
+	currentExpiry *time.Time
+}
+
+// The ways of choosing when a snippet expires, which are the values of the
+// Expires field: after a duration, at a date and time, or never.
+const (
+	expiresAfter = "after"
+	expiresAt    = "at"
+	expiresNever = "never"
+)
+
+// The format of the ExpiresAt field, which is the format used by the
+// datetime-local input. Times are in UTC.
+const expiresAtLayout = "2006-01-02T15:04"
+
+// The shortest and longest times that a snippet can be kept for, unless it
+// never expires.
+const (
+	minExpiry = 10 * time.Minute
+	maxExpiry = 5 * 365 * 24 * time.Hour
+)
+
+// An expiryUnit is one of the units which the ExpiresUnit field can hold.
+type expiryUnit struct {
+	Name   string
+	Length time.Duration
+}
+
+// expiryUnits lists the units in the order they're shown in the form. A year
+// is taken to be 365 days, the same as in maxExpiry.
+var expiryUnits = []expiryUnit{
+	{Name: "minutes", Length: time.Minute},
+	{Name: "hours", Length: time.Hour},
+	{Name: "days", Length: 24 * time.Hour},
+	{Name: "weeks", Length: 7 * 24 * time.Hour},
+	{Name: "years", Length: 365 * 24 * time.Hour},
+}
+
+// Define a snippetFileForm struct to hold one of the extra files in a
+// multi-file snippet. In the HTML form the fields are named like
+// "files[0].name", which the decoder maps onto the Files slice.
+type snippetFileForm struct {
+	Name    string `form:"name"`
+	Content string `form:"content"`
+}
+
+// The maximum number of extra files in a snippet.
+const maxSnippetFiles = 10
+
+// The maximum number of views a "burn after reading" snippet can be given.
+const maxViewLimit = 100
+
+// compactFiles removes the file entries which were left completely blank,
+// which is how the form leaves out or removes a file.
+func (form *snippetCreateForm) compactFiles() {
+	form.Files = slices.DeleteFunc(form.Files, func(f snippetFileForm) bool {
+		return strings.TrimSpace(f.Name) == "" && strings.TrimSpace(f.Content) == ""
+	})
+	for i := range form.Files {
+		form.Files[i].Name = strings.TrimSpace(form.Files[i].Name)
+	}
+}
+
+// FileEntries returns the file entries to show in the form: the current files
+// followed by a blank entry for adding a new one.
+func (form snippetCreateForm) FileEntries() []snippetFileForm {
+	return append(slices.Clone(form.Files), snippetFileForm{})
+}
+
+// fileList returns the files in the form as models.SnippetFile values.
+func (form *snippetCreateForm) fileList() []models.SnippetFile {
+	files := make([]models.SnippetFile, len(form.Files))
+	for i, f := range form.Files {
+		files[i] = models.SnippetFile{Name: f.Name, Content: f.Content}
+	}
+	return files
+}
+
+// tagList returns the normalized tags from the comma-separated Tags field.
+func (form *snippetCreateForm) tagList() []string {
+	return validator.NormalizeList(form.Tags)
+}
+
+// Because the Validator struct is embedded by the snippetCreateForm struct,
+// we can call CheckField() directly on it to execute our validation checks.
+// CheckField() will add the provided key and error message to the
+// FieldErrors map if the check does not evaluate to true. For example, in
+// the first line here we "check that the form.Title field is not blank". In
+// the second, we "check that the form.Title field has a maximum character
+// length of 100" and so on.
+func (form *snippetCreateForm) validate(now time.Time) {
+	// Drop any blank file entries first, so that the indexes in the error
+	// keys for the files match the entries which are shown again.
+	form.compactFiles()
+
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.PermittedValue(form.Format, models.SnippetFormats...), "format", "This field must equal plain, code or markdown")
+	// An empty language means that it should be detected automatically.
+	form.CheckField(form.Language == "" || validator.PermittedValue(form.Language, highlight.Names()...), "language", "This field must be a supported language")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.SnippetVisibilities...), "visibility", "This field must equal public, unlisted or private")
+	form.validateExpiry(now)
+	form.validateViewLimit()
+	// The access password is optional, but it shouldn't be too easy to guess.
+	form.CheckField(form.Password == "" || validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+
+	tags := form.tagList()
+	form.CheckField(validator.MaxItems(tags, 5), "tags", "This field cannot have more than 5 tags")
+	form.CheckField(validator.AllMatch(tags, validator.TagRX), "tags", "Tags can only contain letters, numbers and the characters + # . _ -")
+	form.CheckField(validator.AllMaxChars(tags, 30), "tags", "Tags cannot be more than 30 characters long")
+
+	// Each file gets a single error message, stored under a key like
+	// "files.0". File names are compared case-insensitively, because they
+	// can't be told apart on some filesystems once they're downloaded.
+	form.CheckField(validator.MaxItems(form.Files, maxSnippetFiles), "files", fmt.Sprintf("A snippet cannot have more than %d files", maxSnippetFiles))
+
+	seen := make(map[string]bool)
+	for i, f := range form.Files {
+		key := fmt.Sprintf("files.%d", i)
+		form.CheckField(validator.NotBlank(f.Name), key, "The file name cannot be blank")
+		form.CheckField(validator.MaxChars(f.Name, 100), key, "The file name cannot be more than 100 characters long")
+		form.CheckField(validator.Matches(f.Name, validator.FilenameRX), key, "The file name can only contain letters, numbers and the characters . _ - and cannot start with a dot")
+		form.CheckField(!seen[strings.ToLower(f.Name)], key, "The file name is already used by another file")
+		form.CheckField(validator.NotBlank(f.Content), key, "The file content cannot be blank")
+		seen[strings.ToLower(f.Name)] = true
+	}
+}
+
+// validateViewLimit checks the number of views a "burn after reading"
+// snippet is given. A view limit of 0 means that the snippet can be viewed
+// any number of times until it expires.
+func (form *snippetCreateForm) validateViewLimit() {
+	form.CheckField(form.ViewLimit >= 0 && form.ViewLimit <= maxViewLimit, "view_limit", fmt.Sprintf("This field must be between 1 and %d, or blank for no limit", maxViewLimit))
+}
+
+// The size limits for the ciphertext of an encrypted snippet, once it's been
+// decoded from base64. The smallest is the 12-byte nonce and the 16-byte
+// authentication tag around a single byte of content. The largest still fits
+// in the content column once it's been encoded.
+const (
+	minCiphertextSize = 12 + 1 + 16
+	maxCiphertextSize = 48000
+)
+
+// validateEncrypted runs the validation checks for an encrypted snippet. Only
+// the title, content, expiry and view limit fields are used, and the content
+// is the ciphertext made by the browser. The server can't check what's inside
+// it, but it can check that it's well-formed and not too large.
+func (form *snippetCreateForm) validateEncrypted(now time.Time) {
+	// The title isn't encrypted, so it's optional.
+	form.Title = strings.TrimSpace(form.Title)
+	if form.Title == "" {
+		form.Title = "Encrypted snippet"
+	}
+
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.Base64Size(form.Content, minCiphertextSize, maxCiphertextSize), "content", "The encrypted content is invalid or too long")
+	form.validateExpiry(now)
+	form.validateViewLimit()
+}
+
+// validateExpiry checks the fields which choose when the snippet expires, and
+// works out the expiry time from them. The now parameter is the current time.
+func (form *snippetCreateForm) validateExpiry(now time.Time) {
+	const message = "This field must be between 10 minutes and 5 years from now"
+
+	switch form.Expires {
+	case expiresAfter:
+		i := slices.IndexFunc(expiryUnits, func(u expiryUnit) bool { return u.Name == form.ExpiresUnit })
+		if i == -1 {
+			form.AddFieldError("expires", "This field must equal minutes, hours, days, weeks or years")
+			return
+		}
+		unit := expiryUnits[i].Length
+
+		// Check the number before multiplying, so that a huge one can't
+		// overflow into a duration which passes the check.
+		ok := form.ExpiresAfter > 0 && form.ExpiresAfter <= int(maxExpiry/unit)
+		d := time.Duration(form.ExpiresAfter) * unit
+		form.CheckField(ok && validator.DurationBetween(d, minExpiry, maxExpiry), "expires", message)
+
+		expiry := now.Add(d)
+		form.expiry = &expiry
+	case expiresAt:
+		expiry, err := time.Parse(expiresAtLayout, form.ExpiresAt)
+		if err != nil {
+			form.AddFieldError("expires", "This field must be a date and time")
+			return
+		}
+
+		// The edit form is filled in with the snippet's current expiry time,
+		// which is always allowed to stay as it is. Otherwise a snippet which
+		// is about to expire couldn't be saved without changing its expiry.
+		// The stored time is kept, rather than the one from the form, which
+		// has been rounded down to the minute.
+		if form.currentExpiry != nil && form.ExpiresAt == form.currentExpiry.UTC().Format(expiresAtLayout) {
+			form.expiry = form.currentExpiry
+			return
+		}
+
+		form.CheckField(validator.TimeBetween(expiry, now.Add(minExpiry), now.Add(maxExpiry)), "expires", message)
+		form.expiry = &expiry
+	case expiresNever:
+		form.expiry = nil
+	default:
+		form.AddFieldError("expires", "This field must equal after, at or never")
+	}
+}
+
+// Add a snippetCreatePost handler function.
+func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
+	// Declare a new empty instance of the snippetCreateForm struct.
+	var form snippetCreateForm
+
+	// Call the Decode() method of the form decoder, passing in the current
+	// request and *a pointer* to our snippetCreateForm struct. This will
+	// essentially fill our struct with the relevant values from the HTML form.
+	// If there is a problem, we return a 400 Bad Request response to the client.
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Run the validation checks for the form fields.
+	form.validate(time.Now())
+
+	// Use the Valid() method to see if any of the checks failed. If they did,
+	// then re-render the template passing in the form in the same way as
+	// before.
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "create.gohtml", data)
+		return
+	}
+
+	// Retrieve the ID of the current user from the session so that the new
+	// snippet is recorded as belonging to them.
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// We also need to update this line to pass the data from the
+	// snippetCreateForm instance to our Insert() method. The whole snippet is
+	// saved in one go, including its tags, files, password and view limit, so
+	// that it can't be read before they're set, and if any part of it fails
+	// nothing is created.
+	snippet := models.SnippetEdit{
+		Title:      form.Title,
+		Content:    form.Content,
+		Format:     form.Format,
+		Language:   form.Language,
+		Visibility: form.Visibility,
+		Expires:    form.expiry,
+		Tags:       form.tagList(),
+		Files:      form.fileList(),
+		Password:   form.Password,
+		ViewLimit:  form.ViewLimit,
+	}
+
+	id, slug, err := app.snippets.Insert(snippet, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Add the new snippet to the search index.
+	app.indexSnippet(r, id)
+
+	// Use the Put() method to add a string value ("Snippet successfully
+	// created!") and the corresponding key ("flash") to the session data.
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", slug), http.StatusSeeOther)
+}
+
+func (app *application) snippetCreateEncrypted(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	// Secrets usually don't need to be kept for long, so encrypted snippets
+	// expire after a week by default.
+	data.Form = snippetCreateForm{
+		Expires:      expiresAfter,
+		ExpiresAfter: 1,
+		ExpiresUnit:  "weeks",
+	}
+
+	app.render(w, r, http.StatusOK, "encrypted.gohtml", data)
+}
+
+func (app *application) snippetCreateEncryptedPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validateEncrypted(time.Now())
+
+	// The ciphertext is sent back in the form, and the script decrypts it
+	// again using the key which is still in the URL.
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "encrypted.gohtml", data)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// Encrypted snippets are always unlisted, because nobody could read them
+	// without following a link which includes the key. They're never added
+	// to the search index.
+	snippet := models.SnippetEdit{
+		Title:      form.Title,
+		Content:    form.Content,
+		Format:     models.FormatEncrypted,
+		Visibility: models.VisibilityUnlisted,
+		Expires:    form.expiry,
+		ViewLimit:  form.ViewLimit,
+	}
+
+	_, slug, err := app.snippets.Insert(snippet, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created! Share the whole link, including the key after the #, with anyone who should read it.")
+
+	// The form was posted to a URL with the key after the #. Browsers keep
+	// that part when they follow a redirect to a URL which doesn't have one,
+	// so the snippet's page opens with the key in place.
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", slug), http.StatusSeeOther)
+}
+
+// The snippetForkPost handler makes a copy of a snippet which belongs to the
+// current user, and sends them to its edit page to make their changes. Only
+// snippets which the user can already read are forked: private snippets are
+// a 404 Not Found for everybody but their author, and requireReadable sends
+// them to the snippet's page if it still needs its password entering, if its
+// views are limited, or if it's encrypted. Forks of password-protected
+// snippets are private, because the password isn't copied.
+func (app *application) snippetForkPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.requireReadable(w, r, snippet) {
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// Forks expire after a year, which is the same default as the create
+	// form. The user can change it on the edit page straight afterwards.
+	expires := time.Now().Add(365 * 24 * time.Hour)
+
+	id, slug, err := app.snippets.Fork(snippet.ID, userID, &expires)
+	if err != nil {
+		// The snippet was deleted, or it expired, after it was read.
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.indexSnippet(r, id)
+
+	flash := "Snippet successfully forked! Make any changes you need below."
+	if snippet.Protected {
+		flash = "Snippet successfully forked! It's private because the original has a password. Make any changes you need below."
+	}
+	app.sessionManager.Put(r.Context(), "flash", flash)
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/edit/%s", slug), http.StatusSeeOther)
+}
+
+// Define a commentForm struct to hold the form data for posting or editing a
+// comment. ParentID is the ID of the comment being replied to, or 0 for a
+// new top-level comment. A top-level comment can also be about a range of
+// lines, from LineStart to LineEnd, in the version of the snippet given by
+// Version.
+type commentForm struct {
+	Body                string `form:"body"`
+	ParentID            int    `form:"parent_id"`
+	LineStart           int    `form:"line_start"`
+	LineEnd             int    `form:"line_end"`
+	Version             int    `form:"version"`
+	validator.Validator `form:"-"`
+}
+
+// maxCommentLength is the most characters a comment can have.
+const maxCommentLength = 5000
+
+// commentEditWindow is how long after posting a comment its author can still
+// edit or delete it. After that the conversation may have moved on, and
+// changing the comment could make the replies to it misleading.
+const commentEditWindow = 15 * time.Minute
+
+func (form *commentForm) validate() {
+	form.CheckField(validator.NotBlank(form.Body), "body", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Body, maxCommentLength), "body", fmt.Sprintf("This field cannot be more than %d characters long", maxCommentLength))
+}
+
+// validateLines checks the range of lines that a new comment is about. A
+// single line only needs LineStart. The line numbers have to be for the
+// current version of the snippet, because after an edit they could point at
+// different code.
+func (form *commentForm) validateLines(snippet models.Snippet) {
+	if form.LineEnd == 0 {
+		form.LineEnd = form.LineStart
+	}
+
+	if form.Version != snippet.Version {
+		form.AddNonFieldError("This snippet has been changed since you loaded it. Please check that the lines are still the right ones.")
+		form.Version = snippet.Version
+		return
+	}
+
+	lines := lineCount(snippet.Content)
+	form.CheckField(snippet.Format != models.FormatMarkdown, "lines", "Markdown snippets can't have comments on lines")
+	form.CheckField(form.LineStart >= 1 && form.LineStart <= form.LineEnd && form.LineEnd <= lines, "lines", fmt.Sprintf("This field must be a range of lines between 1 and %d", lines))
+}
+
+// The snippetCommentPost handler adds a comment, or a reply to a comment, to
+// a snippet. Like forking, commenting needs the snippet to be readable by the
+// current user.
+func (app *application) snippetCommentPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.requireReadable(w, r, snippet) {
+		return
+	}
+
+	if !snippet.Commentable() {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	var form commentForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	// Only top-level comments can be about particular lines; replies are
+	// about the comment they reply to.
+	onLines := form.ParentID == 0 && (form.LineStart != 0 || form.LineEnd != 0)
+	if onLines {
+		form.validateLines(snippet)
+	}
+
+	if form.Valid() {
+		userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+		var id int
+		if onLines {
+			id, err = app.comments.InsertOnLines(snippet.ID, userID, form.LineStart, form.LineEnd, form.Version, form.Body)
+		} else {
+			id, err = app.comments.Insert(snippet.ID, userID, form.ParentID, form.Body)
+		}
+		if err == nil {
+			app.sessionManager.Put(r.Context(), "flash", "Comment successfully posted!")
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comment-%d", snippet.Slug, id), http.StatusSeeOther)
+			return
+		}
+
+		// The comment being replied to has been deleted (or was never a
+		// top-level comment on this snippet).
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		form.AddNonFieldError("The comment you replied to no longer exists")
+		form.ParentID = 0
+	}
+
+	data, err := app.snippetPageData(r, snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.Form = form
+	app.render(w, r, http.StatusUnprocessableEntity, "view.gohtml", data)
+}
+
+// The snippetStarPost handler stars a snippet for the current user. Stars are
+// only bookmarks, so unlike forking or commenting, the user doesn't need to
+// be able to read the snippet's content, just to see that it exists.
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.stars.Insert(app.authenticatedUserID(r), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The search index keeps a copy of the snippet, including its star
+	// count.
+	app.indexSnippet(r, snippet.ID)
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+}
+
+func (app *application) snippetUnstarPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.stars.Delete(app.authenticatedUserID(r), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.indexSnippet(r, snippet.ID)
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+}
+
+func (app *application) commentEdit(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.ownedComment(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Data = comment
+	data.Form = commentForm{Body: comment.Body}
+	app.render(w, r, http.StatusOK, "comment.gohtml", data)
+}
+
+func (app *application) commentEditPost(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.ownedComment(w, r)
+	if !ok {
+		return
+	}
+
+	var form commentForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Data = comment
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "comment.gohtml", data)
+		return
+	}
+
+	// Saving an unchanged comment would mark it as edited for no reason.
+	if form.Body != comment.Body {
+		err = app.comments.Update(comment.ID, form.Body)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				http.NotFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment successfully updated!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comment-%d", snippet.Slug, comment.ID), http.StatusSeeOther)
+}
+
+func (app *application) commentDeletePost(w http.ResponseWriter, r *http.Request) {
+	comment, snippet, ok := app.ownedComment(w, r)
+	if !ok {
+		return
+	}
+
+	// Any replies to the comment are deleted along with it.
+	err := app.comments.Delete(comment.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment successfully deleted!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comments", snippet.Slug), http.StatusSeeOther)
+}
+
+// Define a collectionForm struct to hold the form data for creating or
+// editing a collection.
+type collectionForm struct {
+	Title               string `form:"title"`
+	Description         string `form:"description"`
+	Visibility          string `form:"visibility"`
+	validator.Validator `form:"-"`
+}
+
+// maxCollectionDescriptionLength is the most characters a collection's
+// description can have.
+const maxCollectionDescriptionLength = 2000
+
+func (form *collectionForm) validate() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.MaxChars(form.Description, maxCollectionDescriptionLength), "description", fmt.Sprintf("This field cannot be more than %d characters long", maxCollectionDescriptionLength))
+	form.CheckField(validator.PermittedValue(form.Visibility, models.SnippetVisibilities...), "visibility", "This field must equal public, unlisted or private")
+}
+
+func (app *application) collectionList(w http.ResponseWriter, r *http.Request) {
+	collections, err := app.collections.Latest()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collections = collections
+	app.render(w, r, http.StatusOK, "collections.gohtml", data)
+}
+
+func (app *application) collectionView(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readCollection(w, r)
+	if !ok {
+		return
+	}
+
+	// Only the snippets which the viewer could see anyway are shown, so a
+	// shared collection never gives away its owner's private snippets.
+	snippets, err := app.snippets.InCollection(collection.ID, app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.countComments(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.Snippets = snippets
+	app.render(w, r, http.StatusOK, "collection.gohtml", data)
+}
+
+func (app *application) collectionCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = collectionForm{Visibility: models.VisibilityPublic}
+	app.render(w, r, http.StatusOK, "collectionform.gohtml", data)
+}
+
+func (app *application) collectionCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "collectionform.gohtml", data)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	_, slug, err := app.collections.Insert(form.Title, form.Description, form.Visibility, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully created! Add snippets to it from their pages.")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%s", slug), http.StatusSeeOther)
+}
+
+func (app *application) collectionEdit(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.Form = collectionForm{
+		Title:       collection.Title,
+		Description: collection.Description,
+		Visibility:  collection.Visibility,
+	}
+	app.render(w, r, http.StatusOK, "collectionform.gohtml", data)
+}
+
+func (app *application) collectionEditPost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Collection = collection
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "collectionform.gohtml", data)
+		return
+	}
+
+	err = app.collections.Update(collection.ID, form.Title, form.Description, form.Visibility)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%s", collection.Slug), http.StatusSeeOther)
+}
+
+func (app *application) collectionDeletePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	// Unlike snippets, collections don't go to the trash. Deleting one
+	// doesn't delete the snippets in it, so nothing is lost that can't be
+	// put back together.
+	err := app.collections.Delete(collection.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection deleted.")
+
+	http.Redirect(w, r, "/account/collections", http.StatusSeeOther)
+}
+
+// Define a collectionOrderForm struct to hold the new order of the snippets
+// in a collection, which is posted by main.js as a snippet_id value for each
+// snippet, in order.
+type collectionOrderForm struct {
+	SnippetIDs []int `form:"snippet_id"`
+}
+
+// The collectionOrderPost handler saves a new order for the snippets in a
+// collection after they've been dragged around on its page. The page has
+// already been rearranged by the script, so there's nothing to send back.
+func (app *application) collectionOrderPost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionOrderForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.collections.Reorder(collection.ID, form.SnippetIDs)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Define a collectionSnippetForm struct to hold the snippet being removed
+// from a collection, or the collection a snippet is being added to.
+type collectionSnippetForm struct {
+	SnippetID    int `form:"snippet_id"`
+	CollectionID int `form:"collection_id"`
+}
+
+func (app *application) collectionRemovePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.collections.RemoveSnippet(collection.ID, form.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet removed from the collection.")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%s", collection.Slug), http.StatusSeeOther)
+}
+
+// The snippetCollectPost handler adds a snippet to one of the current user's
+// collections. As with stars, the user only needs to be able to see the
+// snippet, and the collection's viewers still need to be able to read it
+// for themselves.
+func (app *application) snippetCollectPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	collection, err := app.collections.Get(form.CollectionID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if collection.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.collections.AddSnippet(collection.ID, snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet added to %s!", collection.Title))
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	// Fetch the snippet, making sure that it belongs to the current user.
+	snippet, ok := app.editableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	tags, err := app.tags.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	files, err := app.files.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
 
-	// Use the new render helper.
-	app.render(w, r, http.StatusOK, "home.gohtml", data)
+	// Pre-populate the form with the current snippet data, including the
+	// version that the user is about to edit.
+	form := snippetCreateForm{
+		Title:        snippet.Title,
+		Content:      snippet.Content,
+		Format:       snippet.Format,
+		Language:     snippet.Language,
+		Visibility:   snippet.Visibility,
+		Expires:      expiresAt,
+		ExpiresAfter: 1,
+		ExpiresUnit:  "years",
+		ExpiresAt:    snippet.Expires.UTC().Format(expiresAtLayout),
+		ViewLimit:    snippet.ViewsLeft,
+		Version:      snippet.Version,
+		Tags:         strings.Join(tags, ", "),
+	}
+	// Keep the current expiry time unless the author chooses another one.
+	if snippet.NeverExpires() {
+		form.Expires = expiresNever
+		form.ExpiresAt = ""
+	}
+	for _, f := range files {
+		form.Files = append(form.Files, snippetFileForm{Name: f.Name, Content: f.Content})
+	}
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "edit.gohtml", data)
 }
 
-// Add a snippetView handler function.
-func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.editableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Reuse the same validation checks as when creating a snippet.
+	if !snippet.NeverExpires() {
+		form.currentExpiry = &snippet.Expires
+	}
+	form.validate(time.Now())
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.gohtml", data)
+		return
+	}
+
+	// The whole edit is saved in one go, so that if any part of it fails
+	// nothing is changed and the form can simply be submitted again.
+	edit := models.SnippetEdit{
+		Title:      form.Title,
+		Content:    form.Content,
+		Format:     form.Format,
+		Language:   form.Language,
+		Visibility: form.Visibility,
+		Expires:    form.expiry,
+		Tags:       form.tagList(),
+		Files:      form.fileList(),
+		// The password field is left blank to keep the current password, so
+		// it's only changed when a new one is entered or it's being removed.
+		Password:       form.Password,
+		RemovePassword: form.RemovePassword,
+		// The form is filled in with the views the snippet has left, so the
+		// count only starts again if the author changes it.
+		ViewLimit:       form.ViewLimit,
+		ChangeViewLimit: form.ViewLimit != snippet.ViewsLeft,
+	}
+
+	// Try to update the snippet using the version number from the form. If
+	// someone else has saved the snippet in the meantime, re-display the form
+	// with a 409 Conflict status rather than overwriting their changes.
+	err = app.snippets.Update(snippet.ID, edit, form.Version)
+	if err != nil {
+		if errors.Is(err, models.ErrEditConflict) {
+			form.AddNonFieldError("This snippet has been changed by someone else since you started editing it. Please reload the page and try again.")
+
+			data := app.newTemplateData(r)
+			data.Snippet = snippet
+			data.Form = form
+			app.render(w, r, http.StatusConflict, "edit.gohtml", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.indexSnippet(r, snippet.ID)
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+}
+
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// Move the snippet to the trash. It can be restored from the trash page
+	// until it's purged.
+	err := app.snippets.Delete(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.unindexSnippet(r, snippet.ID)
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet moved to the trash.")
+
+	http.Redirect(w, r, "/account/trash", http.StatusSeeOther)
+}
+
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil || id < 1 {
 		http.NotFound(w, r)
 		return
 	}
 
-	// Use the SnippetModel's Get() method to retrieve the data for a
-	// specific record based on its ID. If no matching record is found,
-	// return a 404 Not Found response.
-	snippet, err := app.snippets.Get(id)
+	// Trashed snippets can't be fetched with Get(), so the ownership check
+	// is done by the Restore() method itself.
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.snippets.Restore(id, userID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			http.NotFound(w, r)
@@ -48,107 +1614,148 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// And do the same thing again here...
-	data := app.newTemplateData(r)
-	data.Snippet = snippet
+	app.indexSnippet(r, id)
 
-	// Use the new render helper.
-	app.render(w, r, http.StatusOK, "view.gohtml", data)
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully restored!")
+
+	// Fetch the restored snippet to find its slug. If it expired while it
+	// was in the trash it can't be viewed, so we show the user's snippets
+	// instead, where it's marked as expired.
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/account/snippets", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
 }
 
-// Add a snippetCreate handler function.
-func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	// Set the 'default' data for the template.
-	data := app.newTemplateData(r)
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
 
-	// Initialize a new createSnippetForm instance and pass it to the template.
-	// Notice how this is also a great opportunity to set any default or
-	// 'initial' values for the form --- here we set the initial value for the
-	// snippet expiry to 365 days.
-	data.Form = snippetCreateForm{
-		Expires: 365,
+	if !app.requireReadable(w, r, snippet) {
+		return
 	}
 
-	// Use the new render helper.
-	// Pass in the name of the template (create.page.tmpl), and the
-	// templateData struct containing the default data.
-	app.render(w, r, http.StatusOK, "create.gohtml", data)
+	app.serveSnippetContent(w, r, snippet)
 }
 
-// Define a snippetCreateForm struct to represent the form data and validation
-// errors for the form fields. Note that all the struct fields are deliberately
-// exported (i.e. start with a capital letter). This is because struct fields
-// must be exported in order to be read by the html/template package when
-// rendering the template.
-// Remove the explicit FieldErrors struct field and instead embed the Validator
-// struct. Embedding this means that our snippetCreateForm "inherits" all the
-// fields and methods of our Validator struct (including the FieldErrors field).
-// Update our snippetCreateForm struct to include struct tags which tell the
-// decoder how to map HTML form values into the different struct fields. So, for
-// example, here we're telling the decoder to store the value from the HTML form
-// input with the name "title" in the Title field. The struct tag `form:"-"`
-// tells the decoder to completely ignore a field during decoding.
-type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	// A path like /snippet/download/1.zip asks for all of the snippet's
+	// files bundled together in a zip archive. Wildcards in routing patterns
+	// have to match a whole path segment, so the suffix is checked here.
+	slug, zipped := strings.CutSuffix(r.PathValue("slug"), ".zip")
+
+	snippet, ok := app.fetchSnippet(w, r, slug)
+	if !ok {
+		return
+	}
+
+	if !app.requireReadable(w, r, snippet) {
+		return
+	}
+
+	if zipped {
+		files, err := app.files.ForSnippet(snippet.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.serveSnippetZip(w, r, snippet, files)
+		return
+	}
+
+	// The Content-Disposition header tells the browser to save the content
+	// as a file rather than display it. FormatMediaType() takes care of
+	// quoting the filename.
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": snippetFilename(snippet)})
+	w.Header().Set("Content-Disposition", disposition)
+
+	app.serveSnippetContent(w, r, snippet)
+}
+
+// Define a snippetUnlockForm struct to hold the password entered to unlock a
+// password-protected snippet.
+type snippetUnlockForm struct {
+	Password            string `form:"password"`
 	validator.Validator `form:"-"`
 }
 
-// Add a snippetCreatePost handler function.
-func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
-	// Declare a new empty instance of the snippetCreateForm struct.
-	var form snippetCreateForm
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// There's nothing to do if the snippet is already unlocked.
+	if app.unlocked(r, snippet) {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+		return
+	}
+
+	var form snippetUnlockForm
 
-	// Call the Decode() method of the form decoder, passing in the current
-	// request and *a pointer* to our snippetCreateForm struct. This will
-	// essentially fill our struct with the relevant values from the HTML form.
-	// If there is a problem, we return a 400 Bad Request response to the client.
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Because the Validator struct is embedded by the snippetCreateForm struct,
-	// we can call CheckField() directly on it to execute our validation checks.
-	// CheckField() will add the provided key and error message to the
-	// FieldErrors map if the check does not evaluate to true. For example, in
-	// the first line here we "check that the form.Title field is not blank". In
-	// the second, we "check that the form.Title field has a maximum character
-	// length of 100" and so on.
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	// Check the rate limits before the password, so that once they've been
+	// reached nothing can be learned from trying another password. The
+	// attempt is counted now, and only given back if it doesn't fail.
+	res, ok, wait := app.unlockLimiter.reserve(snippet.ID, clientIP(r))
+	if !ok {
+		minutes := int(wait.Round(time.Minute).Minutes())
+		form.AddNonFieldError(fmt.Sprintf("Too many incorrect passwords. Please try again in %d minutes.", max(minutes, 1)))
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "unlock.gohtml", data)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
 
-	// Use the Valid() method to see if any of the checks failed. If they did,
-	// then re-render the template passing in the form in the same way as
-	// before.
 	if !form.Valid() {
-		data := app.newTemplateData(r)
+		app.unlockLimiter.refund(res)
+
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "create.gohtml", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "unlock.gohtml", data)
 		return
 	}
 
-	// We also need to update this line to pass the data from the
-	// snippetCreateForm instance to our Insert() method.
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	err = app.snippets.Unlock(snippet.ID, form.Password)
 	if err != nil {
-		app.serverError(w, r, err)
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddNonFieldError("The password is incorrect")
+			data.Form = form
+			app.render(w, r, http.StatusUnprocessableEntity, "unlock.gohtml", data)
+		} else {
+			app.unlockLimiter.refund(res)
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	// Use the Put() method to add a string value ("Snippet successfully
-	// created!") and the corresponding key ("flash") to the session data.
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	app.unlockLimiter.refund(res)
 
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
-}
+	// Remember the unlock in the session. It only applies to this snippet,
+	// and lasts for as long as the session does.
+	app.sessionManager.Put(r.Context(), unlockKey(snippet.ID), true)
 
-func (app *application) downloadHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "./ui/static/file.zip")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
 }
 
 // Create a new userSignupForm struct.
@@ -357,6 +1964,79 @@ func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, http.StatusOK, "account.gohtml", data)
 }
 
+func (app *application) accountSnippets(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// Fetch every snippet owned by the current user, including the ones which
+	// have already expired. The template marks those so they stand out.
+	snippets, err := app.snippets.ByUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.countComments(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	app.render(w, r, http.StatusOK, "mysnippets.gohtml", data)
+}
+
+func (app *application) accountStarred(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	snippets, err := app.snippets.Starred(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.countComments(snippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	app.render(w, r, http.StatusOK, "starred.gohtml", data)
+}
+
+func (app *application) accountCollections(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	collections, err := app.collections.ByUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collections = collections
+	app.render(w, r, http.StatusOK, "mycollections.gohtml", data)
+}
+
+func (app *application) accountTrash(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	snippets, err := app.snippets.Trashed(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	// Pass the retention period so the template can tell the user how long
+	// they have to restore a snippet.
+	data.Data = app.trashRetention
+	app.render(w, r, http.StatusOK, "trash.gohtml", data)
+}
+
 // Create a new userLoginForm struct.
 type accountPasswordUpdateForm struct {
 	CurrentPassword         string `form:"currentPassword"`
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"archive/zip"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/AguilaMike/snippetbox/internal/assert"
+	"github.com/AguilaMike/snippetbox/internal/models"
+	"github.com/AguilaMike/snippetbox/internal/models/mocks"
 )
 
 func TestPing(t *testing.T) {
@@ -44,11 +52,23 @@ func TestSnippetView(t *testing.T) {
 		wantBody string
 	}{
 		{
-			name:     "Valid ID",
-			urlPath:  "/snippet/view/1",
+			name:     "Valid slug",
+			urlPath:  "/snippet/view/pondXy7q2R",
 			wantCode: http.StatusOK,
 			wantBody: "An old silent pond...",
 		},
+		{
+			name:     "Detected language",
+			urlPath:  "/snippet/view/pondXy7q2R",
+			wantCode: http.StatusOK,
+			wantBody: "<span class='language'>Plain text</span>",
+		},
+		{
+			name:     "Extra file",
+			urlPath:  "/snippet/view/pondXy7q2R",
+			wantCode: http.StatusOK,
+			wantBody: "<strong>splash.sh</strong>",
+		},
 		{
 			name:     "Non-existent ID",
 			urlPath:  "/snippet/view/2",
@@ -65,12 +85,12 @@ func TestSnippetView(t *testing.T) {
 			wantCode: http.StatusNotFound,
 		},
 		{
-			name:     "String ID",
+			name:     "Unknown slug",
 			urlPath:  "/snippet/view/foo",
 			wantCode: http.StatusNotFound,
 		},
 		{
-			name:     "Empty ID",
+			name:     "Empty slug",
 			urlPath:  "/snippet/view/",
 			wantCode: http.StatusNotFound,
 		},
@@ -89,203 +109,2795 @@ func TestSnippetView(t *testing.T) {
 	}
 }
 
-func TestSnippetCreate(t *testing.T) {
-	// Create a new instance of our application struct which uses the mocked
-	// dependencies.
+func TestSnippetViewCount(t *testing.T) {
+	t.Run("Counted once per viewer", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		_, header, body := ts.get(t, "/snippet/view/pondXy7q2R")
+		assert.StringContains(t, body, "<span class='view-count'>43 views</span>")
+
+		// Counting the view doesn't start a session.
+		for _, cookie := range header.Values("Set-Cookie") {
+			assert.Equal(t, strings.HasPrefix(cookie, "session="), false)
+		}
+
+		// Reloading the page doesn't count again.
+		_, _, body = ts.get(t, "/snippet/view/pondXy7q2R")
+		assert.StringContains(t, body, "<span class='view-count'>43 views</span>")
+		assert.Equal(t, app.viewCounter.unflushed(1), 1)
+	})
+
+	t.Run("Separate viewers", func(t *testing.T) {
+		app := newTestApplication(t)
+
+		// Anonymous viewers without a session are told apart by their IP
+		// address, so both test clients count as the same viewer, but a
+		// logged in user has a session of their own.
+		for _, user := range []string{"", "", "bob@example.com"} {
+			ts := newTestServer(t, app.routes())
+			if user != "" {
+				ts.loginAs(t, user)
+			}
+			ts.get(t, "/snippet/view/pondXy7q2R")
+			ts.Close()
+		}
+
+		assert.Equal(t, app.viewCounter.unflushed(1), 2)
+	})
+
+	t.Run("Author", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "alice@example.com")
+
+		_, _, body := ts.get(t, "/snippet/view/pondXy7q2R")
+		assert.StringContains(t, body, "<span class='view-count'>42 views</span>")
+		assert.Equal(t, app.viewCounter.unflushed(1), 0)
+	})
+
+	t.Run("HEAD request", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		res, err := ts.Client().Head(ts.URL + "/snippet/view/pondXy7q2R")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+		assert.Equal(t, app.viewCounter.unflushed(1), 0)
+	})
+
+	t.Run("Locked snippet", func(t *testing.T) {
+		app := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		// The view isn't counted until the password has been entered.
+		ts.get(t, "/snippet/view/l0ckedN0te")
+		assert.Equal(t, app.viewCounter.unflushed(7), 0)
+	})
+}
+
+func TestLegacySnippetURLs(t *testing.T) {
 	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
 
-	type ActionValidate struct {
-		Method, Actual, Expectedstr string
-		ExpectedInt                 int
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Public snippet",
+			urlPath:      "/snippet/view/1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/snippet/view/pondXy7q2R",
+		},
+		{
+			name:         "Sub-page with query string",
+			urlPath:      "/snippet/view/1/diff?from=1",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/snippet/view/pondXy7q2R/diff?from=1",
+		},
+		{
+			name:         "Zip archive",
+			urlPath:      "/snippet/download/1.zip",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/snippet/download/pondXy7q2R.zip",
+		},
+		{
+			name:     "Unlisted snippet",
+			urlPath:  "/snippet/view/5",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Private snippet",
+			urlPath:  "/snippet/raw/6",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/snippet/view/2",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, _ := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
 	}
+}
+
+func TestSnippetVisibility(t *testing.T) {
+	app := newTestApplication(t)
 
 	tests := []struct {
-		name, action string
-		invokeLogin  bool
-		validations  []ActionValidate
+		name     string
+		user     string
+		urlPath  string
+		wantCode int
+		wantBody string
 	}{
 		{
-			name:        "Authenticated",
-			action:      "/snippet/create",
-			invokeLogin: true,
-			validations: []ActionValidate{
-				{Method: "Equal", Actual: "code", ExpectedInt: http.StatusOK},
-				{Method: "StringContains", Actual: "body", Expectedstr: "<form action='/snippet/create' method='POST'>"},
-			},
+			name:     "Unlisted for anonymous user",
+			urlPath:  "/snippet/view/cand1eLigh",
+			wantCode: http.StatusOK,
+			wantBody: "<span class='badge'>unlisted</span>",
 		},
 		{
-			name:   "Unauthenticated",
-			action: "/snippet/create",
-			validations: []ActionValidate{
-				{Method: "Equal", Actual: "code", ExpectedInt: http.StatusSeeOther},
-				{Method: "Equal", Actual: "location", Expectedstr: "/user/login"},
-			},
+			name:     "Private for anonymous user",
+			urlPath:  "/snippet/view/summ3rRivr",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Private for another user",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/view/summ3rRivr",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Private for author",
+			user:     "alice@example.com",
+			urlPath:  "/snippet/view/summ3rRivr",
+			wantCode: http.StatusOK,
+			wantBody: "A summer river being crossed...",
+		},
+		{
+			name:     "Private raw content for anonymous user",
+			urlPath:  "/snippet/raw/summ3rRivr",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Private history for another user",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/view/summ3rRivr/history",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Private edit for another user",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/edit/summ3rRivr",
+			wantCode: http.StatusNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Establish a new test server for running end-to-end tests.
+			// Use a new server for each test so that logins don't carry over.
 			ts := newTestServer(t, app.routes())
 			defer ts.Close()
 
-			if tt.invokeLogin {
-				// Make a GET /user/login request and extract the CSRF token from the response
-				_, _, body := ts.get(t, "/user/login")
-				csrfToken := extractCSRFToken(t, body)
-
-				// Make a POST /user/login request using the extracted CSRF token and
-				// credentials from our the mock user model.
-				form := url.Values{}
-				form.Add("email", "alice@example.com")
-				form.Add("password", "pa$$word")
-				form.Add("csrf_token", csrfToken)
-				ts.postForm(t, "/user/login", form)
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
 			}
 
-			code, headers, body := ts.get(t, tt.action)
+			code, _, body := ts.get(t, tt.urlPath)
 
-			for _, v := range tt.validations {
-				switch v.Method {
-				case "Equal":
-					switch v.Actual {
-					case "code":
-						assert.Equal(t, code, v.ExpectedInt)
-					case "location":
-						assert.Equal(t, headers.Get("Location"), v.Expectedstr)
-					default:
-						t.Fatalf("Unknown validation method: %s", v.Actual)
-					}
-				case "StringContains":
-					assert.StringContains(t, body, v.Expectedstr)
-				}
-			}
+			assert.Equal(t, code, tt.wantCode)
 
-			ts.Close()
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
 		})
 	}
 }
 
-func TestUserSignup(t *testing.T) {
-	// Create the application struct containing our mocked dependencies and set
-	// up the test server for running an end-to-end test.
+func TestSnippetUnlock(t *testing.T) {
 	app := newTestApplication(t)
+
+	t.Run("Author", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.login(t)
+
+		code, _, body := ts.get(t, "/snippet/view/l0ckedN0te")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "The staging password is in the vault.")
+	})
+
 	ts := newTestServer(t, app.routes())
 	defer ts.Close()
 
-	// Make a GET /user/signup request and then extract the CSRF token from the
-	// response body.
-	_, _, body := ts.get(t, "/user/signup")
-	validCSRFToken := extractCSRFToken(t, body)
+	code, _, body := ts.get(t, "/snippet/view/l0ckedN0te")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/snippet/unlock/l0ckedN0te' method='POST' novalidate>")
+	assert.Equal(t, strings.Contains(body, "The staging password is in the vault."), false)
+	csrfToken := extractCSRFToken(t, body)
 
-	// Log the CSRF token value in our test output using the t.Logf() function.
-	// The t.Logf() function works in the same way as fmt.Printf(), but writes
-	// the provided message to the test output.
-	// t.Logf("CSRF token is: %q", validCSRFToken )
+	t.Run("Locked raw content", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/snippet/raw/l0ckedN0te")
 
-	const (
-		validName     = "Bob"
-		validPassword = "validPassw0rd"
-		validEmail    = "bob@example.com"
-		formTag       = "<form action='/user/signup' method='POST' novalidate>"
-	)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/l0ckedN0te")
+	})
 
 	tests := []struct {
-		name         string
-		userName     string
-		userEmail    string
-		userPassword string
-		csrfToken    string
-		wantCode     int
-		wantFormTag  string
+		name     string
+		password string
+		wantCode int
+		wantBody string
 	}{
 		{
-			name:         "Valid submission",
-			userName:     validName,
-			userEmail:    validEmail,
-			userPassword: validPassword,
-			csrfToken:    validCSRFToken,
-			wantCode:     http.StatusSeeOther,
-		},
-		{
-			name:         "Invalid CSRF Token",
-			userName:     validName,
-			userEmail:    validEmail,
-			userPassword: validPassword,
-			csrfToken:    "wrongToken",
-			wantCode:     http.StatusBadRequest,
-		},
-		{
-			name:         "Empty name",
-			userName:     "",
-			userEmail:    validEmail,
-			userPassword: validPassword,
-			csrfToken:    validCSRFToken,
-			wantCode:     http.StatusUnprocessableEntity,
-			wantFormTag:  formTag,
-		},
-		{
-			name:         "Empty email",
-			userName:     validName,
-			userEmail:    "",
-			userPassword: validPassword,
-			csrfToken:    validCSRFToken,
-			wantCode:     http.StatusUnprocessableEntity,
-			wantFormTag:  formTag,
-		},
-		{
-			name:         "Empty password",
-			userName:     validName,
-			userEmail:    validEmail,
-			userPassword: "",
-			csrfToken:    validCSRFToken,
-			wantCode:     http.StatusUnprocessableEntity,
-			wantFormTag:  formTag,
-		},
-		{
-			name:         "Invalid email",
-			userName:     validName,
-			userEmail:    "bob@example.",
-			userPassword: validPassword,
-			csrfToken:    validCSRFToken,
-			wantCode:     http.StatusUnprocessableEntity,
-			wantFormTag:  formTag,
+			name:     "Empty password",
+			password: "",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
 		},
 		{
-			name:         "Short password",
-			userName:     validName,
-			userEmail:    validEmail,
-			userPassword: "pa$$",
-			csrfToken:    validCSRFToken,
-			wantCode:     http.StatusUnprocessableEntity,
-			wantFormTag:  formTag,
+			name:     "Wrong password",
+			password: "let me in",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The password is incorrect",
 		},
 		{
-			name:         "Duplicate email",
-			userName:     validName,
-			userEmail:    "dupe@example.com",
-			userPassword: validPassword,
-			csrfToken:    validCSRFToken,
-			wantCode:     http.StatusUnprocessableEntity,
-			wantFormTag:  formTag,
+			name:     "Correct password",
+			password: "open sesame",
+			wantCode: http.StatusSeeOther,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			form := url.Values{}
-			form.Add("name", tt.userName)
-			form.Add("email", tt.userEmail)
-			form.Add("password", tt.userPassword)
-			form.Add("csrf_token", tt.csrfToken)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", csrfToken)
 
-			code, _, body := ts.postForm(t, "/user/signup", form)
+			code, _, body := ts.postForm(t, "/snippet/unlock/l0ckedN0te", form)
 
 			assert.Equal(t, code, tt.wantCode)
 
-			if tt.wantFormTag != "" {
-				assert.StringContains(t, body, tt.wantFormTag)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
 			}
 		})
 	}
+
+	t.Run("Unlocked", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/view/l0ckedN0te")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "The staging password is in the vault.")
+
+		code, _, body = ts.get(t, "/snippet/raw/l0ckedN0te")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "The staging password is in the vault.")
+	})
+
+	t.Run("Too many attempts", func(t *testing.T) {
+		// Use a new application with a lower limit for each IP address, and a
+		// new session so that the snippet is locked again.
+		app := newTestApplication(t)
+		app.unlockLimiter = newUnlockLimiter(20, 3, 15*time.Minute)
+
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		_, _, body := ts.get(t, "/snippet/view/l0ckedN0te")
+		csrfToken := extractCSRFToken(t, body)
+
+		form := url.Values{}
+		form.Add("password", "let me in")
+		form.Add("csrf_token", csrfToken)
+
+		for range 3 {
+			code, _, _ := ts.postForm(t, "/snippet/unlock/l0ckedN0te", form)
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+
+		// Once the limit for the IP address has been reached, even the
+		// correct password is refused.
+		form.Set("password", "open sesame")
+		code, headers, body := ts.postForm(t, "/snippet/unlock/l0ckedN0te", form)
+
+		assert.Equal(t, code, http.StatusTooManyRequests)
+		assert.Equal(t, headers.Get("Retry-After") != "", true)
+		assert.StringContains(t, body, "Too many incorrect passwords")
+	})
+}
+
+// slowUnlock wraps the mock snippet model so that Unlock() takes a while, like
+// a bcrypt comparison does, and counts how many times it's called.
+type slowUnlock struct {
+	mocks.SnippetModel
+	calls atomic.Int32
+}
+
+func (m *slowUnlock) Unlock(id int, password string) error {
+	m.calls.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return m.SnippetModel.Unlock(id, password)
+}
+
+func TestSnippetUnlockConcurrent(t *testing.T) {
+	app := newTestApplication(t)
+	snippets := &slowUnlock{}
+	app.snippets = snippets
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/snippet/view/l0ckedN0te")
+
+	form := url.Values{}
+	form.Add("password", "let me in")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	// Fire more wrong passwords at once than the limit of 10 for each IP
+	// address. None of them has been checked by the time the others arrive,
+	// but they must still all be counted.
+	const attempts = 25
+
+	var wg sync.WaitGroup
+	codes := make(chan int, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rs, err := ts.Client().PostForm(ts.URL+"/snippet/unlock/l0ckedN0te", form)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			rs.Body.Close()
+			codes <- rs.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	refused := 0
+	for code := range codes {
+		if code == http.StatusTooManyRequests {
+			refused++
+		}
+	}
+
+	assert.Equal(t, int(snippets.calls.Load()), 10)
+	assert.Equal(t, refused, attempts-10)
+}
+
+func TestSnippetViewLimit(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		user     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Limited view",
+			urlPath:  "/snippet/view/thr3eV1ews",
+			wantCode: http.StatusOK,
+			wantBody: "<form action='/snippet/view/thr3eV1ews' method='POST'>",
+		},
+		{
+			name:     "Raw content for anonymous user",
+			urlPath:  "/snippet/raw/thr3eV1ews",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Raw content for author",
+			user:     "alice@example.com",
+			urlPath:  "/snippet/raw/thr3eV1ews",
+			wantCode: http.StatusOK,
+			wantBody: "Notes for the next three readers.",
+		},
+		{
+			name:     "Last view",
+			urlPath:  "/snippet/view/bUrn4ft3rR",
+			wantCode: http.StatusOK,
+			wantBody: "<form action='/snippet/view/bUrn4ft3rR' method='POST'>",
+		},
+		{
+			name:     "Last view for author",
+			user:     "alice@example.com",
+			urlPath:  "/snippet/view/bUrn4ft3rR",
+			wantCode: http.StatusOK,
+			wantBody: "<span class='badge'>1 view left</span>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Confirmed view", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		_, _, body := ts.get(t, "/snippet/view/thr3eV1ews")
+		assert.Equal(t, strings.Contains(body, "Notes for the next three readers."), false)
+		assert.StringContains(t, body, "<span class='badge'>3 views left</span>")
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		code, _, body := ts.postForm(t, "/snippet/view/thr3eV1ews", form)
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Notes for the next three readers.")
+		assert.StringContains(t, body, "<span class='badge'>2 views left</span>")
+	})
+
+	t.Run("Confirmed last view", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		_, _, body := ts.get(t, "/snippet/view/bUrn4ft3rR")
+		assert.Equal(t, strings.Contains(body, "https://example.com/reset/8f14e45f"), false)
+
+		form := url.Values{}
+		form.Add("csrf_token", extractCSRFToken(t, body))
+
+		code, _, body := ts.postForm(t, "/snippet/view/bUrn4ft3rR", form)
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "https://example.com/reset/8f14e45f")
+		assert.StringContains(t, body, "This was the last view, and the snippet has now been deleted.")
+	})
+}
+
+func TestSnippetCreateEncrypted(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/snippet/create/encrypted")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/snippet/create/encrypted' method='POST' data-encrypt>")
+	csrfToken := extractCSRFToken(t, body)
+
+	// A 12-byte nonce, a single byte of content and a 16-byte tag.
+	const validContent = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwd"
+
+	tests := []struct {
+		name     string
+		title    string
+		content  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid submission",
+			title:    "Database password",
+			content:  validContent,
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Blank title",
+			content:  validContent,
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Blank content",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Not base64",
+			content:  "this isn't ciphertext!",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The encrypted content is invalid or too long",
+		},
+		{
+			name:     "Too short",
+			content:  "AAECAwQFBgcICQoL",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The encrypted content is invalid or too long",
+		},
+		{
+			name:     "Title too long",
+			title:    strings.Repeat("a", 101),
+			content:  validContent,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be more than 100 characters long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", tt.content)
+			form.Add("expires", "after")
+			form.Add("expires_after", "1")
+			form.Add("expires_unit", "weeks")
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, body := ts.postForm(t, "/snippet/create/encrypted", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusSeeOther {
+				assert.Equal(t, headers.Get("Location"), "/snippet/view/newSn1ppet")
+			}
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Blank title defaults", func(t *testing.T) {
+		form := snippetCreateForm{Content: validContent, Expires: expiresNever}
+		form.validateEncrypted(time.Now())
+
+		assert.Equal(t, form.Valid(), true)
+		assert.Equal(t, form.Title, "Encrypted snippet")
+	})
+}
+
+func TestSnippetEncrypted(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("View", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, _, body := ts.get(t, "/snippet/view/s3cr3tN0te")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<pre data-ciphertext='AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwd'>")
+		assert.StringContains(t, body, "<script src='/static/js/encrypted.js'")
+		assert.Equal(t, strings.Contains(body, "/snippet/raw/s3cr3tN0te"), false)
+	})
+
+	t.Run("Raw content", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, headers, _ := ts.get(t, "/snippet/raw/s3cr3tN0te")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/s3cr3tN0te")
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.login(t)
+
+		code, headers, _ := ts.get(t, "/snippet/edit/s3cr3tN0te")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/view/s3cr3tN0te")
+
+		_, _, body := ts.get(t, "/snippet/view/s3cr3tN0te")
+		assert.StringContains(t, body, "Encrypted snippets can&#39;t be edited.")
+	})
+}
+
+func TestSnippetFork(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		user         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Unauthenticated",
+			urlPath:      "/snippet/fork/pondXy7q2R",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Another user's snippet",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/fork/pondXy7q2R",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/edit/n3wF0rkSn1",
+		},
+		{
+			name:     "Another user's private snippet",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/fork/summ3rRivr",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Own private snippet",
+			user:         "alice@example.com",
+			urlPath:      "/snippet/fork/summ3rRivr",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/edit/n3wF0rkSn1",
+		},
+		{
+			name:         "Locked snippet",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/fork/l0ckedN0te",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/l0ckedN0te",
+		},
+		{
+			name:         "View-limited snippet",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/fork/thr3eV1ews",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/thr3eV1ews",
+		},
+		{
+			name:         "Encrypted snippet",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/fork/s3cr3tN0te",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/s3cr3tN0te",
+		},
+		{
+			name:     "Old integer ID",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/fork/1",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			_, _, body := ts.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	t.Run("Unlocked snippet", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "bob@example.com")
+
+		_, _, body := ts.get(t, "/snippet/view/l0ckedN0te")
+
+		form := url.Values{}
+		form.Add("password", "open sesame")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		ts.postForm(t, "/snippet/unlock/l0ckedN0te", form)
+
+		code, headers, _ := ts.postForm(t, "/snippet/fork/l0ckedN0te", form)
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/snippet/edit/n3wF0rkSn1")
+	})
+}
+
+func TestSnippetForkLinks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The original lists its forks.
+	_, _, body := ts.get(t, "/snippet/view/pondXy7q2R")
+	assert.StringContains(t, body, "<h2 class='forks'>Forks</h2>")
+	assert.StringContains(t, body, "<a href='/snippet/view/f0rk0fOne1'>An old silent pond</a>")
+
+	// And the fork links back to the original, which is public.
+	_, _, body = ts.get(t, "/snippet/view/f0rk0fOne1")
+	assert.StringContains(t, body, "forked from <a href='/snippet/view/pondXy7q2R'>#1</a>")
+	assert.Equal(t, strings.Contains(body, "<h2 class='forks'>"), false)
+
+	// Anonymous users aren't offered a fork button.
+	assert.Equal(t, strings.Contains(body, "/snippet/fork/"), false)
+
+	ts.login(t)
+	_, _, body = ts.get(t, "/snippet/view/f0rk0fOne1")
+	assert.StringContains(t, body, "<form action='/snippet/fork/f0rk0fOne1' method='POST'>")
+}
+
+func TestSnippetComments(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name        string
+		user        string
+		urlPath     string
+		wantBody    []string
+		notWantBody []string
+	}{
+		{
+			name:    "Anonymous user",
+			urlPath: "/snippet/view/pondXy7q2R",
+			wantBody: []string{
+				"<div class='comment' id='comment-1'>",
+				"<div class='comment reply' id='comment-2'>",
+				"<p>Should this use <code>bufio</code>?</p>",
+				"<a href='/user/login'>Log in</a> to comment.",
+				"<span class='line' id='L1'><a class='line-number' href='#L1'>1</a>An old silent pond...</span>",
+				"on <a class='lines' href='#L1'>line 1</a>",
+				"on <a class='lines' href='/snippet/view/pondXy7q2R/diff?from=1'>line 1 of version 1</a>\n        <em class='outdated'>outdated</em>",
+			},
+			notWantBody: []string{"<textarea name='body'>", "/comment/edit/"},
+		},
+		{
+			name:    "Comment author",
+			user:    "alice@example.com",
+			urlPath: "/snippet/view/pondXy7q2R",
+			wantBody: []string{
+				"<form action='/snippet/comment/pondXy7q2R' method='POST'>",
+				"<input type='hidden' name='parent_id' value='1'>",
+				"<a href='/comment/edit/1'>Edit</a>",
+			},
+			// Bob's comment is his, and it's too old to change anyway.
+			notWantBody: []string{"/comment/edit/2", "/comment/edit/3"},
+		},
+		{
+			name:        "Encrypted snippet",
+			user:        "alice@example.com",
+			urlPath:     "/snippet/view/s3cr3tN0te",
+			notWantBody: []string{"id='comments'", "/snippet/comment/"},
+		},
+		{
+			name:     "Listing",
+			urlPath:  "/",
+			wantBody: []string{"<span class='comment-count'>5 comments</span>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, http.StatusOK)
+
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+			for _, notWant := range tt.notWantBody {
+				assert.Equal(t, strings.Contains(body, notWant), false)
+			}
+		})
+	}
+}
+
+func TestSnippetCommentPost(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		user         string
+		urlPath      string
+		body         string
+		parentID     string
+		lineStart    string
+		lineEnd      string
+		version      string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Unauthenticated",
+			urlPath:      "/snippet/comment/pondXy7q2R",
+			body:         "Nice.",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Valid comment",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/comment/pondXy7q2R",
+			body:         "Nice.",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R#comment-4",
+		},
+		{
+			name:         "Valid reply",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/comment/pondXy7q2R",
+			body:         "Nice.",
+			parentID:     "1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R#comment-4",
+		},
+		{
+			name:         "Valid line comment",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/comment/pondXy7q2R",
+			body:         "Nice.",
+			lineStart:    "1",
+			version:      "2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R#comment-4",
+		},
+		{
+			name:      "Lines out of range",
+			user:      "bob@example.com",
+			urlPath:   "/snippet/comment/pondXy7q2R",
+			body:      "Nice.",
+			lineStart: "1",
+			lineEnd:   "3",
+			version:   "2",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must be a range of lines between 1 and 1",
+		},
+		{
+			name:      "Lines backwards",
+			user:      "bob@example.com",
+			urlPath:   "/snippet/comment/pondXy7q2R",
+			body:      "Nice.",
+			lineStart: "2",
+			lineEnd:   "1",
+			version:   "2",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must be a range of lines between 1 and 1",
+		},
+		{
+			name:      "Lines of an old version",
+			user:      "bob@example.com",
+			urlPath:   "/snippet/comment/pondXy7q2R",
+			body:      "Nice.",
+			lineStart: "1",
+			version:   "1",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This snippet has been changed since you loaded it.",
+		},
+		{
+			name:         "Reply with lines",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/comment/pondXy7q2R",
+			body:         "Nice.",
+			parentID:     "1",
+			lineStart:    "5",
+			version:      "1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R#comment-4",
+		},
+		{
+			name:     "Reply to a reply",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/comment/pondXy7q2R",
+			body:     "Nice.",
+			parentID: "2",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The comment you replied to no longer exists",
+		},
+		{
+			name:     "Blank comment",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/comment/pondXy7q2R",
+			body:     "  ",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Blank reply",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/comment/pondXy7q2R",
+			parentID: "1",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "<details class='reply' open>",
+		},
+		{
+			name:     "Too long",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/comment/pondXy7q2R",
+			body:     strings.Repeat("a", 5001),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be more than 5000 characters long",
+		},
+		{
+			name:         "Locked snippet",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/comment/l0ckedN0te",
+			body:         "Nice.",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/l0ckedN0te",
+		},
+		{
+			name:         "Encrypted snippet",
+			user:         "alice@example.com",
+			urlPath:      "/snippet/comment/s3cr3tN0te",
+			body:         "Nice.",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/s3cr3tN0te",
+		},
+		{
+			name:     "View-limited snippet",
+			user:     "alice@example.com",
+			urlPath:  "/snippet/comment/thr3eV1ews",
+			body:     "Nice.",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Another user's private snippet",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/comment/summ3rRivr",
+			body:     "Nice.",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			_, _, body := ts.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("body", tt.body)
+			form.Add("parent_id", tt.parentID)
+			form.Add("line_start", tt.lineStart)
+			form.Add("line_end", tt.lineEnd)
+			form.Add("version", tt.version)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, body := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetStar(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		user         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Unauthenticated",
+			urlPath:      "/snippet/star/pondXy7q2R",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Star",
+			user:         "alice@example.com",
+			urlPath:      "/snippet/star/pondXy7q2R",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R",
+		},
+		{
+			name:         "Unstar",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/unstar/pondXy7q2R",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R",
+		},
+		{
+			name:         "Locked snippet",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/star/l0ckedN0te",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/l0ckedN0te",
+		},
+		{
+			name:     "Another user's private snippet",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/star/summ3rRivr",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Old integer ID",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/star/1",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			_, _, body := ts.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestSnippetStars(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		user     string
+		urlPath  string
+		wantBody []string
+	}{
+		{
+			name:     "Anonymous user",
+			urlPath:  "/snippet/view/pondXy7q2R",
+			wantBody: []string{"<span class='star-count'>&#9733; 1 star</span>"},
+		},
+		{
+			name:     "Not starred",
+			user:     "alice@example.com",
+			urlPath:  "/snippet/view/pondXy7q2R",
+			wantBody: []string{"<form action='/snippet/star/pondXy7q2R' method='POST'>", "<button>Star</button>"},
+		},
+		{
+			name:     "Starred",
+			user:     "bob@example.com",
+			urlPath:  "/snippet/view/pondXy7q2R",
+			wantBody: []string{"<form action='/snippet/unstar/pondXy7q2R' method='POST'>", "<button>Unstar</button>"},
+		},
+		{
+			name:     "Listing",
+			urlPath:  "/",
+			wantBody: []string{"<span class='star-count'>&#9733; 1 star</span>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, http.StatusOK)
+
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+}
+
+func TestCommentEdit(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		user         string
+		method       string
+		urlPath      string
+		body         string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:     "Edit form",
+			user:     "alice@example.com",
+			method:   http.MethodGet,
+			urlPath:  "/comment/edit/1",
+			wantCode: http.StatusOK,
+			wantBody: "<textarea name='body'>Should this use `bufio`?</textarea>",
+		},
+		{
+			name:     "Another user's comment",
+			user:     "bob@example.com",
+			method:   http.MethodGet,
+			urlPath:  "/comment/edit/1",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:         "Too old",
+			user:         "bob@example.com",
+			method:       http.MethodGet,
+			urlPath:      "/comment/edit/3",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R#comment-3",
+		},
+		{
+			name:     "Non-existent comment",
+			user:     "alice@example.com",
+			method:   http.MethodGet,
+			urlPath:  "/comment/edit/99",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid ID",
+			user:     "alice@example.com",
+			method:   http.MethodGet,
+			urlPath:  "/comment/edit/foo",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Valid edit",
+			user:         "alice@example.com",
+			method:       http.MethodPost,
+			urlPath:      "/comment/edit/1",
+			body:         "Should this use `bufio.Scanner`?",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R#comment-1",
+		},
+		{
+			name:     "Blank edit",
+			user:     "alice@example.com",
+			method:   http.MethodPost,
+			urlPath:  "/comment/edit/1",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:         "Delete",
+			user:         "alice@example.com",
+			method:       http.MethodPost,
+			urlPath:      "/comment/delete/1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R#comments",
+		},
+		{
+			name:     "Delete another user's comment",
+			user:     "alice@example.com",
+			method:   http.MethodPost,
+			urlPath:  "/comment/delete/2",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.loginAs(t, tt.user)
+
+			var code int
+			var headers http.Header
+			var body string
+
+			if tt.method == http.MethodGet {
+				code, headers, body = ts.get(t, tt.urlPath)
+			} else {
+				_, _, body = ts.get(t, "/user/login")
+
+				form := url.Values{}
+				form.Add("body", tt.body)
+				form.Add("csrf_token", extractCSRFToken(t, body))
+
+				code, headers, body = ts.postForm(t, tt.urlPath, form)
+			}
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetCreate(t *testing.T) {
+	// Create a new instance of our application struct which uses the mocked
+	// dependencies.
+	app := newTestApplication(t)
+
+	type ActionValidate struct {
+		Method, Actual, Expectedstr string
+		ExpectedInt                 int
+	}
+
+	tests := []struct {
+		name, action string
+		invokeLogin  bool
+		validations  []ActionValidate
+	}{
+		{
+			name:        "Authenticated",
+			action:      "/snippet/create",
+			invokeLogin: true,
+			validations: []ActionValidate{
+				{Method: "Equal", Actual: "code", ExpectedInt: http.StatusOK},
+				{Method: "StringContains", Actual: "body", Expectedstr: "<form action='/snippet/create' method='POST'>"},
+			},
+		},
+		{
+			name:   "Unauthenticated",
+			action: "/snippet/create",
+			validations: []ActionValidate{
+				{Method: "Equal", Actual: "code", ExpectedInt: http.StatusSeeOther},
+				{Method: "Equal", Actual: "location", Expectedstr: "/user/login"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Establish a new test server for running end-to-end tests.
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.invokeLogin {
+				// Make a GET /user/login request and extract the CSRF token from the response
+				_, _, body := ts.get(t, "/user/login")
+				csrfToken := extractCSRFToken(t, body)
+
+				// Make a POST /user/login request using the extracted CSRF token and
+				// credentials from our the mock user model.
+				form := url.Values{}
+				form.Add("email", "alice@example.com")
+				form.Add("password", "pa$$word")
+				form.Add("csrf_token", csrfToken)
+				ts.postForm(t, "/user/login", form)
+			}
+
+			code, headers, body := ts.get(t, tt.action)
+
+			for _, v := range tt.validations {
+				switch v.Method {
+				case "Equal":
+					switch v.Actual {
+					case "code":
+						assert.Equal(t, code, v.ExpectedInt)
+					case "location":
+						assert.Equal(t, headers.Get("Location"), v.Expectedstr)
+					default:
+						t.Fatalf("Unknown validation method: %s", v.Actual)
+					}
+				case "StringContains":
+					assert.StringContains(t, body, v.Expectedstr)
+				}
+			}
+
+			ts.Close()
+		})
+	}
+}
+
+func TestUserSignup(t *testing.T) {
+	// Create the application struct containing our mocked dependencies and set
+	// up the test server for running an end-to-end test.
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Make a GET /user/signup request and then extract the CSRF token from the
+	// response body.
+	_, _, body := ts.get(t, "/user/signup")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	// Log the CSRF token value in our test output using the t.Logf() function.
+	// The t.Logf() function works in the same way as fmt.Printf(), but writes
+	// the provided message to the test output.
+	// t.Logf("CSRF token is: %q", validCSRFToken )
+
+	const (
+		validName     = "Bob"
+		validPassword = "validPassw0rd"
+		validEmail    = "bob@example.com"
+		formTag       = "<form action='/user/signup' method='POST' novalidate>"
+	)
+
+	tests := []struct {
+		name         string
+		userName     string
+		userEmail    string
+		userPassword string
+		csrfToken    string
+		wantCode     int
+		wantFormTag  string
+	}{
+		{
+			name:         "Valid submission",
+			userName:     validName,
+			userEmail:    validEmail,
+			userPassword: validPassword,
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusSeeOther,
+		},
+		{
+			name:         "Invalid CSRF Token",
+			userName:     validName,
+			userEmail:    validEmail,
+			userPassword: validPassword,
+			csrfToken:    "wrongToken",
+			wantCode:     http.StatusBadRequest,
+		},
+		{
+			name:         "Empty name",
+			userName:     "",
+			userEmail:    validEmail,
+			userPassword: validPassword,
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+		},
+		{
+			name:         "Empty email",
+			userName:     validName,
+			userEmail:    "",
+			userPassword: validPassword,
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+		},
+		{
+			name:         "Empty password",
+			userName:     validName,
+			userEmail:    validEmail,
+			userPassword: "",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+		},
+		{
+			name:         "Invalid email",
+			userName:     validName,
+			userEmail:    "bob@example.",
+			userPassword: validPassword,
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+		},
+		{
+			name:         "Short password",
+			userName:     validName,
+			userEmail:    validEmail,
+			userPassword: "pa$$",
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+		},
+		{
+			name:         "Duplicate email",
+			userName:     validName,
+			userEmail:    "dupe@example.com",
+			userPassword: validPassword,
+			csrfToken:    validCSRFToken,
+			wantCode:     http.StatusUnprocessableEntity,
+			wantFormTag:  formTag,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("name", tt.userName)
+			form.Add("email", tt.userEmail)
+			form.Add("password", tt.userPassword)
+			form.Add("csrf_token", tt.csrfToken)
+
+			code, _, body := ts.postForm(t, "/user/signup", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantFormTag != "" {
+				assert.StringContains(t, body, tt.wantFormTag)
+			}
+		})
+	}
+}
+
+func TestAccountSnippets(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, headers, _ := ts.get(t, "/account/snippets")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.login(t)
+
+		code, _, body := ts.get(t, "/account/snippets")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<a href='/snippet/view/pondXy7q2R'>An old silent pond</a>")
+		assert.StringContains(t, body, "Over the wintry forest <span class='badge'>Expired</span>")
+	})
+}
+
+func TestAccountStarred(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, headers, _ := ts.get(t, "/account/starred")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Starred snippets", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "bob@example.com")
+
+		code, _, body := ts.get(t, "/account/starred")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<a href='/snippet/view/pondXy7q2R'>An old silent pond</a>")
+	})
+
+	t.Run("No starred snippets", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "alice@example.com")
+
+		code, _, body := ts.get(t, "/account/starred")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "You haven't starred any snippets yet.")
+	})
+}
+
+func TestCollectionView(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name        string
+		user        string
+		urlPath     string
+		wantCode    int
+		wantBody    []string
+		notWantBody []string
+	}{
+		{
+			name:     "Public collection",
+			urlPath:  "/collections/0nb0ard1ng",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"<h2>Onboarding</h2>",
+				"<em>first</em>",
+				"<a href='/snippet/view/pondXy7q2R'>An old silent pond</a>",
+				"<a href='/snippet/view/cand1eLigh'>The light of a candle</a>",
+			},
+			notWantBody: []string{"data-reorder", "/collection/edit/0nb0ard1ng"},
+		},
+		{
+			name:     "Owner",
+			user:     "alice@example.com",
+			urlPath:  "/collections/0nb0ard1ng",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"data-reorder='/collection/order/0nb0ard1ng'",
+				"<li data-id='1' draggable='true'>",
+				"<a href='/collection/edit/0nb0ard1ng'>Edit</a>",
+			},
+		},
+		{
+			name:     "Own private collection",
+			user:     "alice@example.com",
+			urlPath:  "/collections/dr4ftsC0ll",
+			wantCode: http.StatusOK,
+			wantBody: []string{"There aren't any snippets in this collection yet. Add one from its page."},
+		},
+		{
+			name:     "Another user's private collection",
+			user:     "bob@example.com",
+			urlPath:  "/collections/dr4ftsC0ll",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Anonymous user's private collection",
+			urlPath:  "/collections/dr4ftsC0ll",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent collection",
+			urlPath:  "/collections/n0tH3r3xyz",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Collection list",
+			urlPath:  "/collections",
+			wantCode: http.StatusOK,
+			wantBody: []string{"<a href='/collections/0nb0ard1ng'>Onboarding</a>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+			for _, notWant := range tt.notWantBody {
+				assert.Equal(t, strings.Contains(body, notWant), false)
+			}
+		})
+	}
+}
+
+func TestCollectionCreate(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, headers, _ := ts.get(t, "/collection/create")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	tests := []struct {
+		name         string
+		title        string
+		description  string
+		visibility   string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Valid submission",
+			title:        "Favourites",
+			description:  "My *favourite* snippets.",
+			visibility:   "unlisted",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections/n3wC0llect",
+		},
+		{
+			name:       "Blank title",
+			visibility: "public",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field cannot be blank",
+		},
+		{
+			name:       "Long title",
+			title:      strings.Repeat("a", 101),
+			visibility: "public",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field cannot be more than 100 characters long",
+		},
+		{
+			name:        "Long description",
+			title:       "Favourites",
+			description: strings.Repeat("a", 2001),
+			visibility:  "public",
+			wantCode:    http.StatusUnprocessableEntity,
+			wantBody:    "This field cannot be more than 2000 characters long",
+		},
+		{
+			name:       "Invalid visibility",
+			title:      "Favourites",
+			visibility: "secret",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must equal public, unlisted or private",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.loginAs(t, "alice@example.com")
+
+			_, _, body := ts.get(t, "/collection/create")
+
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("description", tt.description)
+			form.Add("visibility", tt.visibility)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, body := ts.postForm(t, "/collection/create", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCollectionEdit(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		user         string
+		urlPath      string
+		form         url.Values
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Unauthenticated",
+			urlPath:      "/collection/edit/0nb0ard1ng",
+			form:         url.Values{"title": {"Onboarding"}, "visibility": {"public"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Edit",
+			user:         "alice@example.com",
+			urlPath:      "/collection/edit/0nb0ard1ng",
+			form:         url.Values{"title": {"Start here"}, "visibility": {"public"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections/0nb0ard1ng",
+		},
+		{
+			name:     "Invalid edit",
+			user:     "alice@example.com",
+			urlPath:  "/collection/edit/0nb0ard1ng",
+			form:     url.Values{"title": {""}, "visibility": {"public"}},
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Another user's collection",
+			user:     "bob@example.com",
+			urlPath:  "/collection/edit/0nb0ard1ng",
+			form:     url.Values{"title": {"Mine now"}, "visibility": {"public"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Another user's private collection",
+			user:     "bob@example.com",
+			urlPath:  "/collection/edit/dr4ftsC0ll",
+			form:     url.Values{"title": {"Mine now"}, "visibility": {"public"}},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Delete",
+			user:         "alice@example.com",
+			urlPath:      "/collection/delete/dr4ftsC0ll",
+			form:         url.Values{},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/account/collections",
+		},
+		{
+			name:     "Delete another user's collection",
+			user:     "bob@example.com",
+			urlPath:  "/collection/delete/0nb0ard1ng",
+			form:     url.Values{},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Reorder",
+			user:     "alice@example.com",
+			urlPath:  "/collection/order/0nb0ard1ng",
+			form:     url.Values{"snippet_id": {"5", "1"}},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Reorder another user's collection",
+			user:     "bob@example.com",
+			urlPath:  "/collection/order/0nb0ard1ng",
+			form:     url.Values{"snippet_id": {"5", "1"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:         "Remove",
+			user:         "alice@example.com",
+			urlPath:      "/collection/remove/0nb0ard1ng",
+			form:         url.Values{"snippet_id": {"5"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections/0nb0ard1ng",
+		},
+		{
+			name:     "Remove a snippet which isn't in the collection",
+			user:     "alice@example.com",
+			urlPath:  "/collection/remove/0nb0ard1ng",
+			form:     url.Values{"snippet_id": {"6"}},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			_, _, body := ts.get(t, "/user/login")
+			tt.form.Set("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, tt.form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestSnippetCollect(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		user         string
+		urlPath      string
+		collectionID string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Unauthenticated",
+			urlPath:      "/snippet/collect/pondXy7q2R",
+			collectionID: "1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/user/login",
+		},
+		{
+			name:         "Add to own collection",
+			user:         "alice@example.com",
+			urlPath:      "/snippet/collect/pondXy7q2R",
+			collectionID: "2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/pondXy7q2R",
+		},
+		{
+			name:         "Add to another user's collection",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/collect/pondXy7q2R",
+			collectionID: "1",
+			wantCode:     http.StatusForbidden,
+		},
+		{
+			name:         "Non-existent collection",
+			user:         "alice@example.com",
+			urlPath:      "/snippet/collect/pondXy7q2R",
+			collectionID: "99",
+			wantCode:     http.StatusBadRequest,
+		},
+		{
+			name:         "Another user's private snippet",
+			user:         "bob@example.com",
+			urlPath:      "/snippet/collect/summ3rRivr",
+			collectionID: "1",
+			wantCode:     http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.user != "" {
+				ts.loginAs(t, tt.user)
+			}
+
+			_, _, body := ts.get(t, "/user/login")
+
+			form := url.Values{}
+			form.Add("collection_id", tt.collectionID)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	t.Run("Collection picker", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "alice@example.com")
+
+		code, _, body := ts.get(t, "/snippet/view/pondXy7q2R")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<option value='2'>Drafts</option>")
+	})
+}
+
+func TestAccountCollections(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, headers, _ := ts.get(t, "/account/collections")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	t.Run("Own collections", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "alice@example.com")
+
+		code, _, body := ts.get(t, "/account/collections")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<a href='/collections/dr4ftsC0ll'>Drafts</a> <span class='badge'>private</span>")
+		assert.StringContains(t, body, "<a href='/collections/0nb0ard1ng'>Onboarding</a>")
+	})
+
+	t.Run("No collections", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		ts.loginAs(t, "bob@example.com")
+
+		code, _, body := ts.get(t, "/account/collections")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "You haven't created any collections yet.")
+	})
+}
+
+func TestSnippetEdit(t *testing.T) {
+	app := newTestApplication(t)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, headers, _ := ts.get(t, "/snippet/edit/pondXy7q2R")
+
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/user/login")
+	})
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	t.Run("Non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/snippet/edit/2")
+
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	_, _, body := ts.get(t, "/snippet/edit/pondXy7q2R")
+	assert.StringContains(t, body, "<form action='/snippet/edit/pondXy7q2R' method='POST'>")
+	assert.StringContains(t, body, "<input type='hidden' name='version' value='2'>")
+	assert.StringContains(t, body, "name='tags' value='haiku, poetry'")
+	assert.StringContains(t, body, "name='files[0].name' value='splash.sh'")
+	assert.StringContains(t, body, "<input type='radio' name='expires' value='at' checked>")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		title      string
+		format     string
+		tags       string
+		language   string
+		visibility string
+		files      url.Values
+		password   string
+		viewLimit  string
+		expiry     url.Values
+		version    string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:       "Valid submission",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Empty title",
+			title:      "",
+			format:     "code",
+			visibility: "public",
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field cannot be blank",
+		},
+		{
+			name:       "Valid tags",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			tags:       "Haiku, poetry, haiku",
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Too many tags",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			tags:       "a, b, c, d, e, f",
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field cannot have more than 5 tags",
+		},
+		{
+			name:       "Invalid tag",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			tags:       "haiku, old pond",
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "Tags can only contain letters, numbers",
+		},
+		{
+			name:       "Valid markdown",
+			title:      "An old silent pond",
+			format:     "markdown",
+			visibility: "public",
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Invalid format",
+			title:      "An old silent pond",
+			format:     "html",
+			visibility: "public",
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must equal plain, code or markdown",
+		},
+		{
+			name:       "Valid language",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			language:   "python",
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Invalid language",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			language:   "cobol",
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be a supported language",
+		},
+		{
+			name:       "Valid files",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			version:    "2",
+			files: url.Values{
+				"files[0].name":    {"splash.sh"},
+				"files[0].content": {"echo 'splash!'"},
+				"files[1].name":    {""},
+				"files[1].content": {""},
+			},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:       "Duplicate file name",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			version:    "2",
+			files: url.Values{
+				"files[0].name":    {"splash.sh"},
+				"files[0].content": {"echo 'splash!'"},
+				"files[1].name":    {"Splash.sh"},
+				"files[1].content": {"echo 'splosh!'"},
+			},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The file name is already used by another file",
+		},
+		{
+			name:       "Unsafe file name",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			version:    "2",
+			files: url.Values{
+				"files[0].name":    {"../splash.sh"},
+				"files[0].content": {"echo 'splash!'"},
+			},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The file name can only contain letters, numbers",
+		},
+		{
+			name:       "Empty file",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			version:    "2",
+			files: url.Values{
+				"files[0].name": {"splash.sh"},
+			},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The file content cannot be blank",
+		},
+		{
+			name:       "Valid visibility",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "private",
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Invalid visibility",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "secret",
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must equal public, unlisted or private",
+		},
+		{
+			name:       "Valid password",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "unlisted",
+			password:   "open sesame",
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Short password",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "unlisted",
+			password:   "sesame",
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be at least 8 characters long",
+		},
+		{
+			name:       "Valid view limit",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "unlisted",
+			viewLimit:  "5",
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Too many views",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "unlisted",
+			viewLimit:  "1000",
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be between 1 and 100, or blank for no limit",
+		},
+		{
+			name:       "Never expires",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires": {"never"}},
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Shortest expiry",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires_after": {"10"}, "expires_unit": {"minutes"}},
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Expiry too soon",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires_after": {"9"}, "expires_unit": {"minutes"}},
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be between 10 minutes and 5 years from now",
+		},
+		{
+			name:       "Expiry too late",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires_after": {"6"}, "expires_unit": {"years"}},
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be between 10 minutes and 5 years from now",
+		},
+		{
+			name:       "Overflowing expiry",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires_after": {"9223372036854775807"}, "expires_unit": {"years"}},
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be between 10 minutes and 5 years from now",
+		},
+		{
+			name:       "Invalid expiry unit",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires_unit": {"fortnights"}},
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must equal minutes, hours, days, weeks or years",
+		},
+		{
+			name:       "Expiry time",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires": {"at"}, "expires_at": {time.Now().UTC().Add(48 * time.Hour).Format("2006-01-02T15:04")}},
+			version:    "2",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Past expiry time",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires": {"at"}, "expires_at": {"2020-01-01T00:00"}},
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be between 10 minutes and 5 years from now",
+		},
+		{
+			name:       "Invalid expiry time",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires": {"at"}, "expires_at": {"tomorrow"}},
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be a date and time",
+		},
+		{
+			name:       "Invalid expiry",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			expiry:     url.Values{"expires": {"7"}},
+			version:    "2",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must equal after, at or never",
+		},
+		{
+			name:       "Stale version",
+			title:      "An old silent pond",
+			format:     "code",
+			visibility: "public",
+			version:    "1",
+			wantCode:   http.StatusConflict,
+			wantBody:   "This snippet has been changed by someone else",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "An old silent pond...")
+			form.Add("expires", "after")
+			form.Add("expires_after", "7")
+			form.Add("expires_unit", "days")
+			form.Add("format", tt.format)
+			form.Add("tags", tt.tags)
+			form.Add("language", tt.language)
+			form.Add("visibility", tt.visibility)
+			form.Add("password", tt.password)
+			form.Add("view_limit", tt.viewLimit)
+			form.Add("version", tt.version)
+			form.Add("csrf_token", csrfToken)
+			for key, values := range tt.files {
+				form[key] = values
+			}
+			for key, values := range tt.expiry {
+				form[key] = values
+			}
+
+			code, _, body := ts.postForm(t, "/snippet/edit/pondXy7q2R", form)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// expiringSoon wraps the mock snippet model so that the snippets it returns
+// expire in a few minutes.
+type expiringSoon struct {
+	mocks.SnippetModel
+	expires time.Time
+}
+
+func (m *expiringSoon) GetVisible(slug string, viewerID int) (models.Snippet, error) {
+	s, err := m.SnippetModel.GetVisible(slug, viewerID)
+	s.Expires = m.expires
+	return s, err
+}
+
+func TestSnippetEditExpiringSoon(t *testing.T) {
+	expires := time.Now().Add(5 * time.Minute)
+
+	app := newTestApplication(t)
+	app.snippets = &expiringSoon{expires: expires}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/edit/pondXy7q2R")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name      string
+		expiresAt string
+		wantCode  int
+	}{
+		{
+			name:      "Keep current expiry",
+			expiresAt: expires.UTC().Format("2006-01-02T15:04"),
+			wantCode:  http.StatusSeeOther,
+		},
+		{
+			name:      "New expiry too soon",
+			expiresAt: expires.UTC().Add(time.Minute).Format("2006-01-02T15:04"),
+			wantCode:  http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "A new title")
+			form.Add("content", "An old silent pond...")
+			form.Add("format", "code")
+			form.Add("visibility", "public")
+			form.Add("expires", "at")
+			form.Add("expires_at", tt.expiresAt)
+			form.Add("version", "2")
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, "/snippet/edit/pondXy7q2R", form)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestSnippetHistory(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "History",
+			urlPath:  "/snippet/view/pondXy7q2R/history",
+			wantCode: http.StatusOK,
+			wantBody: []string{"v2 (current)", "/snippet/view/pondXy7q2R/diff?from=1&to=2"},
+		},
+		{
+			name:     "History of non-existent ID",
+			urlPath:  "/snippet/view/2/history",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Default diff",
+			urlPath:  "/snippet/view/pondXy7q2R/diff",
+			wantCode: http.StatusOK,
+			wantBody: []string{"@@ -1,1 &#43;1,1 @@", "<span class='delete'>-An old pond...</span>", "<span class='insert'>&#43;An old silent pond...</span>"},
+		},
+		{
+			name:     "Identical versions",
+			urlPath:  "/snippet/view/pondXy7q2R/diff?from=2&to=2",
+			wantCode: http.StatusOK,
+			wantBody: []string{"The content of these versions is identical."},
+		},
+		{
+			name:     "Non-existent version",
+			urlPath:  "/snippet/view/pondXy7q2R/diff?from=7",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid version",
+			urlPath:  "/snippet/view/pondXy7q2R/diff?from=foo",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+}
+
+func TestSnippetTrash(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/account/trash")
+	assert.StringContains(t, body, "First autumn morning")
+	assert.StringContains(t, body, "<form action='/snippet/restore/4' method='POST'>")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Delete",
+			urlPath:      "/snippet/delete/pondXy7q2R",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/account/trash",
+		},
+		{
+			name:     "Delete non-existent ID",
+			urlPath:  "/snippet/delete/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Restore",
+			urlPath:      "/snippet/restore/4",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/autUmn4Mrn",
+		},
+		{
+			name:     "Restore snippet not in trash",
+			urlPath:  "/snippet/restore/1",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestSnippetBrowse(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Default sort",
+			urlPath:  "/snippets",
+			wantCode: http.StatusOK,
+			wantBody: "<a href='/snippets?sort=newest' class='live'>Newest</a>",
+		},
+		{
+			name:     "Title sort",
+			urlPath:  "/snippets?sort=title",
+			wantCode: http.StatusOK,
+			wantBody: "<a href='/snippets?sort=title' class='live'>Title</a>",
+		},
+		{
+			name:     "Unknown sort",
+			urlPath:  "/snippets?sort=random",
+			wantCode: http.StatusOK,
+			wantBody: "<a href='/snippets?sort=newest' class='live'>Newest</a>",
+		},
+		{
+			name:     "Invalid cursor",
+			urlPath:  "/snippets?cursor=foo",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+				assert.StringContains(t, body, "An old silent pond")
+			}
+		})
+	}
+}
+
+func TestSnippetTrending(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantBody string
+	}{
+		{
+			name:     "Default period",
+			urlPath:  "/trending",
+			wantBody: "<a href='/trending?period=day' class='live'>24 hours</a>",
+		},
+		{
+			name:     "Last week",
+			urlPath:  "/trending?period=week",
+			wantBody: "<a href='/trending?period=week' class='live'>7 days</a>",
+		},
+		{
+			name:     "Unknown period",
+			urlPath:  "/trending?period=year",
+			wantBody: "<a href='/trending?period=day' class='live'>24 hours</a>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, tt.wantBody)
+			assert.StringContains(t, body, "<a href='/snippet/view/pondXy7q2R'>An old silent pond</a>")
+			assert.StringContains(t, body, "<td>42</td>")
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "No query",
+			urlPath:  "/search",
+			wantCode: http.StatusOK,
+			wantBody: "<form class='search' action='/search' method='GET'>",
+		},
+		{
+			name:     "Match",
+			urlPath:  "/search?q=pond",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent <mark>pond</mark>",
+		},
+		{
+			name:     "Excluded",
+			urlPath:  "/search?q=pond+-silent",
+			wantCode: http.StatusOK,
+			wantBody: "No snippets matched your search.",
+		},
+		{
+			name:     "Invalid page",
+			urlPath:  "/search?q=pond&page=0",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Home page tag cloud", func(t *testing.T) {
+		code, _, body := ts.get(t, "/")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<a href='/tags/haiku' class='weight-5'>haiku</a>")
+		assert.StringContains(t, body, "<a href='/tags/poetry' class='weight-1'>poetry</a>")
+	})
+
+	t.Run("Snippet tags", func(t *testing.T) {
+		code, _, body := ts.get(t, "/snippet/view/pondXy7q2R")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<a href='/tags/poetry'>poetry</a>")
+	})
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Tag page",
+			urlPath:  "/tags/haiku",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond",
+		},
+		{
+			name:     "Unused tag",
+			urlPath:  "/tags/sql",
+			wantCode: http.StatusOK,
+			wantBody: "There aren't any snippets with this tag.",
+		},
+		{
+			name:     "Invalid tag",
+			urlPath:  "/tags/Haiku",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Suggestions",
+			urlPath:  "/tags/suggest?prefix=HA",
+			wantCode: http.StatusOK,
+			wantBody: `["haiku"]`,
+		},
+		{
+			name:     "No suggestions",
+			urlPath:  "/tags/suggest?prefix=sql",
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		{
+			name:     "Empty prefix",
+			urlPath:  "/tags/suggest",
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetRaw(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, body := ts.get(t, "/snippet/raw/pondXy7q2R")
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "text/plain; charset=utf-8")
+	assert.Equal(t, body, "An old silent pond...")
+
+	etag := headers.Get("ETag")
+	lastModified := headers.Get("Last-Modified")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		headers  http.Header
+		wantCode int
+	}{
+		{
+			name:     "Matching ETag",
+			urlPath:  "/snippet/raw/pondXy7q2R",
+			headers:  http.Header{"If-None-Match": {etag}},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "Stale ETag",
+			urlPath:  "/snippet/raw/pondXy7q2R",
+			headers:  http.Header{"If-None-Match": {`"stale"`}},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Not modified since",
+			urlPath:  "/snippet/raw/pondXy7q2R",
+			headers:  http.Header{"If-Modified-Since": {lastModified}},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/snippet/raw/2",
+			headers:  http.Header{},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.getWithHeaders(t, tt.urlPath, tt.headers)
+
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestSnippetDownload(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, body := ts.get(t, "/snippet/download/pondXy7q2R")
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Disposition"), "attachment; filename=an-old-silent-pond.txt")
+	assert.Equal(t, body, "An old silent pond...")
+
+	t.Run("Zip archive", func(t *testing.T) {
+		code, headers, body := ts.get(t, "/snippet/download/pondXy7q2R.zip")
+
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, headers.Get("Content-Type"), "application/zip")
+		assert.Equal(t, headers.Get("Content-Disposition"), "attachment; filename=an-old-silent-pond.zip")
+
+		zr, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]string{
+			"an-old-silent-pond.txt": "An old silent pond...",
+			"splash.sh":              "echo 'splash!'",
+		}
+		assert.Equal(t, len(zr.File), len(want))
+
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, string(content), want[f.Name])
+		}
+	})
 }
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+
+	"github.com/AguilaMike/snippetbox/internal/diff"
+	"github.com/AguilaMike/snippetbox/internal/highlight"
+	"github.com/AguilaMike/snippetbox/internal/models"
 )
 
 // The serverError helper writes a log entry at Error level (including the request
@@ -90,11 +104,29 @@ func (app *application) newTemplateData(r *http.Request) templateData {
 		// Add the flash message to the template data, if one exists.
 		Flash: app.sessionManager.PopString(r.Context(), "flash"),
 		// Add the authentication status to the template data.
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r), // Add the CSRF token.
+		IsAuthenticated:     app.isAuthenticated(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
+		CSRFToken:           nosurf.Token(r), // Add the CSRF token.
 	}
 }
 
+// The writeJSON helper encodes data as JSON and sends it with the provided
+// HTTP status code. As with render(), the data is encoded to a buffer first
+// so that an encoding error can still be turned into a 500 response.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.logger.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+	w.Write([]byte("\n"))
+}
+
 // Create a new decodePostForm() helper method. The second parameter here, dst,
 // is the target destination that we want to decode the form data into.
 func (app *application) decodePostForm(r *http.Request, dst any) error {
@@ -136,3 +168,547 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticated
 }
+
+// Return the ID of the user making the current request, or 0 if the request
+// isn't from an authenticated user.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+
+	return app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+}
+
+// The readSnippet helper fetches the snippet identified by the {slug} path
+// value. If no matching snippet exists a 404 Not Found response is sent, and
+// the returned bool is false. Private snippets are only returned to their
+// author; anybody else gets a 404 Not Found response, as if the snippet
+// didn't exist.
+func (app *application) readSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	return app.fetchSnippet(w, r, r.PathValue("slug"))
+}
+
+// The fetchSnippet helper works like readSnippet, but takes the slug as a
+// parameter rather than from the path.
+func (app *application) fetchSnippet(w http.ResponseWriter, r *http.Request, slug string) (models.Snippet, bool) {
+	// Links from before slugs were introduced use the integer ID instead.
+	// Slugs always contain a letter, so they can't be mistaken for one.
+	if id, err := strconv.Atoi(slug); err == nil {
+		app.redirectToSlug(w, r, id, slug)
+		return models.Snippet{}, false
+	}
+
+	viewerID := app.authenticatedUserID(r)
+
+	snippet, err := app.snippets.GetVisible(slug, viewerID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	// The model has already checked the visibility, but we check it again
+	// here so that a mistake in a query can't expose a private snippet.
+	if !snippet.VisibleTo(viewerID) {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// The redirectToSlug helper sends a 301 Moved Permanently response which
+// redirects a URL containing an old integer ID to the same URL with the
+// snippet's slug in its place. Only public snippets are redirected, because
+// otherwise counting through the IDs would still find unlisted and private
+// snippets. Everything else gets a 404 Not Found response.
+func (app *application) redirectToSlug(w http.ResponseWriter, r *http.Request, id int, idValue string) {
+	if id < 1 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		http.NotFound(w, r)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if snippet.Visibility != models.VisibilityPublic {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Swap the ID for the slug in the path segment it came from, keeping
+	// anything else in the segment (like a .zip suffix), the rest of the
+	// path and the query string.
+	segments := strings.Split(r.URL.Path, "/")
+	for i, segment := range segments {
+		if segment == r.PathValue("slug") {
+			segments[i] = snippet.Slug + strings.TrimPrefix(segment, idValue)
+			break
+		}
+	}
+
+	u := *r.URL
+	u.Path = strings.Join(segments, "/")
+	u.RawPath = ""
+
+	http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+}
+
+// unlockKey returns the session key which records that a password-protected
+// snippet has been unlocked.
+func unlockKey(snippetID int) string {
+	return fmt.Sprintf("unlockedSnippet:%d", snippetID)
+}
+
+// The unlocked helper returns true if the current user can read the content
+// of a snippet: it isn't password-protected, they're its author, or they've
+// already entered its password in this session.
+func (app *application) unlocked(r *http.Request, snippet models.Snippet) bool {
+	if !snippet.Protected || app.isAuthor(r, snippet) {
+		return true
+	}
+
+	return app.sessionManager.GetBool(r.Context(), unlockKey(snippet.ID))
+}
+
+// The countView helper counts a view of a snippet, unless the current user is
+// its author, or their view of it has been counted recently. That way
+// reloading the page doesn't add to the count. Viewers are told apart by
+// their session, or by their IP address if they don't have one, as is the
+// case for crawlers. The views which have been counted are remembered in
+// memory, rather than in the session, so that counting a view never writes
+// to the session store.
+func (app *application) countView(r *http.Request, snippet models.Snippet) {
+	if app.isAuthor(r, snippet) {
+		return
+	}
+
+	viewer := app.sessionManager.Token(r.Context())
+	if viewer == "" {
+		viewer = "ip:" + clientIP(r)
+	}
+
+	app.viewCounter.addOnce(viewer, snippet.ID)
+}
+
+// The isAuthor helper returns true if the current user wrote a snippet.
+func (app *application) isAuthor(r *http.Request, snippet models.Snippet) bool {
+	userID := app.authenticatedUserID(r)
+	return userID != 0 && userID == snippet.UserID
+}
+
+// The requireReadable helper checks that the current user can read the
+// content of a snippet anywhere other than its page. If they can't, they're
+// redirected to the snippet's page, and the returned bool is false. That's
+// where they enter the password of a password-protected snippet, and where
+// the views of a view-limited snippet are counted, so only the author can
+// skip it for those. Encrypted snippets can only be decrypted by the script
+// on their page, so everybody is sent there.
+func (app *application) requireReadable(w http.ResponseWriter, r *http.Request, snippet models.Snippet) bool {
+	if app.unlocked(r, snippet) && (snippet.ViewsLeft == 0 || app.isAuthor(r, snippet)) && !snippet.Encrypted() {
+		return true
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+	return false
+}
+
+// The ownedSnippet helper works like readSnippet, but also checks that the
+// snippet belongs to the current user. If it belongs to somebody else a 403
+// Forbidden response is sent.
+func (app *application) ownedSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// The editableSnippet helper works like ownedSnippet, but also checks that
+// the snippet can be edited. Encrypted snippets can't be, because the server
+// never sees their content, so the author is sent back to the snippet's page
+// with a flash message instead.
+func (app *application) editableSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, ok := app.ownedSnippet(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	if snippet.Encrypted() {
+		app.sessionManager.Put(r.Context(), "flash", "Encrypted snippets can't be edited.")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", snippet.Slug), http.StatusSeeOther)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// The forkSource helper returns the snippet which a fork was made from, so
+// that the fork's page can link to it. It returns nil if the snippet wasn't
+// forked, or if the original has since expired or been deleted. It also
+// returns nil unless the original is public or belongs to the current user,
+// so that a public fork can't give away the link to an unlisted original.
+func (app *application) forkSource(r *http.Request, snippet models.Snippet) (*models.Snippet, error) {
+	if snippet.ForkedFrom == 0 {
+		return nil, nil
+	}
+
+	source, err := app.snippets.Get(snippet.ForkedFrom)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if source.Visibility != models.VisibilityPublic && !app.isAuthor(r, source) {
+		return nil, nil
+	}
+
+	return &source, nil
+}
+
+// The ownedComment helper fetches the comment identified by the {id} path
+// value, along with the snippet it's on, and checks that the current user can
+// still change it. If the comment doesn't exist, or its snippet can't be read
+// by the current user, a 404 Not Found response is sent. If it belongs to
+// somebody else a 403 Forbidden response is sent, and if it's too old to be
+// changed the user is sent back to it with a flash message.
+func (app *application) ownedComment(w http.ResponseWriter, r *http.Request) (models.Comment, models.Snippet, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	comment, err := app.comments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	snippet, err := app.snippets.Get(comment.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	if !snippet.VisibleTo(userID) {
+		http.NotFound(w, r)
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	if comment.UserID != userID {
+		app.clientError(w, http.StatusForbidden)
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	if !recentComment(comment) {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Comments can only be changed for %d minutes after they're posted.", int(commentEditWindow.Minutes())))
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comment-%d", snippet.Slug, comment.ID), http.StatusSeeOther)
+		return models.Comment{}, models.Snippet{}, false
+	}
+
+	return comment, snippet, true
+}
+
+// The readCollection helper fetches the collection identified by the {slug}
+// path value. Like readSnippet, it sends a 404 Not Found response if the
+// collection doesn't exist or is somebody else's private collection.
+func (app *application) readCollection(w http.ResponseWriter, r *http.Request) (models.Collection, bool) {
+	viewerID := app.authenticatedUserID(r)
+
+	collection, err := app.collections.GetVisible(r.PathValue("slug"), viewerID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Collection{}, false
+	}
+
+	if !collection.VisibleTo(viewerID) {
+		http.NotFound(w, r)
+		return models.Collection{}, false
+	}
+
+	return collection, true
+}
+
+// The ownedCollection helper works like readCollection, but also sends a 403
+// Forbidden response if the collection belongs to somebody else.
+func (app *application) ownedCollection(w http.ResponseWriter, r *http.Request) (models.Collection, bool) {
+	collection, ok := app.readCollection(w, r)
+	if !ok {
+		return models.Collection{}, false
+	}
+
+	if collection.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return models.Collection{}, false
+	}
+
+	return collection, true
+}
+
+// The countComments helper fills in the CommentCount of each snippet in a
+// listing.
+func (app *application) countComments(snippets []models.Snippet) error {
+	ids := make([]int, len(snippets))
+	for i, s := range snippets {
+		ids[i] = s.ID
+	}
+
+	counts, err := app.comments.Counts(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range snippets {
+		snippets[i].CommentCount = counts[snippets[i].ID]
+	}
+
+	return nil
+}
+
+// The anchorComments helper moves comments about lines of an earlier version
+// of a snippet to the same lines in the current version, so that they still
+// point at the right code after an edit. Comments whose lines have since been
+// changed or removed are marked as outdated instead, and keep the line numbers
+// from their own version.
+func (app *application) anchorComments(snippet models.Snippet, comments []models.Comment) error {
+	// Comments are often made against the same version, so each version is
+	// only compared with the current one once.
+	lineMaps := map[int]map[int]int{}
+
+	for i := range comments {
+		c := &comments[i]
+		if !c.OnLines() || c.Version == snippet.Version {
+			continue
+		}
+
+		lines, ok := lineMaps[c.Version]
+		if !ok {
+			// If the version can't be found the comment's lines can't be
+			// matched up, so it's treated as outdated.
+			revision, err := app.snippetVersion(snippet, c.Version)
+			if err == nil {
+				lines = diff.LineMap(revision.Content, snippet.Content)
+			} else if !errors.Is(err, models.ErrNoRecord) {
+				return err
+			}
+			lineMaps[c.Version] = lines
+		}
+
+		// Every line in the range has to have survived, and still be next
+		// to the others.
+		start, ok := lines[c.LineStart]
+		for n := c.LineStart + 1; ok && n <= c.LineEnd; n++ {
+			ok = lines[n] == start+n-c.LineStart
+		}
+
+		if !ok {
+			c.Outdated = true
+			continue
+		}
+		c.LineEnd = start + c.LineEnd - c.LineStart
+		c.LineStart = start
+	}
+
+	return nil
+}
+
+// The lineCount helper returns the number of lines in some text, counted in
+// the same way as the lines shown on a snippet's page.
+func lineCount(s string) int {
+	s = strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	return strings.Count(s, "\n") + 1
+}
+
+// The snippetVersion helper returns a specific version of a snippet. The
+// current version comes from the snippet itself, and earlier versions are
+// looked up in the revisions model.
+func (app *application) snippetVersion(snippet models.Snippet, version int) (models.Revision, error) {
+	if version == snippet.Version {
+		return models.Revision{
+			SnippetID: snippet.ID,
+			Version:   snippet.Version,
+			Title:     snippet.Title,
+			Content:   snippet.Content,
+		}, nil
+	}
+
+	return app.revisions.Get(snippet.ID, version)
+}
+
+// The serveSnippetContent helper sends the content of a snippet as plain
+// text. http.ServeContent() uses the ETag and the snippet's last modified time
+// to answer conditional requests with a 304 Not Modified response, and also
+// supports range requests.
+func (app *application) serveSnippetContent(w http.ResponseWriter, r *http.Request, snippet models.Snippet) {
+	sum := sha256.Sum256([]byte(snippet.Content))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+
+	http.ServeContent(w, r, "", snippet.Updated, strings.NewReader(snippet.Content))
+}
+
+// The serveSnippetZip helper streams a snippet and its extra files to the
+// client as a zip archive. Once the archive has started the status code has
+// already been sent, so any error after that point can only be logged.
+func (app *application) serveSnippetZip(w http.ResponseWriter, r *http.Request, snippet models.Snippet, files []models.SnippetFile) {
+	filename := snippetFilename(snippet)
+
+	archive := strings.TrimSuffix(filename, path.Ext(filename)) + ".zip"
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": archive})
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", disposition)
+
+	entries := []models.SnippetFile{{Name: filename, Content: snippet.Content}}
+	entries = append(entries, files...)
+
+	zw := zip.NewWriter(w)
+
+	// The name of the main file comes from the title, so it could clash with
+	// one of the extra files. Archive names need to be unique, so any clash
+	// gets a number added to it.
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     uniqueFilename(entry.Name, seen),
+			Method:   zip.Deflate,
+			Modified: snippet.Updated,
+		})
+		if err == nil {
+			_, err = io.WriteString(fw, entry.Content)
+		}
+		if err != nil {
+			app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+			return
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	}
+}
+
+// uniqueFilename returns name, or if it has already been seen, name with a
+// number added before the extension. The returned name is recorded in seen.
+func uniqueFilename(name string, seen map[string]bool) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	unique := name
+	for i := 2; seen[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	seen[strings.ToLower(unique)] = true
+
+	return unique
+}
+
+// snippetFilename returns the filename used when downloading a snippet. It's
+// made from the title, with an extension that matches the snippet's format
+// or language.
+func snippetFilename(snippet models.Snippet) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(snippet.Title) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteRune('-')
+		}
+	}
+
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		name = fmt.Sprintf("snippet-%d", snippet.ID)
+	}
+
+	ext := ".txt"
+	switch snippet.Format {
+	case models.FormatMarkdown:
+		ext = ".md"
+	case models.FormatCode:
+		if lang := highlight.Lookup(highlight.Resolve(snippet.Language, snippet.Content)); lang != nil {
+			ext = lang.Extension
+		}
+	}
+
+	return name + ext
+}
+
+// The readInt helper reads an integer value from the query string. If the key
+// isn't present the provided default value is returned instead.
+func (app *application) readInt(qs url.Values, key string, defaultValue int) (int, error) {
+	if !qs.Has(key) {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(qs.Get(key))
+}
+
+// The indexSnippet helper fetches a snippet and adds it to the search index,
+// so that the index reflects a change which has just been saved. A failure
+// here is logged rather than returned, because the change itself has
+// already been made. Only public snippets which aren't encrypted and don't
+// have a password or a view limit appear in search results, so any other
+// snippet is removed from the index instead.
+func (app *application) indexSnippet(r *http.Request, id int) {
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+		return
+	}
+
+	if snippet.Visibility != models.VisibilityPublic || snippet.Protected || snippet.ViewsLeft > 0 || snippet.Encrypted() {
+		app.unindexSnippet(r, id)
+		return
+	}
+
+	err = app.searchIndex.Index(snippet)
+	if err != nil {
+		app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	}
+}
+
+// The unindexSnippet helper removes a snippet from the search index. As with
+// indexSnippet, failures are only logged.
+func (app *application) unindexSnippet(r *http.Request, id int) {
+	err := app.searchIndex.Delete(id)
+	if err != nil {
+		app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	}
+}
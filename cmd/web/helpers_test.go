@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+func TestSnippetFilename(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet models.Snippet
+		want    string
+	}{
+		{
+			name:    "Language",
+			snippet: models.Snippet{Title: "Hello, World!", Format: models.FormatCode, Language: "go"},
+			want:    "hello-world.go",
+		},
+		{
+			name:    "Detected language",
+			snippet: models.Snippet{Title: "Query", Format: models.FormatCode, Content: "SELECT id FROM snippets WHERE id = 1"},
+			want:    "query.sql",
+		},
+		{
+			name:    "Markdown",
+			snippet: models.Snippet{Title: "Deploy runbook", Format: models.FormatMarkdown, Language: "go"},
+			want:    "deploy-runbook.md",
+		},
+		{
+			name:    "No usable title",
+			snippet: models.Snippet{ID: 7, Title: "¿¿??", Format: models.FormatPlain},
+			want:    "snippet-7.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, snippetFilename(tt.snippet), tt.want)
+		})
+	}
+}
+
+func TestUniqueFilename(t *testing.T) {
+	seen := make(map[string]bool)
+
+	assert.Equal(t, uniqueFilename("main.go", seen), "main.go")
+	assert.Equal(t, uniqueFilename("Main.go", seen), "Main-2.go")
+	assert.Equal(t, uniqueFilename("main.go", seen), "main-3.go")
+	assert.Equal(t, uniqueFilename("Makefile", seen), "Makefile")
+	assert.Equal(t, uniqueFilename("Makefile", seen), "Makefile-2")
+}
+
+func TestAnchorComments(t *testing.T) {
+	app := newTestApplication(t)
+
+	// The first version of mock snippet 1 is a single line, "An old pond...",
+	// which is now the second line.
+	snippet := models.Snippet{
+		ID:      1,
+		Content: "A new first line\nAn old pond...\nAnd a last line\n",
+		Version: 3,
+	}
+
+	comments := []models.Comment{
+		{ID: 1, LineStart: 1, LineEnd: 1, Version: 1},
+		{ID: 2, LineStart: 1, LineEnd: 2, Version: 3},
+		{ID: 3, LineStart: 1, LineEnd: 2, Version: 1},
+		{ID: 4, LineStart: 1, LineEnd: 1, Version: 2},
+		{ID: 5},
+	}
+
+	err := app.anchorComments(snippet, comments)
+	assert.NilError(t, err)
+
+	// Moved down a line to follow the code it's about.
+	assert.Equal(t, comments[0].LineStart, 2)
+	assert.Equal(t, comments[0].LineEnd, 2)
+	assert.Equal(t, comments[0].Outdated, false)
+
+	// Already about the current version.
+	assert.Equal(t, comments[1].LineStart, 1)
+	assert.Equal(t, comments[1].LineEnd, 2)
+	assert.Equal(t, comments[1].Outdated, false)
+
+	// The second line didn't exist in the first version.
+	assert.Equal(t, comments[2].LineStart, 1)
+	assert.Equal(t, comments[2].LineEnd, 2)
+	assert.Equal(t, comments[2].Outdated, true)
+
+	// The version can't be found.
+	assert.Equal(t, comments[3].Outdated, true)
+
+	// Not about any lines.
+	assert.Equal(t, comments[4].Outdated, false)
+}
+
+func TestLineCount(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{name: "Single line", s: "one", want: 1},
+		{name: "Trailing newline", s: "one\ntwo\n", want: 2},
+		{name: "No trailing newline", s: "one\ntwo", want: 2},
+		{name: "Windows line endings", s: "one\r\ntwo\r\n", want: 2},
+		{name: "Blank lines", s: "one\n\n\n", want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, lineCount(tt.s), tt.want)
+		})
+	}
+}
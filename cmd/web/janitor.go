@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+// A janitor removes old snippets from the database in the background. Expired
+// snippets are hidden by the queries as soon as they expire, but without the
+// janitor their rows would stay in the snippets table forever. They're kept
+// for the expired retention period first, so that their authors can still
+// see them on the "My snippets" page for a while. The janitor also purges
+// snippets which have been in the trash for longer than the trash retention
+// period, and hourly view counts which are too old to affect the trending
+// snippets.
+type janitor struct {
+	snippets models.SnippetModelInterface
+	views    models.ViewModelInterface
+	logger   *slog.Logger
+	// interval is how long the janitor waits between sweeps.
+	interval time.Duration
+	// batchSize is the most expired snippets deleted by a single statement.
+	batchSize        int
+	trashRetention   time.Duration
+	expiredRetention time.Duration
+	// now returns the current time. It can be replaced in tests.
+	now func() time.Time
+}
+
+// newJanitor returns a janitor for the application's snippets.
+func (app *application) newJanitor(interval time.Duration, batchSize int) *janitor {
+	return &janitor{
+		snippets:         app.snippets,
+		views:            app.views,
+		logger:           app.logger,
+		interval:         interval,
+		batchSize:        batchSize,
+		trashRetention:   app.trashRetention,
+		expiredRetention: app.expiredRetention,
+		now:              time.Now,
+	}
+}
+
+// run sweeps once straight away, and then once every interval, until the
+// context is cancelled. It's intended to be run in its own goroutine.
+func (j *janitor) run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.sweep(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			j.logger.Info("janitor stopped")
+			return
+		}
+	}
+}
+
+// sweep purges the trash and the old view counts, and then deletes snippets
+// which expired longer ago than the expired retention period, a batch at a
+// time until there are none left. It stops early if the context is
+// cancelled, leaving the rest for the next sweep. Errors are logged rather
+// than returned, because there's nobody to return them to.
+func (j *janitor) sweep(ctx context.Context) {
+	n, err := j.snippets.Purge(j.trashRetention)
+	if err != nil {
+		j.logger.Error(err.Error())
+	} else if n > 0 {
+		j.logger.Info("purged snippets from trash", "count", n)
+	}
+
+	n, err = j.views.DeleteBefore(j.now().Add(-models.ViewRetention))
+	if err != nil {
+		j.logger.Error(err.Error())
+	} else if n > 0 {
+		j.logger.Info("deleted old view counts", "count", n)
+	}
+
+	start := j.now()
+	before := start.Add(-j.expiredRetention)
+	deleted, batches := 0, 0
+
+	for ctx.Err() == nil {
+		n, err := j.snippets.DeleteExpired(before, j.batchSize)
+		if err != nil {
+			j.logger.Error(err.Error())
+			break
+		}
+
+		deleted += n
+		batches++
+
+		// A short batch means that there are no expired snippets left.
+		if n < j.batchSize {
+			break
+		}
+	}
+
+	if deleted > 0 {
+		j.logger.Info("deleted expired snippets", "count", deleted, "batches", batches, "duration", j.now().Sub(start))
+	}
+}
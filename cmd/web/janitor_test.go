@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+	"github.com/AguilaMike/snippetbox/internal/models/mocks"
+)
+
+// expiringSnippets wraps the mock snippet model so that DeleteExpired()
+// works through a number of expired snippets, recording how it was called.
+type expiringSnippets struct {
+	mocks.SnippetModel
+	expired int
+	err     error
+	cutoffs []time.Time
+	limits  []int
+	// cancel, if it's set, is called after the first batch.
+	cancel func()
+}
+
+func (m *expiringSnippets) DeleteExpired(before time.Time, limit int) (int, error) {
+	m.cutoffs = append(m.cutoffs, before)
+	m.limits = append(m.limits, limit)
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	n := min(limit, m.expired)
+	m.expired -= n
+	return n, nil
+}
+
+func TestJanitorSweep(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		expired     int
+		err         error
+		cancel      bool
+		wantBatches int
+		wantLeft    int
+	}{
+		{
+			name:        "Nothing expired",
+			expired:     0,
+			wantBatches: 1,
+		},
+		{
+			name:        "Several batches",
+			expired:     7,
+			wantBatches: 3,
+		},
+		{
+			name:        "Exact multiple of batch size",
+			expired:     6,
+			wantBatches: 3,
+		},
+		{
+			name:        "Error",
+			expired:     7,
+			err:         errors.New("database is down"),
+			wantBatches: 1,
+			wantLeft:    7,
+		},
+		{
+			name:        "Cancelled",
+			expired:     7,
+			cancel:      true,
+			wantBatches: 1,
+			wantLeft:    4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			snippets := &expiringSnippets{expired: tt.expired, err: tt.err}
+			if tt.cancel {
+				snippets.cancel = cancel
+			}
+
+			app := newTestApplication(t)
+			app.snippets = snippets
+
+			j := app.newJanitor(time.Minute, 3)
+			j.now = func() time.Time { return now }
+
+			j.sweep(ctx)
+
+			assert.Equal(t, len(snippets.cutoffs), tt.wantBatches)
+			assert.Equal(t, snippets.expired, tt.wantLeft)
+
+			// Every batch uses the time the sweep started, less the
+			// expired retention period, so that it finishes even if
+			// snippets keep expiring while it runs.
+			for i := range snippets.cutoffs {
+				assert.Equal(t, snippets.cutoffs[i], now.Add(-7*24*time.Hour))
+				assert.Equal(t, snippets.limits[i], 3)
+			}
+		})
+	}
+}
+
+func TestJanitorRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	app := newTestApplication(t)
+	snippets := &expiringSnippets{expired: 2, cancel: cancel}
+	app.snippets = snippets
+
+	// The first sweep cancels the context, so run() should return without
+	// waiting for the next one.
+	done := make(chan struct{})
+	go func() {
+		app.newJanitor(time.Hour, 10).run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("janitor didn't stop after the context was cancelled")
+	}
+
+	assert.Equal(t, snippets.expired, 0)
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"flag"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
@@ -16,6 +21,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 
 	"github.com/AguilaMike/snippetbox/internal/models"
+	"github.com/AguilaMike/snippetbox/internal/search"
 )
 
 // Define an application struct to hold the application-wide dependencies for the
@@ -26,10 +32,24 @@ type application struct {
 	logger         *slog.Logger
 	snippets       models.SnippetModelInterface // Use our new interface type.
 	users          models.UserModelInterface    // Use our new interface type.
+	revisions      models.RevisionModelInterface
+	tags           models.TagModelInterface
+	files          models.SnippetFileModelInterface
+	comments       models.CommentModelInterface
+	stars          models.StarModelInterface
+	collections    models.CollectionModelInterface
+	views          models.ViewModelInterface
+	viewCounter    *viewCounter
+	searchIndex    models.SearchIndex
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
 	debugMode      bool
+	trashRetention time.Duration
+	// expiredRetention is how long expired snippets are kept before the
+	// janitor deletes them.
+	expiredRetention time.Duration
+	unlockLimiter    *unlockLimiter
 }
 
 func main() {
@@ -43,6 +63,29 @@ func main() {
 
 	debug := flag.Bool("debug", false, "Enable debug mode")
 
+	// Define a flag for how long deleted snippets are kept in the trash before
+	// being permanently purged.
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "How long deleted snippets are kept in the trash")
+
+	// Define a flag for how long expired snippets are kept, so that their
+	// authors can still see them for a while, before the janitor deletes
+	// them.
+	expiredRetention := flag.Duration("expired-retention", 7*24*time.Hour, "How long expired snippets are kept before being deleted")
+
+	// Define flags for how often the janitor looks for expired snippets to
+	// delete, and how many it deletes at a time.
+	janitorInterval := flag.Duration("janitor-interval", 10*time.Minute, "How often expired snippets are deleted")
+	janitorBatchSize := flag.Int("janitor-batch-size", 500, "How many expired snippets are deleted at a time")
+
+	// Define flags for how often the snippet views counted in memory are
+	// added to the database, and how many snippets are written at a time.
+	viewFlushInterval := flag.Duration("view-flush-interval", time.Minute, "How often snippet views are saved")
+	viewBatchSize := flag.Int("view-batch-size", 500, "How many snippets' views are saved at a time")
+
+	// Define a flag to choose the search backend: the MySQL FULLTEXT index, or
+	// an in-memory index which doesn't need any database support.
+	searchBackend := flag.String("search-backend", "mysql", "Search backend (mysql|memory)")
+
 	// Importantly, we use the flag.Parse() function to parse the command-line flag.
 	// This reads in the command-line flag value and assigns it to the addr
 	// variable. You need to call this *before* you use the addr variable
@@ -54,6 +97,35 @@ func main() {
 	// writes to the standard out stream and uses the default settings.
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	// The janitor can't tick with an interval which isn't positive, and with
+	// a batch size of zero a sweep would never finish, so exit straight away
+	// if either flag is out of range.
+	if *janitorInterval <= 0 {
+		logger.Error("janitor-interval must be greater than zero", "janitor-interval", *janitorInterval)
+		os.Exit(1)
+	}
+	if *janitorBatchSize <= 0 {
+		logger.Error("janitor-batch-size must be greater than zero", "janitor-batch-size", *janitorBatchSize)
+		os.Exit(1)
+	}
+	// A negative retention period would delete snippets before they expire.
+	if *expiredRetention < 0 {
+		logger.Error("expired-retention can't be negative", "expired-retention", *expiredRetention)
+		os.Exit(1)
+	}
+
+	// The view counter has the same limits as the janitor: its ticker needs
+	// a positive interval, and the views can't be split into batches of zero
+	// snippets.
+	if *viewFlushInterval <= 0 {
+		logger.Error("view-flush-interval must be greater than zero", "view-flush-interval", *viewFlushInterval)
+		os.Exit(1)
+	}
+	if *viewBatchSize <= 0 {
+		logger.Error("view-batch-size must be greater than zero", "view-batch-size", *viewBatchSize)
+		os.Exit(1)
+	}
+
 	// To keep the main() function tidy I've put the code for creating a connection
 	// pool into the separate openDB() function below. We pass openDB() the DSN
 	// from the command-line flag.
@@ -76,6 +148,9 @@ func main() {
 
 	// Initialize a decoder instance...
 	formDecoder := form.NewDecoder()
+	// Limit the size of the slices that can be decoded, so that a request
+	// for a huge index like files[99999999] can't use up lots of memory.
+	formDecoder.SetMaxArraySize(100)
 
 	// Use the scs.New() function to initialize a new session manager. Then we
 	sessionManager := scs.New()
@@ -95,15 +170,77 @@ func main() {
 	// dependencies (for now, just the structured logger).
 	// And add it to the application dependencies.
 	app := &application{
-		logger:         logger,
-		snippets:       &models.SnippetModel{DB: db},
-		users:          &models.UserModel{DB: db},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
-		debugMode:      *debug,
+		logger:           logger,
+		snippets:         &models.SnippetModel{DB: db},
+		users:            &models.UserModel{DB: db},
+		revisions:        &models.RevisionModel{DB: db},
+		tags:             &models.TagModel{DB: db},
+		files:            &models.SnippetFileModel{DB: db},
+		comments:         &models.CommentModel{DB: db},
+		stars:            &models.StarModel{DB: db},
+		collections:      &models.CollectionModel{DB: db},
+		views:            &models.ViewModel{DB: db},
+		templateCache:    templateCache,
+		formDecoder:      formDecoder,
+		sessionManager:   sessionManager,
+		debugMode:        *debug,
+		trashRetention:   *trashRetention,
+		expiredRetention: *expiredRetention,
+		// Allow 20 failed attempts to unlock each password-protected snippet,
+		// and 10 from each IP address, every 15 minutes.
+		unlockLimiter: newUnlockLimiter(20, 10, 15*time.Minute),
+	}
+
+	// Views are counted in memory and saved in batches by the view counter.
+	app.viewCounter = app.newViewCounter(*viewFlushInterval, *viewBatchSize)
+
+	// Set up the search index. The in-memory index starts empty, so we fill
+	// it with the current snippets before we start serving requests.
+	switch *searchBackend {
+	case "mysql":
+		app.searchIndex = &models.FullTextIndex{Snippets: app.snippets}
+	case "memory":
+		idx := search.NewIndex()
+		err = idx.Rebuild(app.snippets)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("built search index", "snippets", idx.Len())
+		app.searchIndex = idx
+	default:
+		logger.Error("unknown search backend", "backend", *searchBackend)
+		os.Exit(1)
 	}
 
+	// Create a context which is cancelled when the application is sent an
+	// interrupt or termination signal, so that it can shut down cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start the janitor in a background goroutine, which permanently removes
+	// expired snippets and snippets that have been in the trash for longer
+	// than the retention period. The WaitGroup lets us wait for it to finish
+	// before the database connection pool is closed.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.newJanitor(*janitorInterval, *janitorBatchSize).run(ctx)
+	}()
+
+	// Start the view counter in another goroutine. It has its own context,
+	// which is only cancelled once the server has stopped handling requests,
+	// so that its final flush saves every view.
+	viewCtx, stopViews := context.WithCancel(context.Background())
+	defer stopViews()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.viewCounter.run(viewCtx)
+	}()
+
 	// Initialize a tls.Config struct to hold the non-default TLS settings we
 	// want the server to use. In this case the only thing that we're changing
 	// is the curve preferences value, so that only elliptic curves with
@@ -147,13 +284,43 @@ func main() {
 	// pass in the paths to the TLS certificate and corresponding private key as
 	// the two parameters.
 	// go run "/C/Program Files/Go/src/crypto/tls/generate_cert.go" --rsa-bits=2048 --host=localhost
+	// When a signal arrives, Shutdown() stops the server accepting new
+	// connections and waits for the requests in progress to finish. Once it's
+	// been called, ListenAndServeTLS() returns http.ErrServerClosed straight
+	// away, so we wait for Shutdown() to return as well.
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		logger.Info("shutting down server")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		shutdownErr <- srv.Shutdown(shutdownCtx)
+	}()
+
 	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
 
-	// And we also use the Error() method to log any error message returned by
-	// http.ListenAndServe() at Error severity (with no additional attributes),
-	// and then call os.Exit(1) to terminate the application with exit code 1.
-	logger.Error(err.Error())
-	os.Exit(1)
+	// And we also use the Error() method to log any other error message
+	// returned by ListenAndServeTLS() at Error severity (with no additional
+	// attributes), and then call os.Exit(1) to terminate the application with
+	// exit code 1.
+	if !errors.Is(err, http.ErrServerClosed) {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	err = <-shutdownErr
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	// Stop the view counter, and wait for it and the janitor to stop, so
+	// that neither is part way through writing to the database when the
+	// deferred db.Close() runs.
+	stopViews()
+	wg.Wait()
+	logger.Info("stopped server")
 }
 
 // The openDB() function wraps sql.Open() and returns a sql.DB connection pool
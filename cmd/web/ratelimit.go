@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// An unlockLimiter counts attempts to unlock password-protected snippets, so
+// that their passwords can't be found by trying lots of them. Attempts are
+// counted per snippet, which stops a snippet being attacked from many
+// addresses at once, and per IP address, which stops one client working
+// through many snippets. Each count lasts for a fixed window of time.
+type unlockLimiter struct {
+	mu         sync.Mutex
+	perSnippet int
+	perIP      int
+	window     time.Duration
+	snippets   map[int]*attemptCount
+	ips        map[string]*attemptCount
+	nextPrune  time.Time
+	// now returns the current time. It can be replaced in tests.
+	now func() time.Time
+}
+
+// attemptCount holds the number of attempts in the current window which
+// haven't been refunded, and the time that the window ends.
+type attemptCount struct {
+	attempts int
+	ends     time.Time
+}
+
+// A reservation records the counts that an attempt was added to by reserve,
+// so that refund gives it back to the same windows.
+type reservation struct {
+	snippet *attemptCount
+	ip      *attemptCount
+}
+
+// newUnlockLimiter returns an unlockLimiter which allows up to perSnippet
+// failed attempts for each snippet, and up to perIP failed attempts from each
+// IP address, in every window.
+func newUnlockLimiter(perSnippet int, perIP int, window time.Duration) *unlockLimiter {
+	return &unlockLimiter{
+		perSnippet: perSnippet,
+		perIP:      perIP,
+		window:     window,
+		snippets:   make(map[int]*attemptCount),
+		ips:        make(map[string]*attemptCount),
+		now:        time.Now,
+	}
+}
+
+// reserve counts an attempt to unlock a snippet from an IP address, if
+// another one is allowed. If it isn't, nothing is counted, and it also
+// returns how long it is until one is. The attempt is counted before the
+// password is checked, so that requests made at the same time can't all get
+// past the limit while the first ones are still being checked. Attempts which
+// don't turn out to be failures should be given back by passing the returned
+// reservation to refund.
+func (l *unlockLimiter) reserve(snippetID int, ip string) (reservation, bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	var wait time.Duration
+	if c := current(l.snippets, snippetID, now); c != nil && c.attempts >= l.perSnippet {
+		wait = max(wait, c.ends.Sub(now))
+	}
+	if c := current(l.ips, ip, now); c != nil && c.attempts >= l.perIP {
+		wait = max(wait, c.ends.Sub(now))
+	}
+	if wait > 0 {
+		return reservation{}, false, wait
+	}
+
+	res := reservation{
+		snippet: count(l.snippets, snippetID, now, l.window),
+		ip:      count(l.ips, ip, now, l.window),
+	}
+	res.snippet.attempts++
+	res.ip.attempts++
+
+	return res, true, 0
+}
+
+// refund gives back an attempt counted by reserve, for when the password was
+// right or wasn't checked. The attempt is only taken off the counts it was
+// added to. If their windows have since ended, the counts have been replaced
+// by new ones, so the attempt isn't taken off attempts made in a later window.
+func (l *unlockLimiter) refund(res reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, c := range []*attemptCount{res.snippet, res.ip} {
+		if c != nil && c.attempts > 0 {
+			c.attempts--
+		}
+	}
+}
+
+// prune removes the counts whose windows have ended, so that the maps don't
+// keep growing. It only does any work once per window.
+func (l *unlockLimiter) prune(now time.Time) {
+	if now.Before(l.nextPrune) {
+		return
+	}
+	l.nextPrune = now.Add(l.window)
+
+	for id, c := range l.snippets {
+		if !now.Before(c.ends) {
+			delete(l.snippets, id)
+		}
+	}
+	for ip, c := range l.ips {
+		if !now.Before(c.ends) {
+			delete(l.ips, ip)
+		}
+	}
+}
+
+// current returns the count for a key, or nil if there isn't one or its
+// window has ended.
+func current[K comparable](counts map[K]*attemptCount, key K, now time.Time) *attemptCount {
+	c, ok := counts[key]
+	if !ok || !now.Before(c.ends) {
+		return nil
+	}
+	return c
+}
+
+// count returns the count for a key, starting a new window if there isn't a
+// current one.
+func count[K comparable](counts map[K]*attemptCount, key K, now time.Time, window time.Duration) *attemptCount {
+	c := current(counts, key, now)
+	if c == nil {
+		c = &attemptCount{ends: now.Add(window)}
+		counts[key] = c
+	}
+	return c
+}
+
+// clientIP returns the IP address of the client which made a request. The
+// X-Forwarded-For header isn't used, because clients can set it to anything.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestUnlockLimiter(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	l := newUnlockLimiter(3, 2, 15*time.Minute)
+	l.now = func() time.Time { return now }
+
+	// Two attempts from one IP address use up its limit, but other IP
+	// addresses can still try.
+	_, ok, _ := l.reserve(1, "192.0.2.1")
+	assert.Equal(t, ok, true)
+	_, ok, _ = l.reserve(2, "192.0.2.1")
+	assert.Equal(t, ok, true)
+
+	_, ok, wait := l.reserve(3, "192.0.2.1")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, wait, 15*time.Minute)
+
+	// A third attempt for snippet 1, from a different IP address, uses up the
+	// limit for the snippet. Refused attempts aren't counted.
+	now = now.Add(5 * time.Minute)
+	_, ok, _ = l.reserve(1, "192.0.2.2")
+	assert.Equal(t, ok, true)
+	res, ok, _ := l.reserve(1, "192.0.2.3")
+	assert.Equal(t, ok, true)
+
+	_, ok, wait = l.reserve(1, "192.0.2.4")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, wait, 10*time.Minute)
+
+	_, ok, _ = l.reserve(2, "192.0.2.4")
+	assert.Equal(t, ok, true)
+
+	// Giving back an attempt makes room for another one.
+	l.refund(res)
+	_, ok, _ = l.reserve(1, "192.0.2.5")
+	assert.Equal(t, ok, true)
+
+	// Once the windows have ended, everything is allowed again and the old
+	// counts are pruned.
+	now = now.Add(15 * time.Minute)
+
+	_, ok, _ = l.reserve(2, "192.0.2.1")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, len(l.snippets), 1)
+	assert.Equal(t, len(l.ips), 1)
+}
+
+func TestUnlockLimiterRefundAfterWindow(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	l := newUnlockLimiter(1, 10, 15*time.Minute)
+	l.now = func() time.Time { return now }
+
+	res, ok, _ := l.reserve(1, "192.0.2.1")
+	assert.Equal(t, ok, true)
+
+	// The window ends while the password is being checked, and another
+	// attempt is counted in the new window.
+	now = now.Add(15 * time.Minute)
+	_, ok, _ = l.reserve(1, "192.0.2.2")
+	assert.Equal(t, ok, true)
+
+	// Giving back the first attempt doesn't take anything off the new
+	// window, so the limit for the snippet is still used up.
+	l.refund(res)
+	_, ok, _ = l.reserve(1, "192.0.2.3")
+	assert.Equal(t, ok, false)
+}
@@ -48,10 +48,49 @@ func (app *application) routes() http.Handler {
 	// Prefix the route patterns with the required HTTP method (for now, we will
 	// restrict all three routes to acting on GET requests).
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home)) // Restrict this route to exact matches on / only.
-	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("GET /snippets", dynamic.ThenFunc(app.snippetBrowse))
+	mux.Handle("GET /trending", dynamic.ThenFunc(app.snippetTrending))
+	mux.Handle("GET /search", dynamic.ThenFunc(app.search))
+	mux.Handle("GET /tags/suggest", dynamic.ThenFunc(app.tagSuggest))
+	mux.Handle("GET /tags/{tag}", dynamic.ThenFunc(app.tagView))
+	// Snippets are identified in URLs by their slug. Old links which use the
+	// integer ID are redirected by the handlers.
+	mux.Handle("GET /snippet/view/{slug}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("POST /snippet/view/{slug}", dynamic.ThenFunc(app.snippetViewPost))
+	mux.Handle("GET /snippet/view/{slug}/history", dynamic.ThenFunc(app.snippetHistory))
+	mux.Handle("GET /snippet/view/{slug}/diff", dynamic.ThenFunc(app.snippetDiff))
+	mux.Handle("POST /snippet/unlock/{slug}", dynamic.ThenFunc(app.snippetUnlockPost))
+	mux.Handle("GET /snippet/raw/{slug}", dynamic.ThenFunc(app.snippetRaw))
+	mux.Handle("GET /snippet/download/{slug}", dynamic.ThenFunc(app.snippetDownload))
 	mux.Handle("GET /snippet/create", protected.ThenFunc(app.snippetCreate))
 	// Create the new route, which is restricted to POST requests only.
 	mux.Handle("POST /snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	mux.Handle("GET /snippet/create/encrypted", protected.ThenFunc(app.snippetCreateEncrypted))
+	mux.Handle("POST /snippet/create/encrypted", protected.ThenFunc(app.snippetCreateEncryptedPost))
+	mux.Handle("POST /snippet/fork/{slug}", protected.ThenFunc(app.snippetForkPost))
+	mux.Handle("POST /snippet/comment/{slug}", protected.ThenFunc(app.snippetCommentPost))
+	mux.Handle("POST /snippet/star/{slug}", protected.ThenFunc(app.snippetStarPost))
+	mux.Handle("POST /snippet/unstar/{slug}", protected.ThenFunc(app.snippetUnstarPost))
+	mux.Handle("POST /snippet/collect/{slug}", protected.ThenFunc(app.snippetCollectPost))
+	mux.Handle("GET /snippet/edit/{slug}", protected.ThenFunc(app.snippetEdit))
+	mux.Handle("POST /snippet/edit/{slug}", protected.ThenFunc(app.snippetEditPost))
+	mux.Handle("POST /snippet/delete/{slug}", protected.ThenFunc(app.snippetDeletePost))
+	mux.Handle("GET /comment/edit/{id}", protected.ThenFunc(app.commentEdit))
+	mux.Handle("POST /comment/edit/{id}", protected.ThenFunc(app.commentEditPost))
+	mux.Handle("POST /comment/delete/{id}", protected.ThenFunc(app.commentDeletePost))
+	// Collections are shared using their slug, in the same way as snippets.
+	mux.Handle("GET /collections", dynamic.ThenFunc(app.collectionList))
+	mux.Handle("GET /collections/{slug}", dynamic.ThenFunc(app.collectionView))
+	mux.Handle("GET /collection/create", protected.ThenFunc(app.collectionCreate))
+	mux.Handle("POST /collection/create", protected.ThenFunc(app.collectionCreatePost))
+	mux.Handle("GET /collection/edit/{slug}", protected.ThenFunc(app.collectionEdit))
+	mux.Handle("POST /collection/edit/{slug}", protected.ThenFunc(app.collectionEditPost))
+	mux.Handle("POST /collection/delete/{slug}", protected.ThenFunc(app.collectionDeletePost))
+	mux.Handle("POST /collection/order/{slug}", protected.ThenFunc(app.collectionOrderPost))
+	mux.Handle("POST /collection/remove/{slug}", protected.ThenFunc(app.collectionRemovePost))
+	// Restoring is only done from the owner's trash page, so it can keep
+	// using the ID.
+	mux.Handle("POST /snippet/restore/{id}", protected.ThenFunc(app.snippetRestorePost))
 
 	// Add the five new routes, all of which use our 'dynamic' middleware chain.
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
@@ -62,6 +101,10 @@ func (app *application) routes() http.Handler {
 
 	mux.Handle("GET /about", dynamic.ThenFunc(app.about))
 	mux.Handle("GET /account/view", protected.ThenFunc(app.accountView))
+	mux.Handle("GET /account/snippets", protected.ThenFunc(app.accountSnippets))
+	mux.Handle("GET /account/trash", protected.ThenFunc(app.accountTrash))
+	mux.Handle("GET /account/starred", protected.ThenFunc(app.accountStarred))
+	mux.Handle("GET /account/collections", protected.ThenFunc(app.accountCollections))
 	mux.Handle("GET /account/password/update", protected.ThenFunc(app.accountPasswordUpdate))
 	mux.Handle("POST /account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
 
@@ -3,9 +3,17 @@ package main
 import (
 	"html/template"
 	"io/fs"
+	"net/url"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/AguilaMike/snippetbox/internal/diff"
+	"github.com/AguilaMike/snippetbox/internal/highlight"
+	"github.com/AguilaMike/snippetbox/internal/markdown"
 	"github.com/AguilaMike/snippetbox/internal/models"
 	"github.com/AguilaMike/snippetbox/ui"
 )
@@ -19,11 +27,91 @@ type templateData struct {
 	CurrentYear     int
 	Snippet         models.Snippet
 	Snippets        []models.Snippet
+	Revisions       []models.Revision
+	Diff            revisionDiff
+	Pagination      pagination
+	TagCloud        []tagWeight
 	Form            any
 	Flash           string // Add a Flash field to the templateData struct.
 	IsAuthenticated bool   // Add an IsAuthenticated field to the templateData struct.
 	CSRFToken       string // Add a CSRFToken field.
-	Data            any
+	// The ID of the authenticated user, or 0 if there isn't one. Templates use
+	// this to decide whether to show owner-only actions.
+	AuthenticatedUserID int
+	Data                any
+	// Forks holds the listed forks of the snippet being viewed, and
+	// ForkSource the snippet it was forked from, if the viewer can follow a
+	// link to it.
+	Forks      []models.Snippet
+	ForkSource *models.Snippet
+	// Comments holds the comments on the snippet being viewed, and
+	// CommentsOpen is true if more can be posted.
+	Comments     []models.Comment
+	CommentsOpen bool
+	// Starred is true if the authenticated user has starred the snippet
+	// being viewed.
+	Starred bool
+	// Collection holds the collection being viewed or edited, and
+	// Collections a list of collections.
+	Collection  models.Collection
+	Collections []models.Collection
+}
+
+// Define a revisionDiff type to hold the two versions of a snippet being
+// compared on the diff page, along with the changes between them.
+type revisionDiff struct {
+	From  models.Revision
+	To    models.Revision
+	Hunks []diff.Hunk
+}
+
+// Define a commentItem type to hold a comment along with the data for the
+// page it's shown on, so that the comment partial can be used for top-level
+// comments and replies alike.
+type commentItem struct {
+	models.Comment
+	Page templateData
+}
+
+// Define a pagination type to hold the links to the previous and next pages
+// of a listing. A link is the empty string if there's no page in that
+// direction.
+type pagination struct {
+	PrevURL string
+	NextURL string
+}
+
+// Define a tagWeight type to hold a tag in the tag cloud, along with a weight
+// from 1 to 5 which the stylesheet uses to size it.
+type tagWeight struct {
+	Name   string
+	Weight int
+}
+
+// newTagCloud works out the weights for a tag cloud. The weights are spread
+// linearly between the least and most used tags, so that a cloud where every
+// tag is used equally often shows them all at the smallest size.
+func newTagCloud(tags []models.TagCount) []tagWeight {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	least, most := tags[0].Count, tags[0].Count
+	for _, tag := range tags[1:] {
+		least = min(least, tag.Count)
+		most = max(most, tag.Count)
+	}
+
+	cloud := make([]tagWeight, len(tags))
+	for i, tag := range tags {
+		weight := 1
+		if most > least {
+			weight = 1 + (tag.Count-least)*4/(most-least)
+		}
+		cloud[i] = tagWeight{Name: tag.Name, Weight: weight}
+	}
+
+	return cloud
 }
 
 // Create a humanDate function which returns a nicely formatted string
@@ -38,11 +126,180 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// Create a humanExpiry function which works like humanDate for the expiry
+// time of a snippet, but shows "Never" for snippets which never expire.
+func humanExpiry(s models.Snippet) string {
+	if s.NeverExpires() {
+		return "Never"
+	}
+	return humanDate(s.Expires)
+}
+
+// Create an addDuration function which returns the time t+d. This is used to
+// show when a snippet in the trash will be purged.
+func addDuration(t time.Time, d time.Duration) time.Time {
+	return t.Add(d)
+}
+
+// Create a newCommentItem function which returns the data for the comment
+// partials. The comment can be left out for the form which posts a new
+// top-level comment.
+func newCommentItem(page templateData, comment ...models.Comment) commentItem {
+	item := commentItem{Page: page}
+	if len(comment) > 0 {
+		item.Comment = comment[0]
+	}
+	return item
+}
+
+// Create a recentComment function which returns true if a comment was posted
+// recently enough that its author can still edit or delete it.
+func recentComment(c models.Comment) bool {
+	return time.Since(c.Created) < commentEditWindow
+}
+
+// termsRX returns a case-insensitive regular expression which matches any of
+// the provided search terms as whole words, or nil if there are no terms.
+// Spaces in a phrase match any run of whitespace.
+func termsRX(terms []string) *regexp.Regexp {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	// Try longer terms first, so that a phrase wins over the words in it.
+	sorted := slices.Clone(terms)
+	slices.SortFunc(sorted, func(a, b string) int { return len(b) - len(a) })
+
+	alternatives := make([]string, len(sorted))
+	for i, t := range sorted {
+		alternatives[i] = strings.Join(strings.Fields(regexp.QuoteMeta(t)), `\s+`)
+	}
+
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(alternatives, "|") + `)\b`)
+}
+
+// Create a highlightTerms function which HTML-escapes the text and wraps every
+// occurrence of the search terms in a <mark> element. The result is marked as
+// safe HTML so that the template doesn't escape the <mark> tags again.
+func highlightTerms(text string, terms []string) template.HTML {
+	rx := termsRX(terms)
+	if rx == nil {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	var b strings.Builder
+	last := 0
+
+	for _, m := range rx.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:m[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[m[0]:m[1]]))
+		b.WriteString("</mark>")
+		last = m[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
+}
+
+// Create an excerpt function which returns up to n characters of the text,
+// centred on the first occurrence of any of the search terms. An ellipsis
+// marks any text which has been cut off.
+func excerpt(text string, terms []string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	start := 0
+	if rx := termsRX(terms); rx != nil {
+		if m := rx.FindStringIndex(text); m != nil {
+			start = max(0, utf8.RuneCountInString(text[:m[0]])-n/2)
+		}
+	}
+	start = min(start, len(runes)-n)
+
+	s := string(runes[start : start+n])
+	if start > 0 {
+		s = "…" + s
+	}
+	if start+n < len(runes) {
+		s += "…"
+	}
+
+	return s
+}
+
+// codeLine is a single line of a snippet's content, ready to be shown.
+type codeLine struct {
+	Number int
+	HTML   template.HTML
+}
+
+// Create a codeLines function which returns the content of a code or plain
+// text snippet as HTML, one line at a time, so that each line can be given its
+// own anchor. Code is syntax highlighted, and if the author didn't choose a
+// language, we try to detect it from the content.
+func codeLines(s models.Snippet) []codeLine {
+	name := highlight.Text
+	if s.Format == models.FormatCode {
+		name = highlight.Resolve(s.Language, s.Content)
+	}
+
+	var lines []codeLine
+	for i, line := range highlight.Lines(s.Content, name) {
+		lines = append(lines, codeLine{Number: i + 1, HTML: line})
+	}
+
+	return lines
+}
+
+// Create a languageLabel function which returns the name of the language
+// that a snippet is highlighted as, for showing alongside it.
+func languageLabel(s models.Snippet) string {
+	lang := highlight.Lookup(highlight.Resolve(s.Language, s.Content))
+	if lang == nil {
+		return ""
+	}
+	return lang.Label
+}
+
+// Create a highlightFile function which does the same for one of the extra
+// files in a multi-file snippet. The language comes from the file name's
+// extension, falling back to detecting it from the content.
+func highlightFile(f models.SnippetFile) template.HTML {
+	return highlight.HTML(f.Content, highlight.Resolve(highlight.ForFilename(f.Name), f.Content))
+}
+
+// Create a fileLanguageLabel function which returns the name of the language
+// that an extra file is highlighted as.
+func fileLanguageLabel(f models.SnippetFile) string {
+	lang := highlight.Lookup(highlight.Resolve(highlight.ForFilename(f.Name), f.Content))
+	if lang == nil {
+		return ""
+	}
+	return lang.Label
+}
+
 // Initialize a template.FuncMap object and store it in a global variable. This is
 // essentially a string-keyed map which acts as a lookup between the names of our
 // custom template functions and the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":      humanDate,
+	"addDuration":    addDuration,
+	"highlightTerms": highlightTerms,
+	"codeLines":      codeLines,
+	"languageLabel":  languageLabel,
+	"highlightFile":  highlightFile,
+	"fileLanguage":   fileLanguageLabel,
+	"languages":      highlight.Languages,
+	"markdown":       markdown.HTML,
+	"markdownLite":   markdown.Lite,
+	"excerpt":        excerpt,
+	"humanExpiry":    humanExpiry,
+	"expiryUnits":    func() []expiryUnit { return expiryUnits },
+	"commentItem":    newCommentItem,
+	"recentComment":  recentComment,
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -87,3 +344,24 @@ func newTemplateCache() (map[string]*template.Template, error) {
 	// Return the map.
 	return cache, nil
 }
+
+// newPagination builds the previous and next page links for a listing. The
+// links keep all of the current query string parameters (such as the sort
+// order) and only replace the one named by param, which is set to prev or
+// next respectively.
+func newPagination(u *url.URL, param string, prev, next string) pagination {
+	link := func(value string) string {
+		if value == "" {
+			return ""
+		}
+
+		qs := u.Query()
+		qs.Set(param, value)
+		return u.Path + "?" + qs.Encode()
+	}
+
+	return pagination{
+		PrevURL: link(prev),
+		NextURL: link(next),
+	}
+}
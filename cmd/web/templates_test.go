@@ -1,10 +1,12 @@
 package main
 
 import (
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/AguilaMike/snippetbox/internal/assert"
+	"github.com/AguilaMike/snippetbox/internal/models"
 )
 
 func TestHumanDate(t *testing.T) {
@@ -48,3 +50,96 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestNewPagination(t *testing.T) {
+	u, err := url.Parse("/snippets?sort=title&cursor=old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newPagination(u, "cursor", "", "abc")
+
+	assert.Equal(t, p.PrevURL, "")
+	assert.Equal(t, p.NextURL, "/snippets?cursor=abc&sort=title")
+}
+
+func TestHighlightTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{
+			name:  "No terms",
+			text:  "<b>pond</b>",
+			terms: nil,
+			want:  "&lt;b&gt;pond&lt;/b&gt;",
+		},
+		{
+			name:  "Case-insensitive",
+			text:  "Pond, pond & ponds",
+			terms: []string{"pond"},
+			want:  "<mark>Pond</mark>, <mark>pond</mark> &amp; ponds",
+		},
+		{
+			name:  "Phrase",
+			text:  "An old silent\npond",
+			terms: []string{"silent pond", "old"},
+			want:  "An <mark>old</mark> <mark>silent\npond</mark>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(highlightTerms(tt.text, tt.terms)), tt.want)
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	text := "0123456789 frog 0123456789"
+
+	assert.Equal(t, excerpt(text, []string{"frog"}, 100), text)
+	assert.Equal(t, excerpt(text, []string{"frog"}, 8), "…789 frog…")
+	assert.Equal(t, excerpt(text, nil, 8), "01234567…")
+	assert.Equal(t, excerpt(text, []string{"0123456789"}, 8), "01234567…")
+}
+
+func TestNewTagCloud(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []models.TagCount
+		want []int
+	}{
+		{
+			name: "Empty",
+			tags: nil,
+			want: nil,
+		},
+		{
+			name: "Equal counts",
+			tags: []models.TagCount{{Name: "go", Count: 2}, {Name: "sql", Count: 2}},
+			want: []int{1, 1},
+		},
+		{
+			name: "Spread",
+			tags: []models.TagCount{{Name: "a", Count: 1}, {Name: "b", Count: 5}, {Name: "c", Count: 9}},
+			want: []int{1, 3, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var weights []int
+			for _, tag := range newTagCloud(tt.tags) {
+				weights = append(weights, tag.Weight)
+			}
+
+			assert.Equal(t, len(weights), len(tt.want))
+			for i := range tt.want {
+				assert.Equal(t, weights[i], tt.want[i])
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/go-playground/form/v4"
 
 	"github.com/AguilaMike/snippetbox/internal/models/mocks"
+	"github.com/AguilaMike/snippetbox/internal/search"
 )
 
 // Define a regular expression which captures the CSRF token value from the
@@ -47,6 +48,7 @@ func newTestApplication(t *testing.T) *application {
 
 	// And a form decoder.
 	formDecoder := form.NewDecoder()
+	formDecoder.SetMaxArraySize(100)
 
 	// And a session manager instance. Note that we use the same settings as
 	// production, except that we *don't* set a Store for the session manager.
@@ -56,14 +58,39 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
-	return &application{
-		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
-		snippets:       &mocks.SnippetModel{}, // Use the mock.
-		users:          &mocks.UserModel{},    // Use the mock.
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+	// Build an in-memory search index from the mock snippets, so that the
+	// search pages work without MySQL.
+	snippets := &mocks.SnippetModel{}
+
+	searchIndex := search.NewIndex()
+	err = searchIndex.Rebuild(snippets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		snippets:         snippets,           // Use the mock.
+		users:            &mocks.UserModel{}, // Use the mock.
+		revisions:        &mocks.RevisionModel{},
+		tags:             &mocks.TagModel{},
+		files:            &mocks.SnippetFileModel{},
+		comments:         &mocks.CommentModel{},
+		stars:            &mocks.StarModel{},
+		collections:      &mocks.CollectionModel{},
+		views:            &mocks.ViewModel{},
+		searchIndex:      searchIndex,
+		templateCache:    templateCache,
+		formDecoder:      formDecoder,
+		sessionManager:   sessionManager,
+		trashRetention:   30 * 24 * time.Hour,
+		expiredRetention: 7 * 24 * time.Hour,
+		unlockLimiter:    newUnlockLimiter(20, 10, 15*time.Minute),
 	}
+
+	app.viewCounter = app.newViewCounter(time.Minute, 100)
+
+	return app
 }
 
 // Define a custom testServer type which embeds a httptest.Server instance.
@@ -118,6 +145,30 @@ func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, strin
 	return rs.StatusCode, rs.Header, string(body)
 }
 
+// Create a getWithHeaders method for sending GET requests with extra request
+// headers, such as the ones used for conditional requests.
+func (ts *testServer) getWithHeaders(t *testing.T, urlPath string, headers http.Header) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = headers
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
 // Create a postForm method for sending POST requests to the test server. The
 // final parameter to this method is a url.Values object which can contain any
 // form data that you want to send in the request body.
@@ -138,3 +189,29 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers and body.
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Create a login method which logs in as Alice, who owns the snippets in the
+// mock snippet model, so that subsequent requests made by the test server
+// client are authenticated.
+func (ts *testServer) login(t *testing.T) {
+	ts.loginAs(t, "alice@example.com")
+}
+
+// The loginAs method logs in as one of the users known to the mock user
+// model, all of which have the password "pa$$word".
+func (ts *testServer) loginAs(t *testing.T, email string) {
+	// Make a GET /user/login request and extract the CSRF token from the
+	// response.
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", csrfToken)
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+// A view of a snippet is only counted once for each viewer within
+// viewWindow. At most maxRecentViews counted views are remembered, and the
+// oldest are forgotten first, so that a crawler visiting every snippet can't
+// use up an unbounded amount of memory.
+const (
+	viewWindow     = 12 * time.Hour
+	maxRecentViews = 100_000
+)
+
+// A viewCounter counts snippet views in memory, and adds them to the database
+// in the background a batch at a time, so that viewing a snippet doesn't need
+// a database write of its own. Views which haven't been flushed yet are lost
+// if the application crashes, but run() flushes them when it's stopped.
+type viewCounter struct {
+	views  models.ViewModelInterface
+	logger *slog.Logger
+	// interval is how long the counter waits between flushes.
+	interval time.Duration
+	// batchSize is the most snippets whose views are written by a single
+	// call to the model.
+	batchSize int
+	// now returns the current time. It can be replaced in tests.
+	now func() time.Time
+
+	// window and maxRecent are how long, and how many, counted views are
+	// remembered for. They're viewWindow and maxRecentViews, except in tests.
+	window    time.Duration
+	maxRecent int
+
+	// mu protects pending, which maps the ID of each snippet viewed since the
+	// last flush to its number of views, and the record of the recently
+	// counted views. The recent views are kept in the order they were
+	// counted, which is also the order they're forgotten in, and recent maps
+	// each of them to the time it was counted.
+	mu      sync.Mutex
+	pending map[int]int
+	order   []recentView
+	recent  map[viewKey]time.Time
+}
+
+// A viewKey identifies a viewer's views of a snippet.
+type viewKey struct {
+	viewer    string
+	snippetID int
+}
+
+// A recentView records when a viewer's view of a snippet was counted.
+type recentView struct {
+	key viewKey
+	at  time.Time
+}
+
+// newViewCounter returns a viewCounter for the application's snippets.
+func (app *application) newViewCounter(interval time.Duration, batchSize int) *viewCounter {
+	return &viewCounter{
+		views:     app.views,
+		logger:    app.logger,
+		interval:  interval,
+		batchSize: batchSize,
+		now:       time.Now,
+		window:    viewWindow,
+		maxRecent: maxRecentViews,
+		pending:   map[int]int{},
+		recent:    map[viewKey]time.Time{},
+	}
+}
+
+// addOnce counts a view of the snippet with the given ID by a viewer, unless
+// their view of it has already been counted within the window. It returns
+// true if the view was counted.
+func (c *viewCounter) addOnce(viewer string, snippetID int) bool {
+	now := c.now()
+	key := viewKey{viewer: viewer, snippetID: snippetID}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.forget(now)
+
+	if _, ok := c.recent[key]; ok {
+		return false
+	}
+
+	c.recent[key] = now
+	c.order = append(c.order, recentView{key: key, at: now})
+	c.pending[snippetID]++
+	return true
+}
+
+// forget drops the recent views which were counted longer ago than the
+// window, and then the oldest of the rest if there are more than maxRecent.
+// Every view is counted with the same window, so the oldest views are always
+// at the front of the order. It must be called with the mutex held.
+func (c *viewCounter) forget(now time.Time) {
+	for len(c.order) > 0 && (now.Sub(c.order[0].at) >= c.window || len(c.order) >= c.maxRecent) {
+		delete(c.recent, c.order[0].key)
+		c.order = c.order[1:]
+	}
+}
+
+// unflushed returns the number of views of a snippet which haven't been
+// added to the database yet.
+func (c *viewCounter) unflushed(snippetID int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pending[snippetID]
+}
+
+// run flushes the pending views once every interval until the context is
+// cancelled, and then flushes them one last time. It's intended to be run in
+// its own goroutine, and stopped once the server has finished handling
+// requests, so that no views are counted after the last flush.
+func (c *viewCounter) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-ctx.Done():
+			c.flush()
+			c.logger.Info("view counter stopped")
+			return
+		}
+	}
+}
+
+// flush adds the pending views to the database, a batch at a time. If a
+// batch can't be written, its views are put back to be tried again at the
+// next flush. Errors are logged rather than returned, because there's nobody
+// to return them to.
+func (c *viewCounter) flush() {
+	// Swapping in a new map means that views can keep being counted while
+	// the batches are written.
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = map[int]int{}
+	c.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	at := c.now()
+	total := 0
+
+	for batch := range slices.Chunk(slices.Sorted(maps.Keys(pending)), c.batchSize) {
+		views := make(map[int]int, len(batch))
+		for _, id := range batch {
+			views[id] = pending[id]
+		}
+
+		err := c.views.Record(views, at)
+		if err != nil {
+			c.logger.Error(err.Error())
+			c.restore(views)
+			continue
+		}
+
+		for _, n := range views {
+			total += n
+		}
+	}
+
+	if total > 0 {
+		c.logger.Info("recorded snippet views", "views", total, "duration", c.now().Sub(at))
+	}
+}
+
+// restore adds views which couldn't be written back to the pending views.
+func (c *viewCounter) restore(views map[int]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, n := range views {
+		c.pending[id] += n
+	}
+}
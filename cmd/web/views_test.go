@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+	"github.com/AguilaMike/snippetbox/internal/models/mocks"
+)
+
+// recordingViews wraps the mock view model so that Record() keeps the batches
+// it's given, or fails with err if it's set.
+type recordingViews struct {
+	mocks.ViewModel
+	err     error
+	batches []map[int]int
+	times   []time.Time
+}
+
+func (m *recordingViews) Record(views map[int]int, at time.Time) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.batches = append(m.batches, views)
+	m.times = append(m.times, at)
+	return nil
+}
+
+func TestViewCounterFlush(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	views := &recordingViews{}
+	app := newTestApplication(t)
+	app.views = views
+
+	c := app.newViewCounter(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	for i, id := range []int{1, 5, 1, 9, 1} {
+		c.addOnce(fmt.Sprintf("viewer%d", i), id)
+	}
+	assert.Equal(t, c.unflushed(1), 3)
+
+	c.flush()
+
+	// The views are written two snippets at a time, in order of ID.
+	assert.Equal(t, len(views.batches), 2)
+	assert.Equal(t, len(views.batches[0]), 2)
+	assert.Equal(t, views.batches[0][1], 3)
+	assert.Equal(t, views.batches[0][5], 1)
+	assert.Equal(t, len(views.batches[1]), 1)
+	assert.Equal(t, views.batches[1][9], 1)
+	for _, at := range views.times {
+		assert.Equal(t, at, now)
+	}
+	assert.Equal(t, c.unflushed(1), 0)
+
+	// Flushing with nothing pending doesn't write anything.
+	c.flush()
+	assert.Equal(t, len(views.batches), 2)
+}
+
+func TestViewCounterFlushError(t *testing.T) {
+	views := &recordingViews{err: errors.New("database is down")}
+	app := newTestApplication(t)
+	app.views = views
+
+	c := app.newViewCounter(time.Minute, 10)
+	c.addOnce("alice", 1)
+	c.addOnce("bob", 1)
+
+	c.flush()
+
+	// The views which couldn't be written are kept for the next flush.
+	assert.Equal(t, c.unflushed(1), 2)
+
+	views.err = nil
+	c.addOnce("carol", 1)
+	c.flush()
+
+	assert.Equal(t, len(views.batches), 1)
+	assert.Equal(t, views.batches[0][1], 3)
+}
+
+func TestViewCounterRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	views := &recordingViews{}
+	app := newTestApplication(t)
+	app.views = views
+
+	c := app.newViewCounter(time.Hour, 10)
+	c.addOnce("alice", 1)
+
+	done := make(chan struct{})
+	go func() {
+		c.run(ctx)
+		close(done)
+	}()
+
+	// Stopping the counter flushes the pending views straight away, rather
+	// than waiting for the next interval.
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("view counter didn't stop after the context was cancelled")
+	}
+
+	assert.Equal(t, len(views.batches), 1)
+	assert.Equal(t, views.batches[0][1], 1)
+}
+
+func TestViewCounterAddOnce(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	app := newTestApplication(t)
+	c := app.newViewCounter(time.Minute, 10)
+	c.now = func() time.Time { return now }
+	c.window = time.Hour
+	c.maxRecent = 3
+
+	// Each viewer's view of a snippet is only counted once.
+	assert.Equal(t, c.addOnce("alice", 1), true)
+	assert.Equal(t, c.addOnce("alice", 1), false)
+	assert.Equal(t, c.addOnce("bob", 1), true)
+	assert.Equal(t, c.addOnce("alice", 2), true)
+	assert.Equal(t, c.unflushed(1), 2)
+	assert.Equal(t, c.unflushed(2), 1)
+
+	// Once the window has passed, it's counted again.
+	now = now.Add(time.Hour)
+	assert.Equal(t, c.addOnce("alice", 1), true)
+	assert.Equal(t, c.unflushed(1), 3)
+	assert.Equal(t, len(c.recent), 1)
+
+	// When too many views are remembered, the oldest are forgotten first.
+	now = now.Add(time.Minute)
+	for _, viewer := range []string{"carol", "dave", "erin"} {
+		assert.Equal(t, c.addOnce(viewer, 1), true)
+	}
+	assert.Equal(t, len(c.recent), 3)
+	assert.Equal(t, c.addOnce("alice", 1), true)
+	assert.Equal(t, c.addOnce("erin", 1), false)
+}
@@ -0,0 +1,291 @@
+// Package diff computes line-based differences between two texts and formats
+// them as unified diffs.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op describes what happened to a line when going from the old text to the
+// new text.
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// String() returns a short lowercase name for the operation, which is handy
+// for use as a CSS class name.
+func (op Op) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	default:
+		return "equal"
+	}
+}
+
+// Prefix() returns the character which marks the operation in a unified diff.
+func (op Op) Prefix() string {
+	switch op {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// Line is a single line in an edit script. OldLine and NewLine hold the
+// 1-based line numbers of the line in the old and new texts respectively, or
+// 0 if the line doesn't appear in that text.
+type Line struct {
+	Op      Op
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// Hunk is a group of changed lines along with some surrounding context.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Header() returns the "@@ -l,s +l,s @@" range header for the hunk.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Lines() returns the shortest edit script which turns the old text into the
+// new text, one entry per line.
+func Lines(old, new string) []Line {
+	return myers(split(old), split(new))
+}
+
+// LineMap() returns a map from the line numbers of the old text to the line
+// numbers of the same lines in the new text. Lines which were deleted or
+// changed aren't in the map.
+func LineMap(old, new string) map[int]int {
+	lines := map[int]int{}
+	for _, l := range Lines(old, new) {
+		if l.Op == Equal {
+			lines[l.OldLine] = l.NewLine
+		}
+	}
+
+	return lines
+}
+
+// Hunks() returns the changes between the old and new texts grouped into
+// hunks, each with up to context unchanged lines either side. Changes which
+// are close enough for their context to overlap are merged into one hunk.
+// If the texts are identical the result is empty.
+func Hunks(old, new string, context int) []Hunk {
+	return group(Lines(old, new), context)
+}
+
+// Unified() returns a unified diff of the two texts, using the provided names
+// in the "---" and "+++" file headers. It returns the empty string if the
+// texts are identical.
+func Unified(oldName, newName, old, new string, context int) string {
+	hunks := Hunks(old, new, context)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	for _, h := range hunks {
+		b.WriteString(h.Header())
+		b.WriteByte('\n')
+		for _, l := range h.Lines {
+			b.WriteString(l.Op.Prefix())
+			b.WriteString(l.Text)
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String()
+}
+
+// split breaks a text into lines, normalizing Windows line endings. A trailing
+// newline doesn't produce an extra empty line.
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// myers implements the greedy O((N+M)D) algorithm from Eugene Myers' paper "An
+// O(ND) Difference Algorithm and Its Variations", keeping a copy of the
+// frontier for each edit distance so that the path can be recovered.
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk backwards through the trace to recover the edit script.
+	var script []Line
+	x, y := n, m
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			script = append(script, Line{Op: Equal, Text: a[x-1], OldLine: x, NewLine: y})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				script = append(script, Line{Op: Insert, Text: b[y-1], NewLine: y})
+			} else {
+				script = append(script, Line{Op: Delete, Text: a[x-1], OldLine: x})
+			}
+			x, y = prevX, prevY
+		}
+	}
+
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+
+	return script
+}
+
+// group splits an edit script into hunks.
+func group(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	// Keep track of how many lines of the old and new texts come before the
+	// current position, so that each hunk knows where it starts.
+	oldBefore, newBefore := 0, 0
+	pos := 0
+
+	advance := func(to int) {
+		for ; pos < to; pos++ {
+			if lines[pos].Op != Insert {
+				oldBefore++
+			}
+			if lines[pos].Op != Delete {
+				newBefore++
+			}
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// Extend the hunk over any further changes which are separated from
+		// this one by no more than 2*context unchanged lines.
+		end := i
+		for j := i; j < len(lines); {
+			if lines[j].Op != Equal {
+				j++
+				end = j
+				continue
+			}
+
+			k := j
+			for k < len(lines) && lines[k].Op == Equal {
+				k++
+			}
+			if k == len(lines) || k-j > 2*context {
+				break
+			}
+			j = k
+		}
+
+		start := max(0, i-context)
+		stop := min(len(lines), end+context)
+
+		advance(start)
+		h := Hunk{Lines: lines[start:stop]}
+		for _, l := range h.Lines {
+			if l.Op != Insert {
+				h.OldLines++
+			}
+			if l.Op != Delete {
+				h.NewLines++
+			}
+		}
+
+		// By convention an empty range starts at the line before the hunk,
+		// whereas a non-empty one starts at its first line.
+		h.OldStart = oldBefore
+		if h.OldLines > 0 {
+			h.OldStart++
+		}
+		h.NewStart = newBefore
+		if h.NewLines > 0 {
+			h.NewStart++
+		}
+
+		hunks = append(hunks, h)
+		i = stop
+	}
+
+	return hunks
+}
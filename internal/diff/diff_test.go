@@ -0,0 +1,119 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestLines(t *testing.T) {
+	lines := Lines("a\nb\nc\n", "a\nc\nd\n")
+
+	want := []Line{
+		{Op: Equal, Text: "a", OldLine: 1, NewLine: 1},
+		{Op: Delete, Text: "b", OldLine: 2},
+		{Op: Equal, Text: "c", OldLine: 3, NewLine: 2},
+		{Op: Insert, Text: "d", NewLine: 3},
+	}
+
+	assert.Equal(t, len(lines), len(want))
+	for i := range want {
+		assert.Equal(t, lines[i], want[i])
+	}
+}
+
+func TestLineMap(t *testing.T) {
+	lines := LineMap("a\nb\nc\nd\n", "new\na\nc\nD\n")
+
+	assert.Equal(t, len(lines), 2)
+	assert.Equal(t, lines[1], 2)
+	assert.Equal(t, lines[3], 3)
+
+	// Changed and deleted lines aren't mapped.
+	_, ok := lines[2]
+	assert.Equal(t, ok, false)
+	_, ok = lines[4]
+	assert.Equal(t, ok, false)
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		context int
+		want    string
+	}{
+		{
+			name:    "Identical",
+			old:     "a\nb\n",
+			new:     "a\nb\n",
+			context: 3,
+			want:    "",
+		},
+		{
+			name:    "Both empty",
+			old:     "",
+			new:     "",
+			context: 3,
+			want:    "",
+		},
+		{
+			name:    "Added to empty",
+			old:     "",
+			new:     "a\nb",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "Removed everything",
+			old:     "a\nb",
+			new:     "",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:    "Changed line",
+			old:     "one\ntwo\nthree\n",
+			new:     "one\n2\nthree\n",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n",
+		},
+		{
+			name:    "CRLF line endings",
+			old:     "one\r\ntwo\r\n",
+			new:     "one\ntwo\n",
+			context: 3,
+			want:    "",
+		},
+		{
+			name:    "Separate hunks",
+			old:     "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:     "1\nTWO\n3\n4\n5\n6\n7\n8\nNINE\n10\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n 1\n-2\n+TWO\n 3\n@@ -8,3 +8,3 @@\n 8\n-9\n+NINE\n 10\n",
+		},
+		{
+			name:    "Merged hunks",
+			old:     "1\n2\n3\n4\n5\n",
+			new:     "1\nTWO\n3\nFOUR\n5\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,5 +1,5 @@\n 1\n-2\n+TWO\n 3\n-4\n+FOUR\n 5\n",
+		},
+		{
+			name:    "Insertion without context",
+			old:     "1\n2\n3\n",
+			new:     "1\n2\nnew\n3\n",
+			context: 0,
+			want:    "--- old\n+++ new\n@@ -2,0 +3,1 @@\n+new\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", tt.old, tt.new, tt.context)
+
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
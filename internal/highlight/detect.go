@@ -0,0 +1,114 @@
+package highlight
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// signal is a pattern which suggests that code is written in a particular
+// language, along with how strongly it suggests it.
+type signal struct {
+	rx     *regexp.Regexp
+	weight int
+}
+
+var signals = map[string][]signal{
+	"go": {
+		{regexp.MustCompile(`(?m)^package \w+\s*$`), 4},
+		{regexp.MustCompile(`(?m)^func (\(\w+ \*?\w+\) )?\w+\(`), 3},
+		{regexp.MustCompile(`\w+ := `), 2},
+		{regexp.MustCompile(`(?m)^import \(`), 3},
+		{regexp.MustCompile(`\bfmt\.\w+\(`), 2},
+		{regexp.MustCompile(`\berr != nil\b`), 3},
+	},
+	"python": {
+		{regexp.MustCompile(`(?m)^\s*def \w+\(.*\)( -> .+)?:\s*$`), 4},
+		{regexp.MustCompile(`(?m)^from [\w.]+ import \w+`), 3},
+		{regexp.MustCompile(`(?m)^import [\w.]+\s*$`), 1},
+		{regexp.MustCompile(`(?m)^\s*(if|elif|for|while|with|class) .+:\s*$`), 2},
+		{regexp.MustCompile(`\bself\.\w+`), 2},
+		{regexp.MustCompile(`\bprint\(`), 1},
+		{regexp.MustCompile(`\bNone\b`), 1},
+	},
+	"javascript": {
+		{regexp.MustCompile(`\bfunction\s*\w*\s*\(`), 2},
+		{regexp.MustCompile(`(?m)^\s*(const|let|var) \w+ = `), 3},
+		{regexp.MustCompile(`=>`), 2},
+		{regexp.MustCompile(`\bconsole\.log\(`), 3},
+		{regexp.MustCompile(`===|!==`), 2},
+		{regexp.MustCompile(`\bdocument\.\w+`), 2},
+		{regexp.MustCompile(`;\s*$`), 1},
+	},
+	"sql": {
+		{regexp.MustCompile(`(?is)\bselect\b.+\bfrom\b`), 4},
+		{regexp.MustCompile(`(?i)\binsert\s+into\b`), 4},
+		{regexp.MustCompile(`(?i)\bcreate\s+(table|index|database)\b`), 4},
+		{regexp.MustCompile(`(?i)\bupdate\s+\w+\s+set\b`), 4},
+		{regexp.MustCompile(`(?i)\bwhere\b`), 1},
+		{regexp.MustCompile(`(?i)\b(inner|left|right)\s+join\b`), 2},
+	},
+	"bash": {
+		{regexp.MustCompile(`^#!\s*/(usr/)?bin/(env )?(ba|z)?sh`), 6},
+		{regexp.MustCompile(`(?m)^\s*(echo|export|cd|sudo|apt(-get)?|mkdir|rm|curl|git|go|docker|kubectl) `), 2},
+		{regexp.MustCompile(`\$\{?\w+\}?`), 1},
+		{regexp.MustCompile(`(?m)^\s*if \[\[? `), 3},
+		{regexp.MustCompile(`(?m)^\s*(fi|done|esac)\s*$`), 3},
+		{regexp.MustCompile(`\| *(grep|awk|sed|xargs|sort|head|tail)\b`), 3},
+	},
+	"yaml": {
+		{regexp.MustCompile(`(?m)^---\s*$`), 2},
+		{regexp.MustCompile(`(?m)^[\w-]+:( .*)?$`), 2},
+		{regexp.MustCompile(`(?m)^\s+[\w-]+: .+$`), 1},
+		{regexp.MustCompile(`(?m)^\s*- [\w"']`), 1},
+	},
+}
+
+// minScore is the score which a language needs to reach before Detect() will
+// pick it. Code which doesn't clearly look like anything is left as plain
+// text.
+const minScore = 4
+
+// Detect guesses the language of the code and returns its name. If it can't
+// make a reasonable guess it returns Text.
+func Detect(code string) string {
+	trimmed := strings.TrimSpace(code)
+	if trimmed == "" {
+		return Text
+	}
+
+	// JSON can be recognized with certainty by parsing it. Only objects and
+	// arrays are accepted, as a lone number or string is more likely to be
+	// plain text.
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)) {
+		return "json"
+	}
+
+	best, bestScore := Text, minScore-1
+
+	// Go through the languages in the order they're offered to users, so
+	// that ties are broken consistently.
+	for _, lang := range languages {
+		score := 0
+		for _, s := range signals[lang.Name] {
+			if s.rx.MatchString(code) {
+				score += s.weight
+			}
+		}
+
+		if score > bestScore {
+			best, bestScore = lang.Name, score
+		}
+	}
+
+	return best
+}
+
+// Resolve returns the language to use for highlighting a snippet: the one
+// chosen by its author, or a guess if they left it blank.
+func Resolve(name string, code string) string {
+	if name != "" {
+		return name
+	}
+	return Detect(code)
+}
@@ -0,0 +1,302 @@
+// Package highlight provides simple syntax highlighting for source code. The
+// output marks up tokens with CSS classes rather than inline styles, so that
+// it works with a strict Content-Security-Policy.
+package highlight
+
+import (
+	"html/template"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Class identifies the kind of a token. Its value is used as the CSS class
+// name of the span wrapping the token.
+type Class string
+
+const (
+	Plain   Class = ""
+	Keyword Class = "hl-keyword"
+	Builtin Class = "hl-builtin"
+	String  Class = "hl-string"
+	Number  Class = "hl-number"
+	Comment Class = "hl-comment"
+	Key     Class = "hl-key"
+	Var     Class = "hl-var"
+)
+
+// Token is a piece of source code along with its class.
+type Token struct {
+	Class Class
+	Text  string
+}
+
+// Tokenize splits code into tokens according to the rules of the language
+// with the given name. Concatenating the text of the tokens always gives back
+// the original code. Unknown languages (and plain text) produce a single plain
+// token.
+func Tokenize(code string, name string) []Token {
+	lang := Lookup(name)
+	if lang == nil || lang.Name == Text {
+		if code == "" {
+			return nil
+		}
+		return []Token{{Plain, code}}
+	}
+
+	t := tokenizer{lang: lang, src: code}
+	t.run()
+	return t.tokens
+}
+
+// HTML returns the code as HTML, with the text escaped and each token which
+// isn't plain wrapped in a span with the token's class.
+func HTML(code string, name string) template.HTML {
+	var b strings.Builder
+
+	for _, tok := range Tokenize(code, name) {
+		writeToken(&b, tok.Class, tok.Text)
+	}
+
+	return template.HTML(b.String())
+}
+
+// Lines returns the code as HTML in the same way as HTML(), but with one
+// entry for each line. Tokens which span several lines, like block comments,
+// are split up so that every line is valid HTML on its own. The line endings
+// aren't included, and a newline at the end of the code doesn't start another
+// line.
+func Lines(code string, name string) []template.HTML {
+	var lines []template.HTML
+	var b strings.Builder
+
+	code = strings.ReplaceAll(code, "\r\n", "\n")
+
+	for _, tok := range Tokenize(code, name) {
+		for i, text := range strings.Split(tok.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, template.HTML(b.String()))
+				b.Reset()
+			}
+			writeToken(&b, tok.Class, text)
+		}
+	}
+
+	if b.Len() > 0 {
+		lines = append(lines, template.HTML(b.String()))
+	}
+
+	return lines
+}
+
+// writeToken writes the escaped text of a token to b, wrapped in a span if
+// the token isn't plain. Empty text is skipped, so that no empty spans are
+// written.
+func writeToken(b *strings.Builder, class Class, text string) {
+	if text == "" {
+		return
+	}
+	if class == Plain {
+		b.WriteString(template.HTMLEscapeString(text))
+		return
+	}
+	b.WriteString(`<span class="`)
+	b.WriteString(string(class))
+	b.WriteString(`">`)
+	b.WriteString(template.HTMLEscapeString(text))
+	b.WriteString(`</span>`)
+}
+
+type tokenizer struct {
+	lang *Language
+	src  string
+	pos  int
+	// start is the position in src of the last token's text.
+	start  int
+	tokens []Token
+}
+
+// emit adds a token whose text starts at t.pos, merging adjacent tokens of
+// the same class. A merged token's text is sliced from the source, rather
+// than added to one piece at a time, because building it up that way takes
+// time proportional to the square of its length.
+func (t *tokenizer) emit(class Class, text string) {
+	if n := len(t.tokens); n > 0 && t.tokens[n-1].Class == class {
+		t.tokens[n-1].Text = t.src[t.start : t.pos+len(text)]
+		return
+	}
+	t.start = t.pos
+	t.tokens = append(t.tokens, Token{class, text})
+}
+
+func (t *tokenizer) run() {
+	for t.pos < len(t.src) {
+		rest := t.src[t.pos:]
+		r, size := utf8.DecodeRuneInString(rest)
+
+		switch {
+		case t.startsComment(rest):
+			t.comment(rest)
+		case t.quote(rest) != "":
+			t.str(rest, t.quote(rest))
+		case r >= '0' && r <= '9':
+			t.number(rest)
+		case r == '$' && t.lang.dollarVars:
+			t.variable(rest)
+		case isWordStart(r):
+			t.word(rest)
+		default:
+			t.emit(Plain, rest[:size])
+			t.pos += size
+		}
+	}
+}
+
+func (t *tokenizer) startsComment(rest string) bool {
+	for _, prefix := range t.lang.lineComments {
+		if strings.HasPrefix(rest, prefix) {
+			return true
+		}
+	}
+	return t.lang.blockComment[0] != "" && strings.HasPrefix(rest, t.lang.blockComment[0])
+}
+
+func (t *tokenizer) comment(rest string) {
+	end := len(rest)
+
+	if start := t.lang.blockComment[0]; start != "" && strings.HasPrefix(rest, start) {
+		if i := strings.Index(rest[len(start):], t.lang.blockComment[1]); i >= 0 {
+			end = len(start) + i + len(t.lang.blockComment[1])
+		}
+	} else if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		end = i
+	}
+
+	t.emit(Comment, rest[:end])
+	t.pos += end
+}
+
+// quote returns the string delimiter at the start of rest, if there is one.
+func (t *tokenizer) quote(rest string) string {
+	for _, q := range t.lang.quotes {
+		if strings.HasPrefix(rest, q) {
+			return q
+		}
+	}
+	return ""
+}
+
+func (t *tokenizer) str(rest string, q string) {
+	raw := slices.Contains(t.lang.rawQuotes, q)
+
+	// Look for the closing delimiter. Unless the string is raw, a backslash
+	// escapes the next character and a newline ends an unterminated string.
+	end := len(rest)
+	for i := len(q); i < len(rest); i++ {
+		if !raw && rest[i] == '\\' {
+			i++
+			continue
+		}
+		if !raw && rest[i] == '\n' {
+			end = i
+			break
+		}
+		if strings.HasPrefix(rest[i:], q) {
+			end = i + len(q)
+			break
+		}
+	}
+
+	class := String
+	if t.isKey(rest[end:]) {
+		class = Key
+	}
+
+	t.emit(class, rest[:end])
+	t.pos += end
+}
+
+func (t *tokenizer) number(rest string) {
+	end := 1
+	for end < len(rest) {
+		c := rest[end]
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '.':
+			end++
+		case (c == '+' || c == '-') && (rest[end-1] == 'e' || rest[end-1] == 'E'):
+			end++
+		default:
+			t.emit(Number, rest[:end])
+			t.pos += end
+			return
+		}
+	}
+
+	t.emit(Number, rest[:end])
+	t.pos += end
+}
+
+func (t *tokenizer) variable(rest string) {
+	end := 1
+	if strings.HasPrefix(rest, "${") {
+		if i := strings.IndexByte(rest, '}'); i >= 0 {
+			end = i + 1
+		}
+	} else {
+		end += wordLength(rest[1:])
+	}
+
+	t.emit(Var, rest[:end])
+	t.pos += end
+}
+
+func (t *tokenizer) word(rest string) {
+	end := wordLength(rest)
+	w := rest[:end]
+
+	lookup := w
+	if t.lang.foldCase {
+		lookup = strings.ToLower(w)
+	}
+
+	class := Plain
+	switch {
+	case t.isKey(rest[end:]):
+		class = Key
+	case t.lang.keywords[lookup]:
+		class = Keyword
+	case t.lang.builtins[lookup]:
+		class = Builtin
+	}
+
+	t.emit(class, w)
+	t.pos += end
+}
+
+// isKey reports whether a token followed by rest is a key, in languages which
+// have them.
+func (t *tokenizer) isKey(rest string) bool {
+	if !t.lang.keys {
+		return false
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	// In YAML a key's colon has to be followed by whitespace (or the end of
+	// the line), which stops things like URLs being treated as keys.
+	return strings.HasPrefix(rest, ":") &&
+		(len(rest) == 1 || rest[1] == ' ' || rest[1] == '\t' || rest[1] == '\n' || rest[1] == '\r' || t.lang.Name == "json")
+}
+
+func isWordStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// wordLength returns the length in bytes of the identifier at the start of s.
+func wordLength(s string) int {
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return i
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,298 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		lang string
+		want []Token
+	}{
+		{
+			name: "Go",
+			code: "func main() { // start\n\treturn \"a\\\"b\" + 0x1F\n}",
+			lang: "go",
+			want: []Token{
+				{Keyword, "func"},
+				{Plain, " main() { "},
+				{Comment, "// start"},
+				{Plain, "\n\t"},
+				{Keyword, "return"},
+				{Plain, " "},
+				{String, `"a\"b"`},
+				{Plain, " + "},
+				{Number, "0x1F"},
+				{Plain, "\n}"},
+			},
+		},
+		{
+			name: "SQL keywords ignore case",
+			code: "Select count(*) FROM t /* all */",
+			lang: "sql",
+			want: []Token{
+				{Keyword, "Select"},
+				{Plain, " "},
+				{Builtin, "count"},
+				{Plain, "(*) "},
+				{Keyword, "FROM"},
+				{Plain, " t "},
+				{Comment, "/* all */"},
+			},
+		},
+		{
+			name: "Python triple quotes",
+			code: "x = \"\"\"a\nb\"\"\"",
+			lang: "python",
+			want: []Token{
+				{Plain, "x = "},
+				{String, "\"\"\"a\nb\"\"\""},
+			},
+		},
+		{
+			name: "Shell variables",
+			code: "echo $HOME ${USER}",
+			lang: "bash",
+			want: []Token{
+				{Builtin, "echo"},
+				{Plain, " "},
+				{Var, "$HOME"},
+				{Plain, " "},
+				{Var, "${USER}"},
+			},
+		},
+		{
+			name: "JSON keys",
+			code: `{"a": true}`,
+			lang: "json",
+			want: []Token{
+				{Plain, "{"},
+				{Key, `"a"`},
+				{Plain, ": "},
+				{Builtin, "true"},
+				{Plain, "}"},
+			},
+		},
+		{
+			name: "YAML keys",
+			code: "url: http://x",
+			lang: "yaml",
+			want: []Token{
+				{Key, "url"},
+				{Plain, ": http://x"},
+			},
+		},
+		{
+			name: "Unterminated string",
+			code: "'abc\nx",
+			lang: "javascript",
+			want: []Token{
+				{String, "'abc"},
+				{Plain, "\nx"},
+			},
+		},
+		{
+			name: "Plain text",
+			code: "func main()",
+			lang: Text,
+			want: []Token{{Plain, "func main()"}},
+		},
+		{
+			name: "Unknown language",
+			code: "func main()",
+			lang: "cobol",
+			want: []Token{{Plain, "func main()"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Tokenize(tt.code, tt.lang)
+
+			assert.Equal(t, len(got), len(tt.want))
+			for i := range min(len(got), len(tt.want)) {
+				assert.Equal(t, got[i], tt.want[i])
+			}
+
+			// The tokens should always add back up to the original code.
+			var b strings.Builder
+			for _, tok := range got {
+				b.WriteString(tok.Text)
+			}
+			assert.Equal(t, b.String(), tt.code)
+		})
+	}
+}
+
+func TestTokenizeLongRun(t *testing.T) {
+	code := strings.Repeat("+", 300000)
+
+	start := time.Now()
+	got := Tokenize(code, "go")
+
+	// A long run of tokens which are merged together is tokenized in linear
+	// time, rather than taking seconds.
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("took %s to tokenize", d)
+	}
+	assert.Equal(t, len(got), 1)
+	assert.Equal(t, got[0].Text, code)
+}
+
+func TestHTML(t *testing.T) {
+	got := HTML(`if a < b { return "<b>" }`, "go")
+
+	want := `<span class="hl-keyword">if</span> a &lt; b { <span class="hl-keyword">return</span> <span class="hl-string">&#34;&lt;b&gt;&#34;</span> }`
+
+	assert.Equal(t, string(got), want)
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		lang string
+		want []string
+	}{
+		{
+			name: "Single line",
+			code: "x := 1",
+			lang: "go",
+			want: []string{`x := <span class="hl-number">1</span>`},
+		},
+		{
+			name: "Trailing newline",
+			code: "a\nb\n",
+			lang: "text",
+			want: []string{"a", "b"},
+		},
+		{
+			name: "Blank lines",
+			code: "a\n\n\nb",
+			lang: "text",
+			want: []string{"a", "", "", "b"},
+		},
+		{
+			name: "Windows line endings",
+			code: "a\r\nb\r\n",
+			lang: "text",
+			want: []string{"a", "b"},
+		},
+		{
+			name: "Block comment",
+			code: "/* one\ntwo */ x",
+			lang: "go",
+			want: []string{`<span class="hl-comment">/* one</span>`, `<span class="hl-comment">two */</span> x`},
+		},
+		{
+			name: "Escaped",
+			code: "<b>\n&amp;",
+			lang: "text",
+			want: []string{"&lt;b&gt;", "&amp;amp;"},
+		},
+		{
+			name: "Empty",
+			code: "",
+			lang: "go",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, line := range Lines(tt.code, tt.lang) {
+				got = append(got, string(line))
+			}
+
+			assert.Equal(t, strings.Join(got, "|"), strings.Join(tt.want, "|"))
+			assert.Equal(t, len(got), len(tt.want))
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{
+			name: "Go",
+			code: "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}",
+			want: "go",
+		},
+		{
+			name: "Python",
+			code: "def greet(name):\n    print(f\"hi {name}\")\n",
+			want: "python",
+		},
+		{
+			name: "JavaScript",
+			code: "const add = (a, b) => a + b;\nconsole.log(add(1, 2));",
+			want: "javascript",
+		},
+		{
+			name: "SQL",
+			code: "SELECT id, title\nFROM snippets\nWHERE expires > NOW();",
+			want: "sql",
+		},
+		{
+			name: "Shell",
+			code: "#!/bin/bash\necho \"$HOME\"",
+			want: "bash",
+		},
+		{
+			name: "JSON",
+			code: `{"name": "snippetbox", "tags": ["go"]}`,
+			want: "json",
+		},
+		{
+			name: "YAML",
+			code: "---\nname: snippetbox\nservices:\n  web:\n    image: golang\n",
+			want: "yaml",
+		},
+		{
+			name: "Prose",
+			code: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+			want: Text,
+		},
+		{
+			name: "Empty",
+			code: "  ",
+			want: Text,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Detect(tt.code), tt.want)
+		})
+	}
+}
+
+func TestForFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"main.go", "go"},
+		{"setup.PY", "python"},
+		{"docker-compose.yml", "yaml"},
+		{"notes.txt", Text},
+		{"Makefile", ""},
+		{"archive.tar.gz", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			assert.Equal(t, ForFilename(tt.filename), tt.want)
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package highlight
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// Language describes how to tokenize the source code of one language.
+type Language struct {
+	// Name is the identifier which is stored with a snippet, like "go".
+	Name string
+	// Label is the human-readable name shown in the user interface.
+	Label string
+	// Extension is the usual file name extension for the language.
+	Extension string
+
+	// Other extensions which files in the language use.
+	aliases []string
+
+	keywords map[string]bool
+	builtins map[string]bool
+	// Prefixes which start a comment running to the end of the line.
+	lineComments []string
+	// The start and end of a block comment, if the language has them.
+	blockComment [2]string
+	// The delimiters which start (and end) a string. Longer delimiters are
+	// listed first so that, for example, """ is tried before ".
+	quotes []string
+	// Strings delimited by one of these don't treat backslashes as escapes
+	// and may span multiple lines.
+	rawQuotes []string
+	// Whether keywords are matched regardless of case, as in SQL.
+	foldCase bool
+	// Whether a word or string followed by a colon is a key, as in JSON.
+	keys bool
+	// Whether a $ starts a variable name, as in shell scripts.
+	dollarVars bool
+}
+
+// Text is the name used for snippets which shouldn't be highlighted.
+const Text = "text"
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var languages = []*Language{
+	{
+		Name:      "go",
+		Label:     "Go",
+		Extension: ".go",
+		keywords: words(`break case chan const continue default defer else
+			fallthrough for func go goto if import interface map package range
+			return select struct switch type var`),
+		builtins: words(`append bool byte cap clear close complex complex64
+			complex128 copy delete error false float32 float64 imag int int8
+			int16 int32 int64 iota len make max min new nil panic print println
+			real recover rune string true uint uint8 uint16 uint32 uint64
+			uintptr any comparable`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`, `'`, "`"},
+		rawQuotes:    []string{"`"},
+	},
+	{
+		Name:      "python",
+		Label:     "Python",
+		Extension: ".py",
+		aliases:   []string{".pyw"},
+		keywords: words(`and as assert async await break class continue def
+			del elif else except finally for from global if import in is lambda
+			nonlocal not or pass raise return try while with yield match case`),
+		builtins: words(`False None True abs all any bool dict enumerate
+			float int isinstance len list map max min object open print range
+			repr self set sorted str sum super tuple type zip`),
+		lineComments: []string{"#"},
+		quotes:       []string{`"""`, `'''`, `"`, `'`},
+		rawQuotes:    []string{`"""`, `'''`},
+	},
+	{
+		Name:      "javascript",
+		Label:     "JavaScript",
+		Extension: ".js",
+		aliases:   []string{".mjs", ".cjs"},
+		keywords: words(`async await break case catch class const continue
+			debugger default delete do else export extends finally for function
+			if import in instanceof let new of return static super switch this
+			throw try typeof var void while yield`),
+		builtins: words(`Array Boolean Date Error JSON Map Math Number Object
+			Promise RegExp Set String console document false null true undefined
+			window`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`, `'`, "`"},
+	},
+	{
+		Name:      "sql",
+		Label:     "SQL",
+		Extension: ".sql",
+		keywords: words(`add all alter and as asc between by case check column
+			constraint create database default delete desc distinct drop else end
+			exists foreign from full group having if in index inner insert into
+			is join key left like limit not null offset on or order outer primary
+			references right select set table then union unique update using
+			values view when where with`),
+		builtins: words(`avg bigint boolean char coalesce concat count date
+			datetime decimal false float int integer max min now sum text
+			timestamp true varchar`),
+		lineComments: []string{"--", "#"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`'`, `"`, "`"},
+		foldCase:     true,
+	},
+	{
+		Name:      "bash",
+		Label:     "Shell",
+		Extension: ".sh",
+		aliases:   []string{".bash", ".zsh"},
+		keywords: words(`case do done elif else esac fi for function if in
+			local return select then until while`),
+		builtins: words(`alias cd echo eval exec exit export printf read set
+			shift source test trap unset`),
+		lineComments: []string{"#"},
+		quotes:       []string{`"`, `'`},
+		rawQuotes:    []string{`'`},
+		dollarVars:   true,
+	},
+	{
+		Name:      "json",
+		Label:     "JSON",
+		Extension: ".json",
+		builtins:  words(`true false null`),
+		quotes:    []string{`"`},
+		keys:      true,
+	},
+	{
+		Name:         "yaml",
+		Label:        "YAML",
+		Extension:    ".yaml",
+		aliases:      []string{".yml"},
+		builtins:     words(`true false null yes no on off`),
+		lineComments: []string{"#"},
+		quotes:       []string{`"`, `'`},
+		keys:         true,
+	},
+	{
+		Name:      Text,
+		Label:     "Plain text",
+		Extension: ".txt",
+	},
+}
+
+// Languages returns the supported languages, in the order they should be
+// offered to users.
+func Languages() []*Language {
+	return slices.Clone(languages)
+}
+
+// Names returns the names of the supported languages.
+func Names() []string {
+	names := make([]string, len(languages))
+	for i, lang := range languages {
+		names[i] = lang.Name
+	}
+	return names
+}
+
+// ForFilename returns the name of the language which uses the extension of
+// the file name, or the empty string if there isn't one.
+func ForFilename(filename string) string {
+	ext := strings.ToLower(path.Ext(filename))
+	if ext == "" {
+		return ""
+	}
+
+	for _, lang := range languages {
+		if lang.Extension == ext || slices.Contains(lang.aliases, ext) {
+			return lang.Name
+		}
+	}
+	return ""
+}
+
+// Lookup returns the language with the given name, or nil if there isn't one.
+func Lookup(name string) *Language {
+	for _, lang := range languages {
+		if lang.Name == name {
+			return lang
+		}
+	}
+	return nil
+}
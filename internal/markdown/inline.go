@@ -0,0 +1,400 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	autolinkRX   = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	emailRX      = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*)>`)
+	rawTagRX     = regexp.MustCompile(`^</?[a-zA-Z][a-zA-Z0-9-]*(?:\s[^<>]*)?/?>`)
+	rawCommentRX = regexp.MustCompile(`^<!--[\s\S]*?-->`)
+	bareURLRX    = regexp.MustCompile(`^https?://[^\s<]+`)
+)
+
+// inline renders the inline formatting in a block of text: code spans,
+// emphasis, links, images, line breaks and raw HTML tags. Everything else is
+// escaped.
+func inline(s string) string {
+	return nestedInline(s, 0)
+}
+
+// nestedInline renders inline text which is nested depth levels deep inside
+// links, images and emphasis. Text nested more than maxNesting levels deep
+// is escaped without being formatted.
+func nestedInline(s string, depth int) string {
+	if depth > maxNesting {
+		return html.EscapeString(s)
+	}
+
+	var b strings.Builder
+	// closers holds the position of the bracket which closes each opening
+	// bracket. It's only worked out if there's a bracket in the text.
+	var closers map[int]int
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch c {
+		case '\\':
+			// A backslash escapes punctuation, and before a newline makes a
+			// hard line break.
+			if i+1 < len(s) && isPunct(s[i+1]) {
+				b.WriteString(html.EscapeString(s[i+1 : i+2]))
+				i += 2
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\n' {
+				b.WriteString("<br>\n")
+				i += 2
+				continue
+			}
+
+		case ' ':
+			// Two or more spaces at the end of a line also make a hard line
+			// break.
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], " "))
+			if n >= 2 && i+n < len(s) && s[i+n] == '\n' {
+				b.WriteString("<br>\n")
+				i += n + 1
+				continue
+			}
+
+		case '`':
+			if out, n := codeSpan(s[i:]); n > 0 {
+				b.WriteString(out)
+				i += n
+				continue
+			}
+			// An unmatched run of backticks is literal text.
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case '<':
+			if m := autolinkRX.FindStringSubmatch(s[i:]); m != nil {
+				writeLink(&b, m[1], "", html.EscapeString(m[1]))
+				i += len(m[0])
+				continue
+			}
+			if m := emailRX.FindStringSubmatch(s[i:]); m != nil {
+				writeLink(&b, "mailto:"+m[1], "", html.EscapeString(m[1]))
+				i += len(m[0])
+				continue
+			}
+			// Raw HTML is passed through, to be cleaned up by the sanitizer.
+			if m := rawCommentRX.FindString(s[i:]); m != "" {
+				b.WriteString(m)
+				i += len(m)
+				continue
+			}
+			if m := rawTagRX.FindString(s[i:]); m != "" {
+				b.WriteString(m)
+				i += len(m)
+				continue
+			}
+
+		case '!':
+			if i+1 < len(s) && s[i+1] == '[' {
+				if closers == nil {
+					closers = matchBrackets(s)
+				}
+				if text, dest, title, n := link(s[i+1:], closers[i+1]-i-1); n > 0 {
+					alt := stripTags(nestedInline(text, depth+1))
+					b.WriteString(`<img src="` + html.EscapeString(dest) + `" alt="` + html.EscapeString(alt) + `"`)
+					if title != "" {
+						b.WriteString(` title="` + html.EscapeString(title) + `"`)
+					}
+					b.WriteString(">")
+					i += 1 + n
+					continue
+				}
+			}
+
+		case '[':
+			if closers == nil {
+				closers = matchBrackets(s)
+			}
+			if text, dest, title, n := link(s[i:], closers[i]-i); n > 0 {
+				writeLink(&b, dest, title, nestedInline(text, depth+1))
+				i += n
+				continue
+			}
+
+		case '*', '_', '~':
+			if out, n := emphasis(s, i, depth); n > 0 {
+				b.WriteString(out)
+				i += n
+				continue
+			}
+			// Write out the whole run of delimiters, so that the closing
+			// delimiters of a failed match can't be mistaken for openers.
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], string(c)))
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case 'h':
+			// Bare URLs are turned into links, as on GitHub.
+			if i == 0 || !isAlnum(s[i-1]) {
+				if m := bareURLRX.FindString(s[i:]); m != "" {
+					m = strings.TrimRight(m, ".,:;!?\"')")
+					writeLink(&b, m, "", html.EscapeString(m))
+					i += len(m)
+					continue
+				}
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteString(html.EscapeString(s[i : i+size]))
+		i += size
+	}
+
+	return b.String()
+}
+
+func writeLink(b *strings.Builder, dest string, title string, content string) {
+	b.WriteString(`<a href="` + html.EscapeString(dest) + `"`)
+	if title != "" {
+		b.WriteString(` title="` + html.EscapeString(title) + `"`)
+	}
+	b.WriteString(">" + content + "</a>")
+}
+
+// codeSpan renders the code span at the start of s, returning the HTML and
+// the number of bytes used, or 0 if there isn't a closing backtick string.
+func codeSpan(s string) (string, int) {
+	n := len(s) - len(strings.TrimLeft(s, "`"))
+	fence := s[:n]
+
+	for j := n; j < len(s); {
+		k := strings.Index(s[j:], fence)
+		if k < 0 {
+			return "", 0
+		}
+		k += j
+
+		// The closing string has to be exactly as long as the opening one.
+		end := k + n
+		if end < len(s) && s[end] == '`' {
+			j = end + len(s[end:]) - len(strings.TrimLeft(s[end:], "`"))
+			continue
+		}
+
+		code := strings.ReplaceAll(s[n:k], "\n", " ")
+		if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		return "<code>" + html.EscapeString(code) + "</code>", end
+	}
+
+	return "", 0
+}
+
+// matchBrackets finds the closing bracket for each opening bracket in s,
+// allowing for nested brackets, escapes and code spans. It returns a map
+// from the position of each opening bracket to the position of its closing
+// bracket. Opening brackets which aren't closed are left out.
+//
+// All the brackets are matched in a single pass, because searching for the
+// closing bracket separately from each opening one takes time proportional
+// to the square of the length of text like "[[[[…".
+func matchBrackets(s string) map[int]int {
+	closers := map[int]int{}
+	var open []int
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '`':
+			if _, n := codeSpan(s[i:]); n > 0 {
+				i += n - 1
+			} else {
+				// Skip the rest of an unmatched run of backticks, as
+				// inline() does.
+				i += len(s[i:]) - len(strings.TrimLeft(s[i:], "`")) - 1
+			}
+		case '[':
+			open = append(open, i)
+		case ']':
+			if len(open) > 0 {
+				closers[open[len(open)-1]] = i
+				open = open[:len(open)-1]
+			}
+		}
+	}
+
+	return closers
+}
+
+// link parses a link of the form [text](destination "title") at the start of
+// s, where end is the position of the bracket which closes the text, or
+// less than 1 if it isn't closed. It returns the parts of the link and the
+// number of bytes used, or 0 if there isn't a link there.
+func link(s string, end int) (text string, dest string, title string, n int) {
+	if end < 1 || end+1 >= len(s) || s[end+1] != '(' {
+		return "", "", "", 0
+	}
+	text = s[1:end]
+
+	rest := s[end+2:]
+	pos := len(s) - len(rest)
+	trimmed := strings.TrimLeft(rest, " \t\n")
+	pos += len(rest) - len(trimmed)
+	rest = trimmed
+
+	// The destination is either wrapped in angle brackets, or runs up to the
+	// first space with balanced parentheses.
+	if strings.HasPrefix(rest, "<") {
+		k := strings.IndexAny(rest, ">\n")
+		if k < 0 || rest[k] != '>' {
+			return "", "", "", 0
+		}
+		dest = rest[1:k]
+		pos += k + 1
+		rest = rest[k+1:]
+	} else {
+		parens := 0
+		k := 0
+	dest:
+		for ; k < len(rest); k++ {
+			switch rest[k] {
+			case '\\':
+				k++
+			case '(':
+				parens++
+			case ')':
+				if parens == 0 {
+					break dest
+				}
+				parens--
+			case ' ', '\t', '\n':
+				break dest
+			}
+		}
+		if k > len(rest) {
+			k = len(rest)
+		}
+		dest = unescapePunct(rest[:k])
+		pos += k
+		rest = rest[k:]
+	}
+
+	trimmed = strings.TrimLeft(rest, " \t\n")
+	spaced := len(trimmed) < len(rest)
+	pos += len(rest) - len(trimmed)
+	rest = trimmed
+
+	// A title has to be separated from the destination by whitespace.
+	if spaced && rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		k := strings.IndexByte(rest[1:], rest[0])
+		if k < 0 {
+			return "", "", "", 0
+		}
+		title = unescapePunct(rest[1 : k+1])
+		pos += k + 2
+		rest = rest[k+2:]
+
+		trimmed = strings.TrimLeft(rest, " \t\n")
+		pos += len(rest) - len(trimmed)
+		rest = trimmed
+	}
+
+	if !strings.HasPrefix(rest, ")") {
+		return "", "", "", 0
+	}
+
+	return text, dest, title, pos + 1
+}
+
+// emphasis renders the emphasis which opens at s[i], nested depth levels
+// deep, returning the HTML and the number of bytes used, or 0 if the
+// delimiters there don't open any emphasis.
+func emphasis(s string, i int, depth int) (string, int) {
+	c := s[i]
+	rest := s[i:]
+	n := len(rest) - len(strings.TrimLeft(rest, string(c)))
+
+	// Strikethrough needs exactly two tildes, and there's no emphasis with
+	// more than three delimiters.
+	if (c == '~' && n != 2) || n > 3 {
+		return "", 0
+	}
+
+	// An opening delimiter must be followed by something other than
+	// whitespace. Underscores also can't open emphasis in the middle of a
+	// word, so that names like snake_case_names are left alone.
+	if n >= len(rest) || isSpace(rest[n]) {
+		return "", 0
+	}
+	if c == '_' && i > 0 && isAlnum(s[i-1]) {
+		return "", 0
+	}
+
+	delim := rest[:n]
+	for j := n; j < len(rest); {
+		k := strings.Index(rest[j:], delim)
+		if k < 0 {
+			return "", 0
+		}
+		k += j
+
+		// The closing delimiter has to be the same length, preceded by
+		// something other than whitespace and, for underscores, not
+		// followed by a letter or digit.
+		end := k + n
+		longer := end < len(rest) && rest[end] == c
+		if k == n || isSpace(rest[k-1]) || longer || (c == '_' && end < len(rest) && isAlnum(rest[end])) {
+			j = k + 1
+			if longer {
+				j = end + len(rest[end:]) - len(strings.TrimLeft(rest[end:], string(c)))
+			}
+			continue
+		}
+
+		inner := nestedInline(rest[n:k], depth+1)
+		switch {
+		case c == '~':
+			return "<del>" + inner + "</del>", end
+		case n == 1:
+			return "<em>" + inner + "</em>", end
+		case n == 2:
+			return "<strong>" + inner + "</strong>", end
+		default:
+			return "<em><strong>" + inner + "</strong></em>", end
+		}
+	}
+
+	return "", 0
+}
+
+// unescapePunct removes the backslashes from escaped punctuation.
+func unescapePunct(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
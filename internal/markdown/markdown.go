@@ -0,0 +1,520 @@
+// Package markdown renders Markdown documents to HTML. It supports the
+// commonly used parts of CommonMark along with a few GitHub extensions
+// (fenced code blocks, tables and strikethrough). Raw HTML is allowed in the
+// input, so the output is always passed through the sanitize package.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AguilaMike/snippetbox/internal/highlight"
+	"github.com/AguilaMike/snippetbox/internal/sanitize"
+)
+
+// HTML renders the Markdown source to sanitized HTML.
+func HTML(src string) template.HTML {
+	r := renderer{slugs: map[string]int{}}
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	r.blocks(lines)
+	return template.HTML(sanitize.HTML(r.b.String()))
+}
+
+// Lite renders a smaller subset of Markdown, for short pieces of text like
+// comments, to sanitized HTML. Only paragraphs, fenced code blocks and the
+// inline formatting are supported. Everything else, such as headings, lists
+// and tables, is shown as plain text. Images, and raw HTML other than simple
+// inline formatting, are removed.
+func Lite(src string) template.HTML {
+	r := renderer{slugs: map[string]int{}}
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); {
+		switch {
+		case isBlank(lines[i]):
+			i++
+		case fenceRX.MatchString(lines[i]):
+			i = r.fencedCode(lines, i)
+		default:
+			// Paragraphs only end at a blank line or a code block, because
+			// nothing else starts a block.
+			start := i
+			for i++; i < len(lines) && !isBlank(lines[i]) && !fenceRX.MatchString(lines[i]); i++ {
+			}
+			r.b.WriteString("<p>")
+			r.b.WriteString(inline(strings.Join(trimLines(lines[start:i]), "\n")))
+			r.b.WriteString("</p>\n")
+		}
+	}
+
+	return template.HTML(sanitize.Comment(r.b.String()))
+}
+
+var (
+	headingRX = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	ruleRX    = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceRX   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	quoteRX   = regexp.MustCompile(`^ {0,3}> ?`)
+	bulletRX  = regexp.MustCompile(`^ {0,3}([-*+])[ \t]+`)
+	orderedRX = regexp.MustCompile(`^ {0,3}([0-9]{1,9})([.)])[ \t]+`)
+	htmlRX    = regexp.MustCompile(`^ {0,3}</?[a-zA-Z][a-zA-Z0-9-]*(\s|/?>|$)`)
+	tableRX   = regexp.MustCompile(`^ *\|? *:?-+:? *(\| *:?-+:? *)*\|? *$`)
+)
+
+// languageAliases maps other common names for languages in the info strings
+// of fenced code blocks to the names used by the highlight package.
+var languageAliases = map[string]string{
+	"golang": "go",
+	"py":     "python",
+	"js":     "javascript",
+	"mysql":  "sql",
+	"sh":     "bash",
+	"shell":  "bash",
+	"zsh":    "bash",
+	"yml":    "yaml",
+	"txt":    highlight.Text,
+	"plain":  highlight.Text,
+}
+
+// maxNesting is how deeply blockquotes, lists and inline elements can be
+// nested inside each other. Anything nested deeper is shown as plain text.
+// Each level of nesting re-reads everything inside it, so without a limit a
+// short run of "> > > …" or "- - - …" takes seconds to render.
+const maxNesting = 100
+
+type renderer struct {
+	b strings.Builder
+	// slugs counts how many times each heading ID has been used, so that
+	// repeated headings get unique IDs.
+	slugs map[string]int
+	// depth is how many blockquotes and list items the blocks being rendered
+	// are nested inside.
+	depth int
+	// tight is set while rendering the items of a tight list, whose
+	// paragraphs are written without the <p> tags.
+	tight bool
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// blocks renders a sequence of lines as block-level elements.
+func (r *renderer) blocks(lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRX.MatchString(line):
+			i = r.fencedCode(lines, i)
+		case headingRX.MatchString(line):
+			r.heading(line)
+			i++
+		case ruleRX.MatchString(line):
+			r.b.WriteString("<hr>\n")
+			i++
+		case quoteRX.MatchString(line):
+			i = r.blockquote(lines, i)
+		case bulletRX.MatchString(line) || orderedRX.MatchString(line):
+			i = r.list(lines, i)
+		case htmlRX.MatchString(line):
+			i = r.htmlBlock(lines, i)
+		case isTable(lines, i):
+			i = r.table(lines, i)
+		default:
+			i = r.paragraph(lines, i)
+		}
+	}
+}
+
+// startsBlock reports whether a line would start a new block, which ends
+// a paragraph without needing a blank line in between.
+func startsBlock(line string) bool {
+	return fenceRX.MatchString(line) || headingRX.MatchString(line) ||
+		ruleRX.MatchString(line) || quoteRX.MatchString(line) ||
+		bulletRX.MatchString(line) || orderedRX.MatchString(line)
+}
+
+func (r *renderer) paragraph(lines []string, i int) int {
+	start := i
+	for i++; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+	}
+
+	r.text(lines[start:i])
+	return i
+}
+
+// text writes lines of text as a paragraph.
+func (r *renderer) text(lines []string) {
+	text := inline(strings.Join(trimLines(lines), "\n"))
+	if r.tight {
+		r.b.WriteString(text + "\n")
+		return
+	}
+
+	r.b.WriteString("<p>")
+	r.b.WriteString(text)
+	r.b.WriteString("</p>\n")
+}
+
+// nested renders the lines inside a blockquote or list item, with tight set
+// for the items of a tight list. Once the lines are nested too deeply,
+// they're written as a paragraph of text instead.
+func (r *renderer) nested(lines []string, tight bool) {
+	depth, wasTight := r.depth, r.tight
+	r.depth, r.tight = depth+1, tight
+	defer func() { r.depth, r.tight = depth, wasTight }()
+
+	if r.depth > maxNesting {
+		r.text(lines)
+		return
+	}
+	r.blocks(lines)
+}
+
+func trimLines(lines []string) []string {
+	trimmed := make([]string, len(lines))
+	for i, line := range lines {
+		// Keep trailing spaces, which mark hard line breaks.
+		trimmed[i] = strings.TrimLeft(line, " \t")
+	}
+	return trimmed
+}
+
+func (r *renderer) heading(line string) {
+	m := headingRX.FindStringSubmatch(line)
+	level, text := len(m[1]), m[2]
+
+	fmt.Fprintf(&r.b, "<h%d id=\"%s\">%s</h%d>\n", level, r.slug(text), inline(text), level)
+}
+
+// slug returns a stable ID for a heading, made from its text in the same
+// way as GitHub does: lowercase, with spaces turned into hyphens and most
+// punctuation removed. Repeated headings get a numeric suffix.
+func (r *renderer) slug(text string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(plainText(text)) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_', c == '-':
+			b.WriteRune(c)
+		case c == ' ':
+			b.WriteRune('-')
+		}
+	}
+
+	slug := strings.Trim(b.String(), "-_")
+	if slug == "" {
+		slug = "section"
+	}
+
+	n := r.slugs[slug]
+	r.slugs[slug]++
+	if n > 0 {
+		slug = fmt.Sprintf("%s-%d", slug, n)
+	}
+	return slug
+}
+
+func (r *renderer) fencedCode(lines []string, i int) int {
+	m := fenceRX.FindStringSubmatch(lines[i])
+	fence, lang := m[1], strings.ToLower(m[2])
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+
+	// Code blocks get the same highlighting as code snippets. The language
+	// is taken from the info string after the fence, or detected if there
+	// isn't one.
+	src := strings.Join(code, "\n")
+	if alias, ok := languageAliases[lang]; ok {
+		lang = alias
+	}
+	if highlight.Lookup(lang) == nil {
+		lang = highlight.Detect(src)
+	}
+
+	fmt.Fprintf(&r.b, "<pre class=\"highlight\"><code class=\"language-%s\">%s</code></pre>\n", lang, highlight.HTML(src, lang))
+	return i
+}
+
+func (r *renderer) blockquote(lines []string, i int) int {
+	var inner []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if loc := quoteRX.FindStringIndex(line); loc != nil {
+			inner = append(inner, line[loc[1]:])
+			continue
+		}
+		// Lazy continuation lines carry on the quoted paragraph.
+		if isBlank(line) || startsBlock(line) || len(inner) == 0 || isBlank(inner[len(inner)-1]) {
+			break
+		}
+		inner = append(inner, line)
+	}
+
+	r.b.WriteString("<blockquote>\n")
+	r.nested(inner, false)
+	r.b.WriteString("</blockquote>\n")
+	return i
+}
+
+func (r *renderer) list(lines []string, i int) int {
+	ordered := orderedRX.MatchString(lines[i])
+	markerRX := bulletRX
+	if ordered {
+		markerRX = orderedRX
+	}
+
+	if ordered {
+		start, _ := strconv.Atoi(orderedRX.FindStringSubmatch(lines[i])[1])
+		if start != 1 {
+			fmt.Fprintf(&r.b, "<ol start=\"%d\">\n", start)
+		} else {
+			r.b.WriteString("<ol>\n")
+		}
+	} else {
+		r.b.WriteString("<ul>\n")
+	}
+
+	var items [][]string
+	loose := false
+
+	for i < len(lines) {
+		loc := markerRX.FindStringIndex(lines[i])
+		if loc == nil {
+			break
+		}
+
+		// The item's content is indented to line up with the text after the
+		// marker, and continues for as long as lines are indented that far
+		// (or are blank, followed by such a line).
+		indent := loc[1]
+		item := []string{lines[i][loc[1]:]}
+
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			switch {
+			case isBlank(line):
+				if i+1 < len(lines) && indentation(lines[i+1]) >= indent {
+					item = append(item, "")
+					continue
+				}
+			case indentation(line) >= indent:
+				item = append(item, dedent(line, indent))
+				continue
+			case !startsBlock(line) && !isBlank(item[len(item)-1]):
+				// A lazy continuation of the item's paragraph.
+				item = append(item, strings.TrimLeft(line, " \t"))
+				continue
+			}
+			break
+		}
+
+		if slicesContainBlank(item) {
+			loose = true
+		}
+		items = append(items, item)
+
+		// A blank line between items makes the list loose.
+		if i+1 < len(lines) && isBlank(lines[i]) && markerRX.MatchString(lines[i+1]) {
+			loose = true
+			i++
+		}
+	}
+
+	for _, item := range items {
+		r.b.WriteString("<li>")
+		if loose {
+			r.b.WriteString("\n")
+			r.nested(item, false)
+		} else {
+			// In a tight list the item's own paragraphs are written without
+			// their tags, and there's no newline before the closing tag, so
+			// render the item separately to trim it.
+			sub := renderer{slugs: r.slugs, depth: r.depth}
+			sub.nested(item, true)
+			r.b.WriteString(strings.TrimSuffix(sub.b.String(), "\n"))
+		}
+		r.b.WriteString("</li>\n")
+	}
+
+	if ordered {
+		r.b.WriteString("</ol>\n")
+	} else {
+		r.b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+func slicesContainBlank(lines []string) bool {
+	for i, line := range lines {
+		// Blank lines at the end of an item don't count.
+		if isBlank(line) && i < len(lines)-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// indentation returns the number of leading spaces on a line, counting a tab
+// as four spaces.
+func indentation(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// dedent removes up to n columns of indentation from the start of a line.
+func dedent(line string, n int) string {
+	col := 0
+	for i, c := range line {
+		if col >= n {
+			return line[i:]
+		}
+		switch c {
+		case ' ':
+			col++
+		case '\t':
+			col += 4 - col%4
+		default:
+			return line[i:]
+		}
+	}
+	return ""
+}
+
+// htmlBlock copies raw HTML through until the next blank line. It's cleaned
+// up by the sanitizer along with the rest of the output.
+func (r *renderer) htmlBlock(lines []string, i int) int {
+	for ; i < len(lines) && !isBlank(lines[i]); i++ {
+		r.b.WriteString(lines[i])
+		r.b.WriteString("\n")
+	}
+	return i
+}
+
+// isTable reports whether a table starts at line i: a header row followed by
+// a delimiter row with the same number of cells.
+func isTable(lines []string, i int) bool {
+	if i+1 >= len(lines) || !strings.Contains(lines[i], "|") || !tableRX.MatchString(lines[i+1]) {
+		return false
+	}
+	return len(splitRow(lines[i])) == len(splitRow(lines[i+1]))
+}
+
+func (r *renderer) table(lines []string, i int) int {
+	header := splitRow(lines[i])
+	var aligns []string
+	for _, cell := range splitRow(lines[i+1]) {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			aligns = append(aligns, "center")
+		case right:
+			aligns = append(aligns, "right")
+		case left:
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+
+	cell := func(tag string, col int, text string) {
+		if col < len(aligns) && aligns[col] != "" {
+			fmt.Fprintf(&r.b, "<%s align=\"%s\">%s</%s>", tag, aligns[col], inline(text), tag)
+		} else {
+			fmt.Fprintf(&r.b, "<%s>%s</%s>", tag, inline(text), tag)
+		}
+	}
+
+	r.b.WriteString("<table>\n<thead>\n<tr>")
+	for col, text := range header {
+		cell("th", col, text)
+	}
+	r.b.WriteString("</tr>\n</thead>\n<tbody>\n")
+
+	for i += 2; i < len(lines) && !isBlank(lines[i]) && strings.Contains(lines[i], "|"); i++ {
+		r.b.WriteString("<tr>")
+		row := splitRow(lines[i])
+		// Rows are padded or cut to the same number of cells as the header.
+		for col := range header {
+			text := ""
+			if col < len(row) {
+				text = row[col]
+			}
+			cell("td", col, text)
+		}
+		r.b.WriteString("</tr>\n")
+	}
+
+	r.b.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+// splitRow splits a table row into its cells. Pipes can be escaped with a
+// backslash, or appear inside code spans.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	inCode := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			inCode = !inCode
+			cell.WriteByte(c)
+		case c == '|' && !inCode:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// plainText strips the Markdown formatting from inline text, for use in
+// heading IDs.
+func plainText(text string) string {
+	return stripTags(inline(text))
+}
+
+// stripTags turns rendered HTML back into plain text.
+func stripTags(rendered string) string {
+	return html.UnescapeString(tagsRX.ReplaceAllString(rendered, ""))
+}
+
+var tagsRX = regexp.MustCompile(`<[^>]*>`)
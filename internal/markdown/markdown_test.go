@@ -0,0 +1,161 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Paragraph",
+			input: "Some *emphasis*, **strong** and ~~deleted~~ text\nwith `code <here>`.",
+			want:  "<p>Some <em>emphasis</em>, <strong>strong</strong> and <del>deleted</del> text\nwith <code>code &lt;here&gt;</code>.</p>\n",
+		},
+		{
+			name:  "Intraword underscores",
+			input: "Set max_open_conns but _not_ this.",
+			want:  "<p>Set max_open_conns but <em>not</em> this.</p>\n",
+		},
+		{
+			name:  "Heading IDs",
+			input: "# Set up *MySQL*!\n\n## Set up MySQL\n\n### 1. Ünïcode",
+			want:  "<h1 id=\"set-up-mysql\">Set up <em>MySQL</em>!</h1>\n<h2 id=\"set-up-mysql-1\">Set up MySQL</h2>\n<h3 id=\"1-ncode\">1. Ünïcode</h3>\n",
+		},
+		{
+			name:  "Fenced code",
+			input: "```go\nreturn nil\n```",
+			want:  "<pre class=\"highlight\"><code class=\"language-go\"><span class=\"hl-keyword\">return</span> <span class=\"hl-builtin\">nil</span></code></pre>\n",
+		},
+		{
+			name:  "Fenced code alias",
+			input: "~~~sh\necho <b>\n~~~",
+			want:  "<pre class=\"highlight\"><code class=\"language-bash\"><span class=\"hl-builtin\">echo</span> &lt;b&gt;</code></pre>\n",
+		},
+		{
+			name:  "Lists",
+			input: "- one\n- two\n  - nested\n\n3. three\n4. four",
+			want:  "<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul></li>\n</ul>\n<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n",
+		},
+		{
+			name:  "Blocks in a tight list",
+			input: "- one\n  > quoted\n- <p>raw</p>",
+			want:  "<ul>\n<li>one\n<blockquote>\n<p>quoted</p>\n</blockquote></li>\n<li><p>raw</p></li>\n</ul>\n",
+		},
+		{
+			name:  "Blockquote and rule",
+			input: "> quoted\ntext\n\n---",
+			want:  "<blockquote>\n<p>quoted\ntext</p>\n</blockquote>\n<hr>\n",
+		},
+		{
+			name:  "Links and images",
+			input: "[docs](https://go.dev \"Go\") ![logo](/static/img/logo.png) <https://a.com>",
+			want:  "<p><a href=\"https://go.dev\" title=\"Go\" rel=\"nofollow noopener\">docs</a> <img src=\"/static/img/logo.png\" alt=\"logo\"> <a href=\"https://a.com\" rel=\"nofollow noopener\">https://a.com</a></p>\n",
+		},
+		{
+			name:  "Table",
+			input: "| a | b |\n|---|--:|\n| 1 | 2 |",
+			want:  "<table>\n<thead>\n<tr><th>a</th><th align=\"right\">b</th></tr>\n</thead>\n<tbody>\n<tr><td>1</td><td align=\"right\">2</td></tr>\n</tbody>\n</table>\n",
+		},
+		{
+			name:  "Unsafe HTML",
+			input: "<script>alert(1)</script>\n\n<img src=x onerror=alert(1)>\n\n[x](javascript:alert(1))",
+			want:  "\n<img src=\"x\">\n<p><a rel=\"nofollow noopener\">x</a></p>\n",
+		},
+		{
+			name:  "Escapes",
+			input: "\\*not emphasis\\* & <3",
+			want:  "<p>*not emphasis* &amp; &lt;3</p>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(HTML(tt.input)), tt.want)
+		})
+	}
+}
+
+func TestLite(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Inline formatting",
+			input: "Use `rows.Close()`, *not* [this](https://example.com).",
+			want:  "<p>Use <code>rows.Close()</code>, <em>not</em> <a href=\"https://example.com\" rel=\"nofollow noopener\">this</a>.</p>\n",
+		},
+		{
+			name:  "Paragraphs",
+			input: "First\nline\n\nSecond",
+			want:  "<p>First\nline</p>\n<p>Second</p>\n",
+		},
+		{
+			name:  "Fenced code",
+			input: "Try:\n```go\nreturn nil\n```",
+			want:  "<p>Try:</p>\n<pre class=\"highlight\"><code class=\"language-go\"><span class=\"hl-keyword\">return</span> <span class=\"hl-builtin\">nil</span></code></pre>\n",
+		},
+		{
+			name:  "Other blocks are text",
+			input: "# Heading\n- item\n> quote",
+			want:  "<p># Heading\n- item\n&gt; quote</p>\n",
+		},
+		{
+			name:  "Images and raw HTML",
+			input: "![logo](/static/img/logo.png) <div>bold</div> <script>alert(1)</script>",
+			want:  "<p> bold </p>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(Lite(tt.input)), tt.want)
+		})
+	}
+}
+
+func TestHTMLNesting(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "Nested lists",
+			input: strings.Repeat("- ", 30000) + "x",
+		},
+		{
+			name:  "Nested blockquotes",
+			input: strings.Repeat(">", 60000) + "x",
+		},
+		{
+			name:  "Unclosed brackets",
+			input: strings.Repeat("[", 60000),
+		},
+		{
+			name:  "Nested links",
+			input: strings.Repeat("[", 15000) + "x" + strings.Repeat("](a)", 15000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			HTML(tt.input)
+
+			// The deeply nested input is rendered in roughly linear time,
+			// rather than taking seconds.
+			if d := time.Since(start); d > 2*time.Second {
+				t.Errorf("took %s to render", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+type CollectionModelInterface interface {
+	Insert(title string, description string, visibility string, userID int) (int, string, error)
+	Get(id int) (Collection, error)
+	GetVisible(slug string, viewerID int) (Collection, error)
+	Latest() ([]Collection, error)
+	ByUser(userID int) ([]Collection, error)
+	Update(id int, title string, description string, visibility string) error
+	Delete(id int) error
+	AddSnippet(id int, snippetID int) error
+	RemoveSnippet(id int, snippetID int) error
+	Reorder(id int, snippetIDs []int) error
+}
+
+// Define a Collection type to hold a user's ordered group of snippets.
+// Collections have the same visibility levels as snippets (see
+// SnippetVisibilities): public collections are listed on the collections
+// page, unlisted ones can only be reached by following a link to them, and
+// private ones can only be seen by their owner.
+type Collection struct {
+	ID          int
+	Slug        string
+	UserID      int
+	Title       string
+	Description string
+	Visibility  string
+	Created     time.Time
+	// Updated is the time the collection was created or last edited. It
+	// isn't changed when snippets are added, removed or reordered.
+	Updated time.Time
+	// SnippetCount is the number of snippets in the collection, including
+	// any which the viewer can't see.
+	SnippetCount int
+}
+
+// VisibleTo() returns true if the collection can be viewed by the user with
+// the given ID, in the same way as Snippet.VisibleTo().
+func (c Collection) VisibleTo(userID int) bool {
+	return c.Visibility != VisibilityPrivate || (userID != 0 && c.UserID == userID)
+}
+
+// Define a CollectionModel type which wraps a sql.DB connection pool.
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+// collectionColumns lists the columns selected by every collection query, in
+// the order expected by scanCollection().
+const collectionColumns = `id, slug, user_id, title, description, visibility, created, updated,
+    (SELECT COUNT(*) FROM collection_snippets cs WHERE cs.collection_id = collections.id)`
+
+// scanCollection copies the collectionColumns from a row into a new
+// Collection.
+func scanCollection(row rowScanner) (Collection, error) {
+	var c Collection
+	err := row.Scan(&c.ID, &c.Slug, &c.UserID, &c.Title, &c.Description, &c.Visibility, &c.Created, &c.Updated, &c.SnippetCount)
+	return c, err
+}
+
+// queryCollections runs a query which selects the collectionColumns and
+// returns the matching collections.
+func (m *CollectionModel) queryCollections(stmt string, args ...any) ([]Collection, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []Collection
+
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+// queryCollection runs a query which selects the collectionColumns of a
+// single collection, returning ErrNoRecord if there isn't one.
+func (m *CollectionModel) queryCollection(stmt string, args ...any) (Collection, error) {
+	c, err := scanCollection(m.DB.QueryRow(stmt, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Collection{}, ErrNoRecord
+		}
+		return Collection{}, err
+	}
+
+	return c, nil
+}
+
+// This will insert a new, empty collection owned by the user with the given
+// ID, returning its ID and slug.
+func (m *CollectionModel) Insert(title string, description string, visibility string, userID int) (int, string, error) {
+	stmt := `INSERT INTO collections (slug, user_id, title, description, visibility, created, updated)
+    VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())`
+
+	return insertWithSlug(m.DB, "collections_uc_slug", stmt, userID, title, description, visibility)
+}
+
+// This will return a specific collection based on its id.
+func (m *CollectionModel) Get(id int) (Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM collections WHERE id = ?`
+
+	return m.queryCollection(stmt, id)
+}
+
+// This will return the collection with the given slug, but only if it can be
+// viewed by the user with the given ID (or 0 for an anonymous user). Like
+// private snippets, private collections belonging to somebody else are
+// treated as if they don't exist.
+func (m *CollectionModel) GetVisible(slug string, viewerID int) (Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM collections
+    WHERE slug = ? AND (visibility <> 'private' OR user_id = ?)`
+
+	return m.queryCollection(stmt, slug, viewerID)
+}
+
+// This will return the 20 most recently created public collections.
+func (m *CollectionModel) Latest() ([]Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM collections
+    WHERE visibility = 'public' ORDER BY id DESC LIMIT 20`
+
+	return m.queryCollections(stmt)
+}
+
+// This will return every collection owned by a user, most recently created
+// first.
+func (m *CollectionModel) ByUser(userID int) ([]Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM collections
+    WHERE user_id = ? ORDER BY id DESC`
+
+	return m.queryCollections(stmt, userID)
+}
+
+// This will update the title, description and visibility of a collection.
+func (m *CollectionModel) Update(id int, title string, description string, visibility string) error {
+	stmt := `UPDATE collections SET title = ?, description = ?, visibility = ?, updated = UTC_TIMESTAMP()
+    WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, title, description, visibility, id)
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports 0 rows affected when a row is left unchanged, which can
+	// happen if a collection is saved twice within a second, so a missing
+	// collection has to be checked for separately.
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		_, err = m.Get(id)
+		return err
+	}
+
+	return nil
+}
+
+// This will permanently delete a collection. The snippets in it aren't
+// affected.
+func (m *CollectionModel) Delete(id int) error {
+	stmt := `DELETE FROM collections WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will add a snippet to the end of a collection. Adding a snippet which
+// is already in the collection does nothing.
+func (m *CollectionModel) AddSnippet(id int, snippetID int) error {
+	// Working out the next position in the same statement as the INSERT
+	// means that two snippets added at once can't get the same position.
+	stmt := `INSERT INTO collection_snippets (collection_id, snippet_id, position)
+    SELECT ?, ?, next_position FROM
+    (SELECT IFNULL(MAX(position), 0) + 1 AS next_position FROM collection_snippets WHERE collection_id = ?) n
+    ON DUPLICATE KEY UPDATE position = collection_snippets.position`
+
+	_, err := m.DB.Exec(stmt, id, snippetID, id)
+	return err
+}
+
+// This will remove a snippet from a collection. The positions of the other
+// snippets are left with a gap, which doesn't affect their order.
+func (m *CollectionModel) RemoveSnippet(id int, snippetID int) error {
+	stmt := `DELETE FROM collection_snippets WHERE collection_id = ? AND snippet_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, snippetID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will put the snippets in a collection into the order given by
+// snippetIDs. IDs of snippets which aren't in the collection are ignored, and
+// snippets which aren't in snippetIDs keep their order after the others. That
+// way a snippet which was added while the new order was being chosen isn't
+// lost.
+func (m *CollectionModel) Reorder(id int, snippetIDs []int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the collection's rows so that the positions are worked out from
+	// the current contents.
+	rows, err := tx.Query(`SELECT snippet_id FROM collection_snippets WHERE collection_id = ?
+    ORDER BY position FOR UPDATE`, id)
+	if err != nil {
+		return err
+	}
+
+	var current []int
+	for rows.Next() {
+		var snippetID int
+		err = rows.Scan(&snippetID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, snippetID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var order []int
+	for _, snippetID := range snippetIDs {
+		if slices.Contains(current, snippetID) && !slices.Contains(order, snippetID) {
+			order = append(order, snippetID)
+		}
+	}
+	for _, snippetID := range current {
+		if !slices.Contains(order, snippetID) {
+			order = append(order, snippetID)
+		}
+	}
+
+	for i, snippetID := range order {
+		_, err = tx.Exec(`UPDATE collection_snippets SET position = ? WHERE collection_id = ? AND snippet_id = ?`, i+1, id, snippetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
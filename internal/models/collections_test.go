@@ -0,0 +1,115 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestCollectionModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	snippets := SnippetModel{db}
+	m := CollectionModel{db}
+
+	id, slug, err := m.Insert("Onboarding", "Read these first.", VisibilityPublic, 1)
+	assert.NilError(t, err)
+	hidden, hiddenSlug, err := m.Insert("Drafts", "", VisibilityPrivate, 1)
+	assert.NilError(t, err)
+
+	c, err := m.GetVisible(slug, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, c.ID, id)
+	assert.Equal(t, c.Title, "Onboarding")
+	assert.Equal(t, c.Description, "Read these first.")
+
+	// Private collections can only be seen by their owner.
+	_, err = m.GetVisible(hiddenSlug, 0)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = m.GetVisible(hiddenSlug, 1)
+	assert.NilError(t, err)
+
+	latest, err := m.Latest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(latest), 1)
+	assert.Equal(t, latest[0].ID, id)
+
+	mine, err := m.ByUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(mine), 2)
+	assert.Equal(t, mine[0].ID, hidden)
+
+	first, _, err := snippets.Insert(SnippetEdit{Title: "First", Content: "First...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+	second, _, err := snippets.Insert(SnippetEdit{Title: "Second", Content: "Second...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+	private, _, err := snippets.Insert(SnippetEdit{Title: "Private", Content: "Private...", Format: FormatCode, Visibility: VisibilityPrivate}, 1)
+	assert.NilError(t, err)
+
+	// Adding a snippet twice leaves it where it was.
+	for _, snippetID := range []int{first, second, private, first} {
+		err = m.AddSnippet(id, snippetID)
+		assert.NilError(t, err)
+	}
+
+	c, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, c.SnippetCount, 3)
+
+	// Private snippets are only shown to their author.
+	list, err := snippets.InCollection(id, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 3)
+	assert.Equal(t, list[0].ID, first)
+	assert.Equal(t, list[1].ID, second)
+	assert.Equal(t, list[2].ID, private)
+
+	list, err = snippets.InCollection(id, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 2)
+
+	// Unknown and repeated IDs are ignored, and snippets which are left out
+	// go after the others.
+	err = m.Reorder(id, []int{second, 999, second, private})
+	assert.NilError(t, err)
+
+	list, err = snippets.InCollection(id, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, list[0].ID, second)
+	assert.Equal(t, list[1].ID, private)
+	assert.Equal(t, list[2].ID, first)
+
+	err = m.RemoveSnippet(id, private)
+	assert.NilError(t, err)
+	err = m.RemoveSnippet(id, private)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// New snippets go on the end.
+	err = m.AddSnippet(id, private)
+	assert.NilError(t, err)
+	list, err = snippets.InCollection(id, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, list[2].ID, private)
+
+	err = m.Update(id, "Onboarding, part 1", "", VisibilityUnlisted)
+	assert.NilError(t, err)
+	c, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, c.Title, "Onboarding, part 1")
+	assert.Equal(t, c.Visibility, VisibilityUnlisted)
+
+	err = m.Update(999, "Missing", "", VisibilityPublic)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// Deleting a collection leaves its snippets alone.
+	err = m.Delete(id)
+	assert.NilError(t, err)
+	_, err = m.Get(id)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = snippets.Get(first)
+	assert.NilError(t, err)
+}
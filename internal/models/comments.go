@@ -0,0 +1,279 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type CommentModelInterface interface {
+	Insert(snippetID int, userID int, parentID int, body string) (int, error)
+	InsertOnLines(snippetID int, userID int, lineStart int, lineEnd int, version int, body string) (int, error)
+	Get(id int) (Comment, error)
+	ForSnippet(snippetID int) ([]Comment, error)
+	Counts(snippetIDs []int) (map[int]int, error)
+	Update(id int, body string) error
+	Delete(id int) error
+}
+
+// Define a Comment type to hold a comment on a snippet. Comments have one
+// level of replies: a reply's ParentID is the ID of the comment it replies
+// to, which is always a top-level comment.
+type Comment struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	// UserName is the name of the comment's author, from the users table.
+	UserName string
+	// ParentID is 0 for top-level comments.
+	ParentID int
+	// LineStart and LineEnd are the first and last lines of the snippet that
+	// the comment is about, and Version is the version of the snippet which
+	// they refer to. They're 0 for comments on the snippet as a whole.
+	LineStart int
+	LineEnd   int
+	Version   int
+	// Outdated isn't stored in the comments table; it's set by the web
+	// application when the lines have been changed or removed since the
+	// comment was posted.
+	Outdated bool
+	Body     string
+	Created  time.Time
+	// Updated is the time the comment was posted or last edited.
+	Updated time.Time
+	// Replies holds the replies to a top-level comment, oldest first. It's
+	// only filled in by ForSnippet().
+	Replies []Comment
+}
+
+// Edited() returns true if the comment has been changed since it was posted.
+func (c Comment) Edited() bool {
+	return c.Updated.After(c.Created)
+}
+
+// OnLines() returns true if the comment is about a range of lines, rather
+// than the snippet as a whole.
+func (c Comment) OnLines() bool {
+	return c.LineStart > 0
+}
+
+// Define a CommentModel type which wraps a sql.DB connection pool.
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// commentColumns lists the columns selected by every comment query, in the
+// order expected by scanComment(). The queries join the users table as u.
+const commentColumns = `c.id, c.snippet_id, c.user_id, u.name, IFNULL(c.parent_id, 0), IFNULL(c.line_start, 0), IFNULL(c.line_end, 0), IFNULL(c.version, 0), c.body, c.created, c.updated`
+
+// scanComment copies the commentColumns from a row into a new Comment.
+func scanComment(row rowScanner) (Comment, error) {
+	var c Comment
+	err := row.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.UserName, &c.ParentID, &c.LineStart, &c.LineEnd, &c.Version, &c.Body, &c.Created, &c.Updated)
+	return c, err
+}
+
+// This will add a new comment to a snippet, returning its ID. A parentID of 0
+// adds a top-level comment; otherwise the comment is a reply to the comment
+// with that ID. If the parent doesn't exist, belongs to a different snippet
+// or is itself a reply, ErrNoRecord is returned.
+func (m *CommentModel) Insert(snippetID int, userID int, parentID int, body string) (int, error) {
+	var result sql.Result
+	var err error
+
+	if parentID == 0 {
+		stmt := `INSERT INTO comments (snippet_id, user_id, body, created, updated)
+    VALUES(?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())`
+
+		result, err = m.DB.Exec(stmt, snippetID, userID, body)
+	} else {
+		// Checking the parent in the same statement as the INSERT means that
+		// it can't be deleted in between.
+		stmt := `INSERT INTO comments (snippet_id, user_id, parent_id, body, created, updated)
+    SELECT snippet_id, ?, id, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP() FROM comments
+    WHERE id = ? AND snippet_id = ? AND parent_id IS NULL`
+
+		result, err = m.DB.Exec(stmt, userID, body, parentID, snippetID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrNoRecord
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// This will add a new top-level comment about the lines from lineStart to
+// lineEnd of a snippet, returning its ID. The line numbers refer to the given
+// version of the snippet, so that the comment can be matched up with the
+// right lines after the snippet is edited.
+func (m *CommentModel) InsertOnLines(snippetID int, userID int, lineStart int, lineEnd int, version int, body string) (int, error) {
+	stmt := `INSERT INTO comments (snippet_id, user_id, line_start, line_end, version, body, created, updated)
+    VALUES(?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, snippetID, userID, lineStart, lineEnd, version, body)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// This will return a specific comment.
+func (m *CommentModel) Get(id int) (Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` FROM comments c
+    INNER JOIN users u ON u.id = c.user_id
+    WHERE c.id = ?`
+
+	c, err := scanComment(m.DB.QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Comment{}, ErrNoRecord
+		} else {
+			return Comment{}, err
+		}
+	}
+
+	return c, nil
+}
+
+// This will return the top-level comments on a snippet, oldest first, with
+// their replies filled in.
+func (m *CommentModel) ForSnippet(snippetID int) ([]Comment, error) {
+	// Sorting by ID puts every parent before its replies, so the threads can
+	// be put together in a single pass.
+	stmt := `SELECT ` + commentColumns + ` FROM comments c
+    INNER JOIN users u ON u.id = c.user_id
+    WHERE c.snippet_id = ? ORDER BY c.id`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	// position maps the ID of each top-level comment to its index in
+	// comments.
+	position := map[int]int{}
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.ParentID == 0 {
+			position[c.ID] = len(comments)
+			comments = append(comments, c)
+		} else if i, ok := position[c.ParentID]; ok {
+			comments[i].Replies = append(comments[i].Replies, c)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// This will return the number of comments, including replies, on each of the
+// snippets with the given IDs. Snippets without any comments are left out of
+// the map.
+func (m *CommentModel) Counts(snippetIDs []int) (map[int]int, error) {
+	counts := map[int]int{}
+	if len(snippetIDs) == 0 {
+		return counts, nil
+	}
+
+	args := make([]any, len(snippetIDs))
+	for i, id := range snippetIDs {
+		args[i] = id
+	}
+
+	stmt := `SELECT snippet_id, COUNT(*) FROM comments
+    WHERE snippet_id IN (?` + strings.Repeat(", ?", len(snippetIDs)-1) + `)
+    GROUP BY snippet_id`
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		err = rows.Scan(&id, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[id] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// This will replace the body of a comment.
+func (m *CommentModel) Update(id int, body string) error {
+	stmt := `UPDATE comments SET body = ?, updated = UTC_TIMESTAMP() WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, body, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will delete a comment, along with any replies to it.
+func (m *CommentModel) Delete(id int) error {
+	stmt := `DELETE FROM comments WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
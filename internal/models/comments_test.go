@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestCommentModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	snippets := SnippetModel{db}
+	m := CommentModel{db}
+
+	snippet, _, err := snippets.Insert(SnippetEdit{Title: "Commented", Content: "Commented...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+	other, _, err := snippets.Insert(SnippetEdit{Title: "Other", Content: "Other...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+
+	first, err := m.Insert(snippet, 1, 0, "First")
+	assert.NilError(t, err)
+	second, err := m.Insert(snippet, 1, 0, "Second")
+	assert.NilError(t, err)
+	reply, err := m.Insert(snippet, 1, first, "Reply")
+	assert.NilError(t, err)
+	onLines, err := m.InsertOnLines(snippet, 1, 2, 4, 1, "On lines")
+	assert.NilError(t, err)
+
+	c, err := m.Get(reply)
+	assert.NilError(t, err)
+	assert.Equal(t, c.ParentID, first)
+	assert.Equal(t, c.UserName, "Alice Jones")
+	assert.Equal(t, c.Edited(), false)
+	assert.Equal(t, c.OnLines(), false)
+
+	c, err = m.Get(onLines)
+	assert.NilError(t, err)
+	assert.Equal(t, c.OnLines(), true)
+	assert.Equal(t, c.LineStart, 2)
+	assert.Equal(t, c.LineEnd, 4)
+	assert.Equal(t, c.Version, 1)
+	assert.Equal(t, c.ParentID, 0)
+
+	// Replies can't be replied to, and the parent has to be on the same
+	// snippet.
+	_, err = m.Insert(snippet, 1, reply, "Nested")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+	_, err = m.Insert(other, 1, first, "Elsewhere")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	comments, err := m.ForSnippet(snippet)
+	assert.NilError(t, err)
+	assert.Equal(t, len(comments), 3)
+	assert.Equal(t, comments[0].ID, first)
+	assert.Equal(t, len(comments[0].Replies), 1)
+	assert.Equal(t, comments[0].Replies[0].ID, reply)
+	assert.Equal(t, comments[1].ID, second)
+	assert.Equal(t, comments[2].ID, onLines)
+
+	counts, err := m.Counts([]int{snippet, other})
+	assert.NilError(t, err)
+	assert.Equal(t, counts[snippet], 4)
+	assert.Equal(t, counts[other], 0)
+
+	err = m.Update(second, "Second, edited")
+	assert.NilError(t, err)
+	c, err = m.Get(second)
+	assert.NilError(t, err)
+	assert.Equal(t, c.Body, "Second, edited")
+
+	// Deleting a comment deletes its replies too.
+	err = m.Delete(first)
+	assert.NilError(t, err)
+	_, err = m.Get(reply)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	err = m.Delete(first)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
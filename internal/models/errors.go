@@ -14,4 +14,12 @@ var (
 	// Add a new ErrDuplicateEmail error. We'll use this later if a user
 	// tries to signup with an email address that's already in use.
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	// Add a new ErrEditConflict error. We'll use this if a snippet is updated
+	// using a version number which is no longer current.
+	ErrEditConflict = errors.New("models: edit conflict")
+
+	// Add a new ErrInvalidCursor error. We'll use this if a pagination cursor
+	// can't be decoded.
+	ErrInvalidCursor = errors.New("models: invalid cursor")
 )
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type SnippetFileModelInterface interface {
+	ForSnippet(snippetID int) ([]SnippetFile, error)
+}
+
+// Define a SnippetFile type to hold one of the extra named files in a
+// multi-file snippet. The snippet's own content is always shown first, and
+// the files follow it in Position order.
+type SnippetFile struct {
+	ID        int
+	SnippetID int
+	Position  int
+	Name      string
+	Content   string
+}
+
+// Define a SnippetFileModel type which wraps a sql.DB connection pool.
+type SnippetFileModel struct {
+	DB *sql.DB
+}
+
+// setFiles replaces the files of a snippet as part of a transaction, so that
+// SnippetModel.Insert() and Update() can save them along with the rest of the
+// snippet. The files are stored in the order given, and their ID, SnippetID
+// and Position fields are ignored.
+func setFiles(tx *sql.Tx, snippetID int, files []SnippetFile) error {
+	_, err := tx.Exec(`DELETE FROM snippet_files WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO snippet_files (snippet_id, position, name, content) VALUES (?, ?, ?, ?)`
+
+	for i, f := range files {
+		_, err = tx.Exec(stmt, snippetID, i+1, f.Name, f.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This will return the files of a snippet, in order.
+func (m *SnippetFileModel) ForSnippet(snippetID int) ([]SnippetFile, error) {
+	stmt := `SELECT id, snippet_id, position, name, content FROM snippet_files
+    WHERE snippet_id = ? ORDER BY position`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []SnippetFile
+
+	for rows.Next() {
+		var f SnippetFile
+		err = rows.Scan(&f.ID, &f.SnippetID, &f.Position, &f.Name, &f.Content)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
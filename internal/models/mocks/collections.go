@@ -0,0 +1,95 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+var mockCollection = models.Collection{
+	ID:           1,
+	Slug:         "0nb0ard1ng",
+	UserID:       1,
+	Title:        "Onboarding",
+	Description:  "Read these *first*.",
+	Visibility:   models.VisibilityPublic,
+	Created:      time.Now(),
+	Updated:      time.Now(),
+	SnippetCount: 2,
+}
+
+var mockPrivateCollection = models.Collection{
+	ID:         2,
+	Slug:       "dr4ftsC0ll",
+	UserID:     1,
+	Title:      "Drafts",
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+}
+
+type CollectionModel struct{}
+
+func (m *CollectionModel) Insert(title string, description string, visibility string, userID int) (int, string, error) {
+	return 3, "n3wC0llect", nil
+}
+
+func (m *CollectionModel) Get(id int) (models.Collection, error) {
+	switch id {
+	case 1:
+		return mockCollection, nil
+	case 2:
+		return mockPrivateCollection, nil
+	default:
+		return models.Collection{}, models.ErrNoRecord
+	}
+}
+
+func (m *CollectionModel) GetVisible(slug string, viewerID int) (models.Collection, error) {
+	for _, c := range []models.Collection{mockCollection, mockPrivateCollection} {
+		if c.Slug == slug && c.VisibleTo(viewerID) {
+			return c, nil
+		}
+	}
+
+	return models.Collection{}, models.ErrNoRecord
+}
+
+func (m *CollectionModel) Latest() ([]models.Collection, error) {
+	return []models.Collection{mockCollection}, nil
+}
+
+func (m *CollectionModel) ByUser(userID int) ([]models.Collection, error) {
+	if userID == 1 {
+		return []models.Collection{mockPrivateCollection, mockCollection}, nil
+	}
+
+	return nil, nil
+}
+
+func (m *CollectionModel) Update(id int, title string, description string, visibility string) error {
+	_, err := m.Get(id)
+	return err
+}
+
+func (m *CollectionModel) Delete(id int) error {
+	_, err := m.Get(id)
+	return err
+}
+
+func (m *CollectionModel) AddSnippet(id int, snippetID int) error {
+	return nil
+}
+
+// Mock collection 1 holds mock snippets 1 and 5.
+func (m *CollectionModel) RemoveSnippet(id int, snippetID int) error {
+	if id == 1 && (snippetID == 1 || snippetID == 5) {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *CollectionModel) Reorder(id int, snippetIDs []int) error {
+	return nil
+}
@@ -0,0 +1,135 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+// commentTime is when the recent mock comments were posted. They share a
+// single time so that they don't look as if they've been edited.
+var commentTime = time.Now()
+
+var mockReply = models.Comment{
+	ID:        2,
+	SnippetID: 1,
+	UserID:    2,
+	UserName:  "Bob",
+	ParentID:  1,
+	Body:      "Agreed, *nice* one.",
+	Created:   commentTime,
+	Updated:   commentTime,
+}
+
+var mockComment = models.Comment{
+	ID:        1,
+	SnippetID: 1,
+	UserID:    1,
+	UserName:  "Alice",
+	Body:      "Should this use `bufio`?",
+	Created:   commentTime,
+	Updated:   commentTime,
+	Replies:   []models.Comment{mockReply},
+}
+
+// mockOldComment was posted too long ago to be edited or deleted.
+var mockOldComment = models.Comment{
+	ID:        3,
+	SnippetID: 1,
+	UserID:    2,
+	UserName:  "Bob",
+	Body:      "First!",
+	Created:   commentTime.Add(-time.Hour),
+	Updated:   commentTime.Add(-time.Hour),
+}
+
+// mockLineComment is about the first line of the current version of mock
+// snippet 1.
+var mockLineComment = models.Comment{
+	ID:        5,
+	SnippetID: 1,
+	UserID:    2,
+	UserName:  "Bob",
+	LineStart: 1,
+	LineEnd:   1,
+	Version:   2,
+	Body:      "Maybe a shorter title?",
+	Created:   commentTime.Add(-time.Hour),
+	Updated:   commentTime.Add(-time.Hour),
+}
+
+// mockOutdatedComment is about a line of the first version of mock snippet
+// 1, which was changed in the second version.
+var mockOutdatedComment = models.Comment{
+	ID:        6,
+	SnippetID: 1,
+	UserID:    2,
+	UserName:  "Bob",
+	LineStart: 1,
+	LineEnd:   1,
+	Version:   1,
+	Body:      "Typo here?",
+	Created:   commentTime.Add(-2 * time.Hour),
+	Updated:   commentTime.Add(-2 * time.Hour),
+}
+
+type CommentModel struct{}
+
+func (m *CommentModel) Insert(snippetID int, userID int, parentID int, body string) (int, error) {
+	// Only top-level comments can be replied to.
+	if parentID != 0 && (parentID != mockComment.ID || snippetID != mockComment.SnippetID) {
+		return 0, models.ErrNoRecord
+	}
+
+	return 4, nil
+}
+
+func (m *CommentModel) InsertOnLines(snippetID int, userID int, lineStart int, lineEnd int, version int, body string) (int, error) {
+	return 4, nil
+}
+
+func (m *CommentModel) Get(id int) (models.Comment, error) {
+	switch id {
+	case 1:
+		return mockComment, nil
+	case 2:
+		return mockReply, nil
+	case 3:
+		return mockOldComment, nil
+	case 5:
+		return mockLineComment, nil
+	case 6:
+		return mockOutdatedComment, nil
+	default:
+		return models.Comment{}, models.ErrNoRecord
+	}
+}
+
+func (m *CommentModel) ForSnippet(snippetID int) ([]models.Comment, error) {
+	if snippetID == 1 {
+		return []models.Comment{mockOldComment, mockComment, mockLineComment, mockOutdatedComment}, nil
+	}
+
+	return nil, nil
+}
+
+func (m *CommentModel) Counts(snippetIDs []int) (map[int]int, error) {
+	counts := map[int]int{}
+	for _, id := range snippetIDs {
+		if id == 1 {
+			counts[id] = 5
+		}
+	}
+
+	return counts, nil
+}
+
+func (m *CommentModel) Update(id int, body string) error {
+	_, err := m.Get(id)
+	return err
+}
+
+func (m *CommentModel) Delete(id int) error {
+	_, err := m.Get(id)
+	return err
+}
@@ -0,0 +1,23 @@
+package mocks
+
+import (
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+var mockFile = models.SnippetFile{
+	ID:        1,
+	SnippetID: 1,
+	Position:  1,
+	Name:      "splash.sh",
+	Content:   "echo 'splash!'",
+}
+
+type SnippetFileModel struct{}
+
+func (m *SnippetFileModel) ForSnippet(snippetID int) ([]models.SnippetFile, error) {
+	if snippetID == 1 {
+		return []models.SnippetFile{mockFile}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,34 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+var mockRevision = models.Revision{
+	ID:        1,
+	SnippetID: 1,
+	Version:   1,
+	Title:     "An old silent pond",
+	Content:   "An old pond...",
+	Created:   time.Now(),
+}
+
+type RevisionModel struct{}
+
+func (m *RevisionModel) Get(snippetID int, version int) (models.Revision, error) {
+	if snippetID == 1 && version == 1 {
+		return mockRevision, nil
+	}
+
+	return models.Revision{}, models.ErrNoRecord
+}
+
+func (m *RevisionModel) All(snippetID int) ([]models.Revision, error) {
+	if snippetID == 1 {
+		return []models.Revision{mockRevision}, nil
+	}
+
+	return nil, nil
+}
@@ -1,34 +1,342 @@
 package mocks
 
 import (
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/AguilaMike/snippetbox/internal/models"
 )
 
 var mockSnippet = models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	Slug:       "pondXy7q2R",
+	UserID:     1,
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Format:     models.FormatCode,
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    2,
+	StarCount:  1,
+	ViewCount:  42,
+}
+
+var mockExpiredSnippet = models.Snippet{
+	ID:         3,
+	Slug:       "winT3rFo5t",
+	UserID:     1,
+	Title:      "Over the wintry forest",
+	Content:    "Over the wintry forest...",
+	Format:     models.FormatCode,
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now().Add(-48 * time.Hour),
+	Updated:    time.Now().Add(-48 * time.Hour),
+	Expires:    time.Now().Add(-24 * time.Hour),
+	Version:    1,
+}
+
+var mockTrashedSnippet = models.Snippet{
+	ID:         4,
+	Slug:       "autUmn4Mrn",
+	UserID:     1,
+	Title:      "First autumn morning",
+	Content:    "First autumn morning...",
+	Format:     models.FormatCode,
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now().Add(-48 * time.Hour),
+	Updated:    time.Now().Add(-48 * time.Hour),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    1,
+	Deleted:    time.Now().Add(-time.Hour),
+}
+
+var mockUnlistedSnippet = models.Snippet{
+	ID:         5,
+	Slug:       "cand1eLigh",
+	UserID:     1,
+	Title:      "The light of a candle",
+	Content:    "The light of a candle...",
+	Format:     models.FormatCode,
+	Visibility: models.VisibilityUnlisted,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    1,
+}
+
+var mockPrivateSnippet = models.Snippet{
+	ID:         6,
+	Slug:       "summ3rRivr",
+	UserID:     1,
+	Title:      "A summer river",
+	Content:    "A summer river being crossed...",
+	Format:     models.FormatCode,
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    1,
+}
+
+var mockProtectedSnippet = models.Snippet{
+	ID:         7,
+	Slug:       "l0ckedN0te",
+	UserID:     1,
+	Title:      "Staging access",
+	Content:    "The staging password is in the vault.",
+	Format:     models.FormatPlain,
+	Visibility: models.VisibilityUnlisted,
+	Protected:  true,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    1,
+}
+
+var mockLastViewSnippet = models.Snippet{
+	ID:         8,
+	Slug:       "bUrn4ft3rR",
+	UserID:     1,
+	Title:      "Reset link",
+	Content:    "https://example.com/reset/8f14e45f",
+	Format:     models.FormatPlain,
+	Visibility: models.VisibilityUnlisted,
+	ViewsLeft:  1,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    1,
+}
+
+var mockViewLimitedSnippet = models.Snippet{
+	ID:         9,
+	Slug:       "thr3eV1ews",
+	UserID:     1,
+	Title:      "Meeting notes",
+	Content:    "Notes for the next three readers.",
+	Format:     models.FormatPlain,
+	Visibility: models.VisibilityUnlisted,
+	ViewsLeft:  3,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    1,
+}
+
+var mockEncryptedSnippet = models.Snippet{
+	ID:         10,
+	Slug:       "s3cr3tN0te",
+	UserID:     1,
+	Title:      "Encrypted snippet",
+	Content:    "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwd",
+	Format:     models.FormatEncrypted,
+	Visibility: models.VisibilityUnlisted,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    1,
+}
+
+var mockForkSnippet = models.Snippet{
+	ID:         11,
+	Slug:       "f0rk0fOne1",
+	UserID:     2,
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Format:     models.FormatCode,
+	Visibility: models.VisibilityPublic,
+	ForkedFrom: 1,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	Version:    1,
 }
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	return 2, nil
+func (m *SnippetModel) Insert(snippet models.SnippetEdit, userID int) (int, string, error) {
+	return 2, "newSn1ppet", nil
+}
+
+func (m *SnippetModel) Fork(id int, userID int, expires *time.Time) (int, string, error) {
+	_, err := m.Get(id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return 12, "n3wF0rkSn1", nil
+}
+
+func (m *SnippetModel) Forks(id int) ([]models.Snippet, error) {
+	if id == mockSnippet.ID {
+		return []models.Snippet{mockForkSnippet}, nil
+	}
+
+	return nil, nil
 }
 
 func (m *SnippetModel) Get(id int) (models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 4:
+		// The trashed snippet can only be fetched once it's been restored.
+		s := mockTrashedSnippet
+		s.Deleted = time.Time{}
+		return s, nil
+	case 5:
+		return mockUnlistedSnippet, nil
+	case 6:
+		return mockPrivateSnippet, nil
+	case 7:
+		return mockProtectedSnippet, nil
+	case 8:
+		return mockLastViewSnippet, nil
+	case 9:
+		return mockViewLimitedSnippet, nil
+	case 10:
+		return mockEncryptedSnippet, nil
+	case 11:
+		return mockForkSnippet, nil
 	default:
 		return models.Snippet{}, models.ErrNoRecord
 	}
 }
 
+func (m *SnippetModel) GetVisible(slug string, viewerID int) (models.Snippet, error) {
+	for _, s := range []models.Snippet{mockSnippet, mockUnlistedSnippet, mockPrivateSnippet, mockProtectedSnippet, mockLastViewSnippet, mockViewLimitedSnippet, mockEncryptedSnippet, mockForkSnippet} {
+		if s.Slug == slug && s.VisibleTo(viewerID) {
+			return s, nil
+		}
+	}
+
+	return models.Snippet{}, models.ErrNoRecord
+}
+
 func (m *SnippetModel) Latest() ([]models.Snippet, error) {
 	return []models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) ByUser(userID int) ([]models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []models.Snippet{mockSnippet, mockUnlistedSnippet, mockPrivateSnippet, mockExpiredSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *SnippetModel) Starred(userID int) ([]models.Snippet, error) {
+	switch userID {
+	case 2:
+		return []models.Snippet{mockSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *SnippetModel) InCollection(collectionID int, viewerID int) ([]models.Snippet, error) {
+	if collectionID == 1 {
+		return []models.Snippet{mockSnippet, mockUnlistedSnippet}, nil
+	}
+
+	return nil, nil
+}
+
+// Mock snippet 1 is the only snippet that has been viewed recently.
+func (m *SnippetModel) Trending(period string, limit int) ([]models.Snippet, error) {
+	return []models.Snippet{mockSnippet}, nil
+}
+
+func (m *SnippetModel) Update(id int, edit models.SnippetEdit, version int) error {
+	switch id {
+	case 1:
+		if version != mockSnippet.Version {
+			return models.ErrEditConflict
+		}
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Unlock(id int, password string) error {
+	if id != mockProtectedSnippet.ID {
+		return nil
+	}
+
+	if password != "open sesame" {
+		return models.ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) View(id int) (models.Snippet, error) {
+	return m.Get(id)
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Restore(id int, userID int) error {
+	if id == mockTrashedSnippet.ID && userID == mockTrashedSnippet.UserID {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) Trashed(userID int) ([]models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []models.Snippet{mockTrashedSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *SnippetModel) Purge(retention time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (m *SnippetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+func (m *SnippetModel) Browse(q models.SnippetQuery) (models.SnippetPage, error) {
+	// The mock only has a single page, so any cursor is one it didn't issue.
+	if q.Cursor != "" {
+		return models.SnippetPage{}, models.ErrInvalidCursor
+	}
+
+	// Only the "haiku" tag is used by the mock snippet.
+	if q.Tag != "" && q.Tag != "haiku" {
+		return models.SnippetPage{}, nil
+	}
+
+	return models.SnippetPage{Snippets: []models.Snippet{mockSnippet}}, nil
+}
+
+func (m *SnippetModel) Search(q models.SearchQuery) (models.SearchPage, error) {
+	page := models.SearchPage{Page: max(q.Page, 1)}
+
+	// The mock snippet matches any search for "pond" which doesn't exclude
+	// "frog".
+	terms := q.Terms.Highlights()
+	if slices.ContainsFunc(terms, func(t string) bool { return strings.EqualFold(t, "pond") }) &&
+		!slices.Contains(q.Terms.Excluded, "frog") && page.Page == 1 {
+		page.Snippets = []models.Snippet{mockSnippet}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,16 @@
+package mocks
+
+type StarModel struct{}
+
+func (m *StarModel) Insert(userID int, snippetID int) error {
+	return nil
+}
+
+func (m *StarModel) Delete(userID int, snippetID int) error {
+	return nil
+}
+
+// Bob has starred mock snippet 1.
+func (m *StarModel) Exists(userID int, snippetID int) (bool, error) {
+	return userID == 2 && snippetID == 1, nil
+}
@@ -0,0 +1,38 @@
+package mocks
+
+import (
+	"strings"
+
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+var mockTags = []string{"haiku", "poetry"}
+
+type TagModel struct{}
+
+func (m *TagModel) ForSnippet(snippetID int) ([]string, error) {
+	if snippetID == 1 {
+		return mockTags, nil
+	}
+
+	return nil, nil
+}
+
+func (m *TagModel) Cloud(limit int) ([]models.TagCount, error) {
+	return []models.TagCount{
+		{Name: "haiku", Count: 3},
+		{Name: "poetry", Count: 1},
+	}, nil
+}
+
+func (m *TagModel) Suggest(prefix string, limit int) ([]string, error) {
+	var tags []string
+
+	for _, tag := range mockTags {
+		if strings.HasPrefix(tag, prefix) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
@@ -21,13 +21,16 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	if email == "alice@example.com" && password == "pa$$word" {
 		return 1, nil
 	}
+	if email == "bob@example.com" && password == "pa$$word" {
+		return 2, nil
+	}
 
 	return 0, models.ErrInvalidCredentials
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 2:
 		return true, nil
 	default:
 		return false, nil
@@ -45,6 +48,16 @@ func (m *UserModel) GetByID(id int) (*models.User, error) {
 
 		return u, nil
 	}
+	if id == 2 {
+		u := &models.User{
+			ID:      2,
+			Name:    "Bob",
+			Email:   "bob@example.com",
+			Created: time.Now(),
+		}
+
+		return u, nil
+	}
 
 	return nil, models.ErrNoRecord
 }
@@ -0,0 +1,15 @@
+package mocks
+
+import (
+	"time"
+)
+
+type ViewModel struct{}
+
+func (m *ViewModel) Record(views map[int]int, at time.Time) error {
+	return nil
+}
+
+func (m *ViewModel) DeleteBefore(before time.Time) (int, error) {
+	return 0, nil
+}
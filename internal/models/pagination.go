@@ -0,0 +1,149 @@
+package models
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The sort orders supported by SnippetModel.Browse().
+const (
+	SortNewest   = "newest"
+	SortOldest   = "oldest"
+	SortExpiring = "expiring"
+	SortTitle    = "title"
+)
+
+// SnippetSorts lists the permitted values for SnippetQuery.Sort.
+var SnippetSorts = []string{SortNewest, SortOldest, SortExpiring, SortTitle}
+
+// The default and maximum number of snippets returned on a single page.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// SnippetQuery holds the options for a paginated snippet listing.
+type SnippetQuery struct {
+	// Sort is one of the SnippetSorts values. It defaults to SortNewest.
+	Sort string
+	// Cursor is the Next or Prev cursor from a previously returned page, or
+	// the empty string for the first page.
+	Cursor string
+	// Limit is the page size. It defaults to DefaultPageSize and is capped
+	// at MaxPageSize.
+	Limit int
+	// Tag restricts the listing to snippets with this tag, if it's set.
+	Tag string
+}
+
+// SnippetPage holds a single page of snippets along with the cursors for the
+// pages either side of it. A cursor is the empty string if there's no page
+// in that direction.
+type SnippetPage struct {
+	Snippets []Snippet
+	Next     string
+	Prev     string
+}
+
+// Define the directions that a cursor can point in.
+const (
+	cursorAfter  = "a"
+	cursorBefore = "b"
+)
+
+// cursor identifies a position in a sorted listing: the sort key and ID of a
+// snippet, and whether the page wanted comes before or after it.
+type cursor struct {
+	sort      string
+	direction string
+	id        int
+	value     string
+}
+
+// encode returns the cursor as an opaque, URL-safe string.
+func (c cursor) encode() string {
+	raw := strings.Join([]string{c.sort, c.direction, strconv.Itoa(c.id), c.value}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a string created by cursor.encode(). It returns
+// ErrInvalidCursor if the string is malformed or was created for a
+// different sort order.
+func decodeCursor(s string, sort string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	// The value comes last because it may itself contain the separator.
+	parts := strings.SplitN(string(raw), "|", 4)
+	if len(parts) != 4 || parts[0] != sort {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	if parts[1] != cursorAfter && parts[1] != cursorBefore {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	id, err := strconv.Atoi(parts[2])
+	if err != nil || id < 1 {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	c := cursor{sort: parts[0], direction: parts[1], id: id, value: parts[3]}
+
+	// Check that the sort key value can be used in a query.
+	if _, err := c.key(); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// key returns the cursor's sort key value in the form that's compared
+// against the database column.
+func (c cursor) key() (any, error) {
+	switch c.sort {
+	case SortExpiring:
+		return time.Parse(time.RFC3339Nano, c.value)
+	case SortTitle:
+		return c.value, nil
+	default:
+		return c.id, nil
+	}
+}
+
+// sortSpec describes how a sort order maps onto the snippets table. Every
+// order uses the id column as a tie-breaker so that keys are unique.
+type sortSpec struct {
+	column     string
+	descending bool
+	value      func(s Snippet) string
+}
+
+var sortSpecs = map[string]sortSpec{
+	SortNewest: {
+		column:     "id",
+		descending: true,
+		value:      func(s Snippet) string { return "" },
+	},
+	SortOldest: {
+		column: "id",
+		value:  func(s Snippet) string { return "" },
+	},
+	SortExpiring: {
+		column: "expires",
+		value:  func(s Snippet) string { return s.Expires.UTC().Format(time.RFC3339Nano) },
+	},
+	SortTitle: {
+		column: "title",
+		value:  func(s Snippet) string { return s.Title },
+	},
+}
+
+// cursorFor returns a cursor pointing in the given direction from s.
+func (spec sortSpec) cursorFor(sort string, direction string, s Snippet) string {
+	return cursor{sort: sort, direction: direction, id: s.ID, value: spec.value(s)}.encode()
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor cursor
+	}{
+		{
+			name:   "Newest",
+			cursor: cursor{sort: SortNewest, direction: cursorAfter, id: 42},
+		},
+		{
+			name:   "Expiring",
+			cursor: cursor{sort: SortExpiring, direction: cursorBefore, id: 7, value: "2024-03-17T10:15:00Z"},
+		},
+		{
+			name:   "Title containing separator",
+			cursor: cursor{sort: SortTitle, direction: cursorAfter, id: 3, value: "a|b|c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeCursor(tt.cursor.encode(), tt.cursor.sort)
+
+			assert.NilError(t, err)
+			assert.Equal(t, c, tt.cursor)
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		sort  string
+	}{
+		{
+			name:  "Not base64",
+			input: "!!!",
+			sort:  SortNewest,
+		},
+		{
+			name:  "Wrong sort",
+			input: cursor{sort: SortOldest, direction: cursorAfter, id: 1}.encode(),
+			sort:  SortNewest,
+		},
+		{
+			name:  "Bad direction",
+			input: cursor{sort: SortNewest, direction: "x", id: 1}.encode(),
+			sort:  SortNewest,
+		},
+		{
+			name:  "Bad ID",
+			input: cursor{sort: SortNewest, direction: cursorAfter, id: 0}.encode(),
+			sort:  SortNewest,
+		},
+		{
+			name:  "Bad time",
+			input: cursor{sort: SortExpiring, direction: cursorAfter, id: 1, value: "yesterday"}.encode(),
+			sort:  SortExpiring,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.input, tt.sort)
+
+			assert.Equal(t, errors.Is(err, ErrInvalidCursor), true)
+		})
+	}
+}
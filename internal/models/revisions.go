@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type RevisionModelInterface interface {
+	Get(snippetID int, version int) (Revision, error)
+	All(snippetID int) ([]Revision, error)
+}
+
+// Define a Revision type to hold a previous version of a snippet. Revisions
+// are written by SnippetModel.Update() just before a snippet is changed, so
+// the Created field records when this version was replaced.
+type Revision struct {
+	ID        int
+	SnippetID int
+	Version   int
+	Title     string
+	Content   string
+	Created   time.Time
+}
+
+// Define a RevisionModel type which wraps a sql.DB connection pool.
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// This will return a specific revision of a snippet.
+func (m *RevisionModel) Get(snippetID int, version int) (Revision, error) {
+	stmt := `SELECT id, snippet_id, version, title, content, created FROM snippet_revisions
+    WHERE snippet_id = ? AND version = ?`
+
+	var r Revision
+
+	err := m.DB.QueryRow(stmt, snippetID, version).Scan(&r.ID, &r.SnippetID, &r.Version, &r.Title, &r.Content, &r.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Revision{}, ErrNoRecord
+		} else {
+			return Revision{}, err
+		}
+	}
+
+	return r, nil
+}
+
+// This will return every stored revision of a snippet, newest first.
+func (m *RevisionModel) All(snippetID int) ([]Revision, error) {
+	stmt := `SELECT id, snippet_id, version, title, content, created FROM snippet_revisions
+    WHERE snippet_id = ? ORDER BY version DESC`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+
+	for rows.Next() {
+		var r Revision
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.Version, &r.Title, &r.Content, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
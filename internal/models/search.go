@@ -0,0 +1,159 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SearchIndex is implemented by the search backends. Index() adds or replaces
+// a snippet in the index and Delete() removes one; backends which index the
+// snippets table directly can treat both as no-ops.
+type SearchIndex interface {
+	Index(s Snippet) error
+	Delete(id int) error
+	Query(q SearchQuery) (SearchPage, error)
+}
+
+// FullTextIndex is a SearchIndex backed by the MySQL FULLTEXT index on the
+// snippets table. MySQL keeps the index up to date itself.
+type FullTextIndex struct {
+	Snippets SnippetModelInterface
+}
+
+func (idx *FullTextIndex) Index(s Snippet) error {
+	return nil
+}
+
+func (idx *FullTextIndex) Delete(id int) error {
+	return nil
+}
+
+func (idx *FullTextIndex) Query(q SearchQuery) (SearchPage, error) {
+	return idx.Snippets.Search(q)
+}
+
+// SearchTerms holds a parsed search query. Terms and Phrases must all appear
+// in a matching snippet, and none of the Excluded terms may appear.
+type SearchTerms struct {
+	Terms    []string
+	Phrases  []string
+	Excluded []string
+}
+
+// SearchQuery holds the options for a paginated search.
+type SearchQuery struct {
+	Terms SearchTerms
+	// Page is the 1-based page number. It defaults to the first page.
+	Page int
+	// Limit is the page size. It defaults to DefaultPageSize and is capped
+	// at MaxPageSize.
+	Limit int
+}
+
+// Bounds() returns the page number and page size to use for the query,
+// applying the defaults and the maximum page size.
+func (q SearchQuery) Bounds() (page int, limit int) {
+	page = max(q.Page, 1)
+
+	limit = q.Limit
+	if limit < 1 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	return page, limit
+}
+
+// SearchPage holds a single page of search results, ordered by relevance.
+type SearchPage struct {
+	Snippets []Snippet
+	Page     int
+	HasNext  bool
+}
+
+// ParseSearch() parses a search query as typed by a user. Double-quoted text
+// is treated as a phrase, words prefixed with "-" are excluded, and any other
+// words are required. Punctuation inside words is treated as a word break,
+// in the same way as by the MySQL full-text parser.
+func ParseSearch(q string) SearchTerms {
+	var st SearchTerms
+
+	for q != "" {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		if q == "" {
+			break
+		}
+
+		// A quoted phrase runs until the closing quote, or the end of the
+		// query if there isn't one.
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			var phrase string
+			if end < 0 {
+				phrase, q = q[1:], ""
+			} else {
+				phrase, q = q[1:end+1], q[end+2:]
+			}
+
+			if words := splitWords(phrase); len(words) > 0 {
+				st.Phrases = append(st.Phrases, strings.Join(words, " "))
+			}
+			continue
+		}
+
+		end := strings.IndexFunc(q, unicode.IsSpace)
+		if end < 0 {
+			end = len(q)
+		}
+		word := q[:end]
+		q = q[end:]
+
+		if strings.HasPrefix(word, "-") {
+			st.Excluded = append(st.Excluded, splitWords(word)...)
+		} else {
+			st.Terms = append(st.Terms, splitWords(word)...)
+		}
+	}
+
+	return st
+}
+
+// Empty() returns true if there's nothing for a snippet to match. A query
+// containing only excluded terms is considered empty.
+func (st SearchTerms) Empty() bool {
+	return len(st.Terms) == 0 && len(st.Phrases) == 0
+}
+
+// Highlights() returns the words and phrases which should be highlighted in
+// matching snippets.
+func (st SearchTerms) Highlights() []string {
+	return append(append([]string(nil), st.Phrases...), st.Terms...)
+}
+
+// booleanQuery() returns the terms as a MySQL boolean mode full-text search
+// expression. The individual words have already had any special characters
+// removed by splitWords(), so they can't change the meaning of the
+// expression.
+func (st SearchTerms) booleanQuery() string {
+	var parts []string
+
+	for _, p := range st.Phrases {
+		parts = append(parts, `+"`+p+`"`)
+	}
+	for _, t := range st.Terms {
+		parts = append(parts, "+"+t)
+	}
+	for _, e := range st.Excluded {
+		parts = append(parts, "-"+e)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// splitWords breaks a string into words made up of letters, digits and
+// underscores.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		wantTerms    []string
+		wantPhrases  []string
+		wantExcluded []string
+		wantBoolean  string
+	}{
+		{
+			name:        "Words",
+			query:       "  silent  pond ",
+			wantTerms:   []string{"silent", "pond"},
+			wantBoolean: "+silent +pond",
+		},
+		{
+			name:        "Phrase",
+			query:       `"old silent pond" frog`,
+			wantTerms:   []string{"frog"},
+			wantPhrases: []string{"old silent pond"},
+			wantBoolean: `+"old silent pond" +frog`,
+		},
+		{
+			name:         "Exclusion",
+			query:        "pond -frog",
+			wantTerms:    []string{"pond"},
+			wantExcluded: []string{"frog"},
+			wantBoolean:  "+pond -frog",
+		},
+		{
+			name:        "Unterminated phrase",
+			query:       `"silent pond`,
+			wantPhrases: []string{"silent pond"},
+			wantBoolean: `+"silent pond"`,
+		},
+		{
+			name:        "Operators are stripped",
+			query:       `+foo* (bar) ~baz "qu\"ux"`,
+			wantTerms:   []string{"foo", "bar", "baz", "ux"},
+			wantPhrases: []string{"qu"},
+			wantBoolean: `+"qu" +foo +bar +baz +ux`,
+		},
+		{
+			name:        "Punctuation splits words",
+			query:       "fmt.Println",
+			wantTerms:   []string{"fmt", "Println"},
+			wantBoolean: "+fmt +Println",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := ParseSearch(tt.query)
+
+			assert.Equal(t, slices.Equal(st.Terms, tt.wantTerms), true)
+			assert.Equal(t, slices.Equal(st.Phrases, tt.wantPhrases), true)
+			assert.Equal(t, slices.Equal(st.Excluded, tt.wantExcluded), true)
+			assert.Equal(t, st.booleanQuery(), tt.wantBoolean)
+		})
+	}
+}
+
+func TestSearchTermsEmpty(t *testing.T) {
+	assert.Equal(t, ParseSearch("").Empty(), true)
+	assert.Equal(t, ParseSearch("-frog").Empty(), true)
+	assert.Equal(t, ParseSearch("pond").Empty(), false)
+}
@@ -1,26 +1,260 @@
 package models
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
+	Insert(snippet SnippetEdit, userID int) (int, string, error)
+	Fork(id int, userID int, expires *time.Time) (int, string, error)
+	Forks(id int) ([]Snippet, error)
 	Get(id int) (Snippet, error)
+	GetVisible(slug string, viewerID int) (Snippet, error)
 	Latest() ([]Snippet, error)
+	ByUser(userID int) ([]Snippet, error)
+	Starred(userID int) ([]Snippet, error)
+	InCollection(collectionID int, viewerID int) ([]Snippet, error)
+	Trending(period string, limit int) ([]Snippet, error)
+	Update(id int, edit SnippetEdit, version int) error
+	Unlock(id int, password string) error
+	View(id int) (Snippet, error)
+	Delete(id int) error
+	Restore(id int, userID int) error
+	Trashed(userID int) ([]Snippet, error)
+	Purge(retention time.Duration) (int, error)
+	DeleteExpired(before time.Time, limit int) (int, error)
+	Browse(q SnippetQuery) (SnippetPage, error)
+	Search(q SearchQuery) (SearchPage, error)
 }
 
+// The formats which a snippet's content can be displayed in.
+const (
+	FormatPlain    = "plain"
+	FormatCode     = "code"
+	FormatMarkdown = "markdown"
+)
+
+// SnippetFormats lists the permitted values for Snippet.Format.
+var SnippetFormats = []string{FormatPlain, FormatCode, FormatMarkdown}
+
+// FormatEncrypted is the format of end-to-end encrypted snippets. Their
+// content is ciphertext, which is encrypted and decrypted in the browser
+// with a key that's never sent to the server. It isn't in SnippetFormats
+// because the other formats can't be changed into it.
+const FormatEncrypted = "encrypted"
+
+// The visibility levels of a snippet. Public snippets are listed on the home
+// page and in search results, unlisted snippets can only be reached by
+// following a link to them, and private snippets can only be viewed by their
+// author.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// SnippetVisibilities lists the permitted values for Snippet.Visibility.
+var SnippetVisibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
 // Define a Snippet type to hold the data for an individual snippet. Notice how
 // the fields of the struct correspond to the fields in our MySQL snippets
 // table?
 type Snippet struct {
-	ID      int
+	ID int
+	// Slug is the random identifier used in the snippet's URLs, so that
+	// snippets can't be found by counting up through the IDs.
+	Slug    string
+	UserID  int
 	Title   string
 	Content string
-	Created time.Time
+	// Format is one of the SnippetFormats values, and controls how the
+	// content is displayed.
+	Format string
+	// Language is the name of the language used to highlight the content
+	// (see the highlight package), or the empty string if it should be
+	// detected automatically.
+	Language string
+	// Visibility is one of the SnippetVisibilities values.
+	Visibility string
+	// Protected is true if the snippet has an access password, which has to
+	// be entered before anybody other than its author can read it. The
+	// password hash itself is never loaded into a Snippet.
+	Protected bool
+	// ViewsLeft is the number of times a "burn after reading" snippet can
+	// still be viewed before it's deleted, or 0 if its views aren't limited.
+	ViewsLeft int
+	// ForkedFrom is the ID of the snippet this one was forked from, or 0 if
+	// it wasn't forked (or the original has since been deleted).
+	ForkedFrom int
+	// StarCount is the number of users who have starred the snippet. It's
+	// kept up to date by the StarModel.
+	StarCount int
+	// ViewCount is the number of times the snippet has been viewed. It's
+	// kept up to date by the ViewModel, which only adds views in batches, so
+	// it can be a little behind.
+	ViewCount int
+	Created   time.Time
+	// Updated is the time the snippet was created or last edited.
+	Updated time.Time
+	// Expires is far in the future for snippets which never expire (see
+	// NeverExpires()).
 	Expires time.Time
+	// Version is incremented every time the snippet is edited. It's used for
+	// optimistic locking, so that concurrent edits can't silently overwrite
+	// each other.
+	Version int
+	// Deleted holds the time the snippet was moved to the trash, or the zero
+	// time if it hasn't been.
+	Deleted time.Time
+	// Tags isn't stored in the snippets table; it's filled in from the
+	// TagModel when needed.
+	Tags []string
+	// Files holds the extra files of a multi-file snippet. Like Tags, it's
+	// filled in from the SnippetFileModel when needed.
+	Files []SnippetFile
+	// CommentCount is the number of comments on the snippet, including
+	// replies. It's filled in from the CommentModel for the listing pages.
+	CommentCount int
+}
+
+// snippetColumns lists the columns selected by every snippet query, in the
+// order expected by scanSnippet().
+const snippetColumns = `id, slug, IFNULL(user_id, 0), title, content, format, language, visibility, hashed_password IS NOT NULL, IFNULL(views_left, 0), IFNULL(forked_from, 0), star_count, view_count, created, updated, expires, version, deleted`
+
+// listedSnippets is the condition for a snippet to appear in the listings:
+// it must be public, unexpired and not in the trash.
+const listedSnippets = `visibility = 'public' AND expires > UTC_TIMESTAMP() AND deleted IS NULL`
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSnippet copies the snippetColumns from a row into a new Snippet.
+func scanSnippet(row rowScanner) (Snippet, error) {
+	var s Snippet
+	var deleted sql.NullTime
+
+	err := row.Scan(&s.ID, &s.Slug, &s.UserID, &s.Title, &s.Content, &s.Format, &s.Language, &s.Visibility, &s.Protected, &s.ViewsLeft, &s.ForkedFrom, &s.StarCount, &s.ViewCount, &s.Created, &s.Updated, &s.Expires, &s.Version, &deleted)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	s.Deleted = deleted.Time
+	return s, nil
+}
+
+// querySnippets runs a query which selects the snippetColumns and returns
+// the resulting snippets.
+func (m *SnippetModel) querySnippets(stmt string, args ...any) ([]Snippet, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Expired() returns true if the snippet's expiry time has already passed.
+func (s Snippet) Expired() bool {
+	return !s.Expires.After(time.Now())
+}
+
+// neverExpires is stored as the expiry time of snippets which never expire.
+// It's the latest time a DATETIME column can hold. Using a real time rather
+// than NULL means that the expiry checks in the queries, the indexes on the
+// expires column and the keyset pagination all keep working unchanged.
+var neverExpires = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// Encrypted() returns true if the snippet is end-to-end encrypted, so that
+// its content is ciphertext which the server can't read.
+func (s Snippet) Encrypted() bool {
+	return s.Format == FormatEncrypted
+}
+
+// Commentable() returns true if comments can be posted on the snippet. They
+// can't be posted on encrypted snippets, because they'd be readable by the
+// server, or on view-limited snippets, which are deleted once they've been
+// read.
+func (s Snippet) Commentable() bool {
+	return !s.Encrypted() && s.ViewsLeft == 0
+}
+
+// NeverExpires() returns true if the snippet was created without an expiry
+// time.
+func (s Snippet) NeverExpires() bool {
+	return s.Expires.Equal(neverExpires)
+}
+
+// expiresValue converts the expiry time passed to Insert() or Update() into
+// the value stored in the expires column. A nil time means that the snippet
+// never expires.
+func expiresValue(expires *time.Time) time.Time {
+	if expires == nil {
+		return neverExpires
+	}
+	return expires.UTC()
+}
+
+// Define a SnippetEdit type to hold everything which the create and edit
+// forms set on a snippet, so that SnippetModel.Insert() and Update() can save
+// it all together.
+type SnippetEdit struct {
+	Title      string
+	Content    string
+	Format     string
+	Language   string
+	Visibility string
+	// Expires is nil if the snippet never expires.
+	Expires *time.Time
+	// Tags should already have been normalized (see validator.NormalizeList()).
+	Tags  []string
+	Files []SnippetFile
+	// Password is a new access password, or "" to keep the current one (or,
+	// for a new snippet, not to have one). RemovePassword removes the
+	// password instead, and is ignored by Insert().
+	Password       string
+	RemovePassword bool
+	// ViewLimit is the number of views the snippet has left, or 0 for no
+	// limit. Update() only saves it if ChangeViewLimit is true, so that the
+	// count doesn't start again every time the snippet is edited.
+	ViewLimit       int
+	ChangeViewLimit bool
+}
+
+// VisibleTo() returns true if the snippet can be viewed by the user with the
+// given ID. Anonymous users have the ID 0, which never owns a snippet.
+func (s Snippet) VisibleTo(userID int) bool {
+	return s.Visibility != VisibilityPrivate || (userID != 0 && s.UserID == userID)
 }
 
 // Define a SnippetModel type which wraps a sql.DB connection pool.
@@ -28,42 +262,239 @@ type SnippetModel struct {
 	DB *sql.DB
 }
 
-// This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// This will insert a new snippet into the database, along with its tags and
+// files, returning its ID and slug. The userID is the ID of the authenticated
+// user who created the snippet. The snippet's access password and view limit
+// are saved in the same statement as the snippet, so that a protected or
+// "burn after reading" snippet is never readable without them, even briefly.
+func (m *SnippetModel) Insert(snippet SnippetEdit, userID int) (int, string, error) {
+	// As in Update(), the password is hashed before the transaction starts.
+	hashedPassword, err := hashPassword(snippet.Password)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The tags and files are saved in the same transaction, so that if
+	// anything fails there's no half-created snippet left behind.
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
 	// Write the SQL statement we want to execute. I've split it over two lines
 	// for readability (which is why it's surrounded with backquotes instead
 	// of normal double quotes).
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-    VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	stmt := `INSERT INTO snippets (slug, user_id, title, content, format, language, visibility, hashed_password, views_left, created, updated, expires)
+    VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?)`
 
-	// Use the Exec() method on the embedded connection pool to execute the
-	// statement. The first parameter is the SQL statement, followed by the
-	// values for the placeholder parameters: title, content and expiry in
-	// that order. This method returns a sql.Result type, which contains some
-	// basic information about what happened when the statement was executed.
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	// The insertWithSlug() helper fills in the slug, which is always the
+	// first placeholder. The rest of the placeholder parameters are the
+	// owner, title, content, format, language, visibility, password hash,
+	// view limit and expiry in that order.
+	id, slug, err := insertWithSlug(tx, "snippets_uc_slug", stmt, userID, snippet.Title, snippet.Content, snippet.Format, snippet.Language, snippet.Visibility, hashedPassword, viewsLeftValue(snippet.ViewLimit), expiresValue(snippet.Expires))
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 
-	// Use the LastInsertId() method on the result to get the ID of our
-	// newly inserted record in the snippets table.
-	id, err := result.LastInsertId()
+	err = setTags(tx, id, snippet.Tags)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 
-	// The ID returned has the type int64, so we convert it to an int type
-	// before returning.
-	return int(id), nil
+	err = setFiles(tx, id, snippet.Files)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return id, slug, nil
+}
+
+// insertWithSlug runs an INSERT statement for a new row, using a new random
+// slug as the value for its first placeholder parameter, and returns the new
+// row's ID and slug. It's used for snippets and collections, and constraint
+// is the name of the unique index on the table's slug column. The statement
+// is run on db, which can be a transaction.
+func insertWithSlug(db execer, constraint string, stmt string, args ...any) (int, string, error) {
+	// Slugs are random, so there's a very small chance that one is already
+	// in use. The unique index on the slug column catches that, and we try
+	// again with a new slug. Because the INSERT failed nothing was written,
+	// so it's always safe to retry, even in a transaction: MySQL only rolls
+	// back the failed statement.
+	for range maxSlugAttempts {
+		slug, err := newSlug()
+		if err != nil {
+			return 0, "", err
+		}
+
+		// Use the Exec() method on the embedded connection pool to execute
+		// the statement. The first parameter is the SQL statement, followed
+		// by the values for the placeholder parameters. This method returns a
+		// sql.Result type, which contains some basic information about what
+		// happened when the statement was executed.
+		result, err := db.Exec(stmt, append([]any{slug}, args...)...)
+		if err != nil {
+			var mySQLError *mysql.MySQLError
+			if errors.As(err, &mySQLError) {
+				if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, constraint) {
+					continue
+				}
+			}
+			return 0, "", err
+		}
+
+		// An INSERT ... SELECT statement inserts nothing if the SELECT
+		// doesn't find a row.
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, "", err
+		}
+		if n == 0 {
+			return 0, "", ErrNoRecord
+		}
+
+		// Use the LastInsertId() method on the result to get the ID of our
+		// newly inserted record.
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, "", err
+		}
+
+		// The ID returned has the type int64, so we convert it to an int type
+		// before returning.
+		return int(id), slug, nil
+	}
+
+	return 0, "", fmt.Errorf("models: no unique slug found after %d attempts", maxSlugAttempts)
+}
+
+// This will create a copy of the snippet with the given ID, owned by the user
+// with the given userID, and return the new snippet's ID and slug. The copy
+// keeps the title, content, format, language, visibility, tags and files of
+// the original, and records which snippet it was forked from. It doesn't get
+// the original's password or view limit, and expires is its expiry time, or
+// nil if it never expires. If the original has expired or is in the trash,
+// ErrNoRecord is returned.
+//
+// Because the password isn't copied, the fork of a password-protected
+// snippet is made private, so that its content doesn't become readable by
+// everybody. Its author can choose another visibility, or a password of
+// their own, on the edit page.
+//
+// Copying the rows with INSERT ... SELECT in a single transaction means that
+// the fork is made from the current version of the original, even if it's
+// edited while the fork is being made, and that a failure part way through
+// doesn't leave a fork without its tags or files.
+func (m *SnippetModel) Fork(id int, userID int, expires *time.Time) (int, string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippets (slug, user_id, title, content, format, language, visibility, forked_from, created, updated, expires)
+    SELECT ?, ?, title, content, format, language, IF(hashed_password IS NULL, visibility, 'private'), id, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ? FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND deleted IS NULL AND id = ?`
+
+	forkID, slug, err := insertWithSlug(tx, "snippets_uc_slug", stmt, userID, expiresValue(expires), id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	stmt = `INSERT INTO snippet_tags (snippet_id, tag_id)
+    SELECT ?, tag_id FROM snippet_tags WHERE snippet_id = ?`
+
+	_, err = tx.Exec(stmt, forkID, id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	stmt = `INSERT INTO snippet_files (snippet_id, position, name, content)
+    SELECT ?, position, name, content FROM snippet_files WHERE snippet_id = ?`
+
+	_, err = tx.Exec(stmt, forkID, id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return forkID, slug, nil
+}
+
+// This will return the listed forks of the snippet with the given ID, newest
+// first. Unlisted and private forks are left out, so that the original's
+// page can't be used to find them.
+func (m *SnippetModel) Forks(id int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE ` + listedSnippets + ` AND forked_from = ? ORDER BY id DESC`
+
+	return m.querySnippets(stmt, id)
+}
+
+// The length of a snippet slug, and the characters it's made from. Ten
+// base62 characters give around 8×10^17 possible slugs, which is far too
+// many to guess.
+const (
+	slugLength   = 10
+	slugAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// The number of slugs insertWithSlug() tries before giving up.
+const maxSlugAttempts = 5
+
+// newSlug returns a new random slug. It's a variable so that the tests can
+// replace it to force collisions.
+var newSlug = randomSlug
+
+// randomSlug generates a slug using crypto/rand. Bytes which would make some
+// characters more likely than others are thrown away. Slugs made only of
+// digits are also thrown away, so that a slug can never be mistaken for one
+// of the old integer IDs.
+func randomSlug() (string, error) {
+	// The largest multiple of len(slugAlphabet) which fits in a byte.
+	const limit = 256 - 256%len(slugAlphabet)
+
+	slug := make([]byte, 0, slugLength)
+	buf := make([]byte, 2*slugLength)
+
+	for {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return "", err
+		}
+
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			slug = append(slug, slugAlphabet[int(b)%len(slugAlphabet)])
+
+			if len(slug) == slugLength {
+				if strings.Trim(string(slug), "0123456789") == "" {
+					slug = slug[:0]
+					continue
+				}
+				return string(slug), nil
+			}
+		}
+	}
 }
 
 // This will return a specific snippet based on its id.
 func (m *SnippetModel) Get(id int) (Snippet, error) {
 	// Write the SQL statement we want to execute. Again, I've split it over two
 	// lines for readability.
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND deleted IS NULL AND id = ?`
 
 	// Use the QueryRow() method on the connection pool to execute our
 	// SQL statement, passing in the untrusted id variable as the value for the
@@ -71,15 +502,9 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 	// holds the result from the database.
 	row := m.DB.QueryRow(stmt, id)
 
-	// Initialize a new zeroed Snippet struct.
-	var s Snippet
-
-	// Use row.Scan() to copy the values from each field in sql.Row to the
-	// corresponding field in the Snippet struct. Notice that the arguments
-	// to row.Scan are *pointers* to the place you want to copy the data into,
-	// and the number of arguments must be exactly the same as the number of
-	// columns returned by your statement.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	// Use the scanSnippet() helper to copy the values from each field in
+	// sql.Row to the corresponding field in a new Snippet struct.
+	s, err := scanSnippet(row)
 	if err != nil {
 		// If the query returns no rows, then row.Scan() will return a
 		// sql.ErrNoRows error. We use the errors.Is() function check for that
@@ -96,11 +521,31 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 	return s, nil
 }
 
-// This will return the 10 most recently created snippets.
+// This will return the snippet with the given slug, but only if it can be
+// viewed by the user with the given ID (or 0 for an anonymous user). Private
+// snippets belonging to somebody else are treated as if they don't exist, so
+// that their slugs can't be probed.
+func (m *SnippetModel) GetVisible(slug string, viewerID int) (Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND deleted IS NULL AND slug = ?
+    AND (visibility <> 'private' OR user_id = ?)`
+
+	s, err := scanSnippet(m.DB.QueryRow(stmt, slug, viewerID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, ErrNoRecord
+		}
+		return Snippet{}, err
+	}
+
+	return s, nil
+}
+
+// This will return the 10 most recently created public snippets.
 func (m *SnippetModel) Latest() ([]Snippet, error) {
 	// Write the SQL statement we want to execute.
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-    WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE ` + listedSnippets + ` ORDER BY id DESC LIMIT 10`
 
 	// Use the Query() method on the connection pool to execute our
 	// SQL statement. This returns a sql.Rows resultset containing the result of
@@ -126,14 +571,9 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	// resultset automatically closes itself and frees-up the underlying
 	// database connection.
 	for rows.Next() {
-		// Create a pointer to a new zeroed Snippet struct.
-		var s Snippet
-		// Use rows.Scan() to copy the values from each field in the row to the
-		// new Snippet object that we created. Again, the arguments to row.Scan()
-		// must be pointers to the place you want to copy the data into, and the
-		// number of arguments must be exactly the same as the number of
-		// columns returned by your statement.
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		// Use scanSnippet() to copy the values from each field in the row to
+		// a new Snippet object.
+		s, err := scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -152,3 +592,504 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	// If everything went OK then return the Snippets slice.
 	return snippets, nil
 }
+
+// This will return every snippet created by a specific user, newest first.
+// Unlike Latest() it doesn't filter on the expiry time, so that the owner can
+// still see (and later act on) snippets which have already expired. Snippets
+// in the trash are left out; use Trashed() for those.
+func (m *SnippetModel) ByUser(userID int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE user_id = ? AND deleted IS NULL ORDER BY id DESC`
+
+	return m.querySnippets(stmt, userID)
+}
+
+// This will return the snippets which a user has starred, most recently
+// starred first. Snippets which have expired or been moved to the trash are
+// left out, along with other users' snippets which have since been made
+// private.
+func (m *SnippetModel) Starred(userID int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    INNER JOIN (SELECT snippet_id, created AS starred FROM stars WHERE user_id = ?) s ON s.snippet_id = snippets.id
+    WHERE deleted IS NULL AND expires > UTC_TIMESTAMP() AND (visibility <> 'private' OR user_id = ?)
+    ORDER BY s.starred DESC, id DESC`
+
+	return m.querySnippets(stmt, userID, userID)
+}
+
+// This will return the snippets in a collection, in the collection's order.
+// Only the snippets which the user with the given ID (or 0 for an anonymous
+// user) can view are returned, so that sharing a collection doesn't share the
+// private snippets in it. Expired snippets and snippets in the trash are
+// left out too.
+func (m *SnippetModel) InCollection(collectionID int, viewerID int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    INNER JOIN (SELECT snippet_id, position FROM collection_snippets WHERE collection_id = ?) c ON c.snippet_id = snippets.id
+    WHERE expires > UTC_TIMESTAMP() AND deleted IS NULL AND (visibility <> 'private' OR user_id = ?)
+    ORDER BY c.position`
+
+	return m.querySnippets(stmt, collectionID, viewerID)
+}
+
+// This will return up to limit listed snippets with the most views in the
+// given period (one of the TrendingPeriods), most viewed first. Recent views
+// count for more than older ones, as described by trendingSpec.
+func (m *SnippetModel) Trending(period string, limit int) ([]Snippet, error) {
+	spec, ok := trendingSpecs[period]
+	if !ok {
+		return nil, fmt.Errorf("models: unknown trending period %q", period)
+	}
+
+	// Each hour's views are weighted by their age at the middle of the hour,
+	// which is when they were on average.
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    INNER JOIN (SELECT snippet_id,
+        SUM(views * POW(0.5, (TIMESTAMPDIFF(SECOND, hour, UTC_TIMESTAMP()) - 1800) / ?)) AS score
+        FROM snippet_views WHERE hour > UTC_TIMESTAMP() - INTERVAL ? SECOND
+        GROUP BY snippet_id) v ON v.snippet_id = snippets.id
+    WHERE ` + listedSnippets + `
+    ORDER BY v.score DESC, id DESC LIMIT ?`
+
+	return m.querySnippets(stmt, spec.halfLife.Seconds(), int(spec.window.Seconds()), limit)
+}
+
+// This will save an edit of an existing snippet: its title, content, expiry
+// and other settings, along with its tags and files. The version must match
+// the version of the snippet currently stored in the database; if it doesn't,
+// somebody else has edited the snippet since it was read and ErrEditConflict
+// is returned instead of overwriting their changes. The previous title and
+// content are kept in the snippet_revisions table.
+func (m *SnippetModel) Update(id int, edit SnippetEdit, version int) error {
+	// Hashing a new password is slow, so it's done before the transaction
+	// starts rather than while it's holding locks.
+	var hashedPassword sql.NullString
+	if edit.Password != "" && !edit.RemovePassword {
+		var err error
+		hashedPassword, err = hashPassword(edit.Password)
+		if err != nil {
+			return err
+		}
+	}
+
+	// All of the statements need to succeed or fail together, so that a
+	// failure part way through doesn't leave the snippet on a new version
+	// with only some of the edit saved. Calling Rollback() after a
+	// successful Commit() is a no-op.
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Copy the current version of the snippet into the revisions table. If
+	// the version doesn't match then nothing is copied, and the UPDATE below
+	// will report the conflict.
+	stmt := `INSERT INTO snippet_revisions (snippet_id, version, title, content, created)
+    SELECT id, version, title, content, UTC_TIMESTAMP() FROM snippets
+    WHERE id = ? AND version = ?`
+
+	_, err = tx.Exec(stmt, id, version)
+	if err != nil {
+		return err
+	}
+
+	stmt = `UPDATE snippets SET title = ?, content = ?, format = ?, language = ?, visibility = ?, updated = UTC_TIMESTAMP(),
+    expires = ?, version = version + 1
+    WHERE id = ? AND version = ?`
+
+	result, err := tx.Exec(stmt, edit.Title, edit.Content, edit.Format, edit.Language, edit.Visibility, expiresValue(edit.Expires), id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// If no rows were affected then either the snippet doesn't exist or its
+	// version has moved on. Our callers always fetch the snippet first, so we
+	// treat this as a conflict.
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	if edit.RemovePassword || edit.Password != "" {
+		_, err = tx.Exec(`UPDATE snippets SET hashed_password = ? WHERE id = ?`, hashedPassword, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if edit.ChangeViewLimit {
+		_, err = tx.Exec(`UPDATE snippets SET views_left = ? WHERE id = ?`, viewsLeftValue(edit.ViewLimit), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = setTags(tx, id, edit.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = setFiles(tx, id, edit.Files)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// hashPassword hashes a snippet's access password for the hashed_password
+// column, with bcrypt in the same way as user passwords. An empty password is
+// stored as NULL.
+func hashPassword(password string) (sql.NullString, error) {
+	if password == "" {
+		return sql.NullString{}, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(hash), Valid: true}, nil
+}
+
+// This will check the access password of a snippet. If the password is wrong
+// ErrInvalidCredentials is returned. If the snippet doesn't have a password
+// there's nothing to unlock, and nil is returned.
+func (m *SnippetModel) Unlock(id int, password string) error {
+	var hashedPassword sql.NullString
+
+	stmt := `SELECT hashed_password FROM snippets WHERE id = ?`
+
+	err := m.DB.QueryRow(stmt, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if !hashedPassword.Valid {
+		return nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword.String), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	return nil
+}
+
+// viewsLeftValue converts a view limit into the value stored in the
+// views_left column. A limit of 0 is stored as NULL.
+func viewsLeftValue(views int) sql.NullInt64 {
+	if views <= 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(views), Valid: true}
+}
+
+// This will count a view of a snippet whose views are limited, deleting the
+// snippet if it was the last view. The snippet is returned as it was before
+// the view was counted, so its ViewsLeft is 1 if it has just been deleted.
+// Snippets without a view limit are returned unchanged.
+func (m *SnippetModel) View(id int) (Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Snippet{}, err
+	}
+	defer tx.Rollback()
+
+	// The FOR UPDATE clause locks the row until the transaction ends, so if
+	// two people view the snippet at the same time the second one waits
+	// here, and then reads the count left by the first. This stops both of
+	// them being given the last view.
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE expires > UTC_TIMESTAMP() AND deleted IS NULL AND id = ?
+    FOR UPDATE`
+
+	s, err := scanSnippet(tx.QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, ErrNoRecord
+		}
+		return Snippet{}, err
+	}
+
+	switch {
+	case s.ViewsLeft == 0:
+		return s, nil
+	case s.ViewsLeft == 1:
+		// Burned snippets are deleted outright rather than moved to the
+		// trash, along with their tags, files and revisions.
+		_, err = tx.Exec(`DELETE FROM snippets WHERE id = ?`, id)
+	default:
+		_, err = tx.Exec(`UPDATE snippets SET views_left = views_left - 1 WHERE id = ?`, id)
+	}
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	return s, nil
+}
+
+// This will move a snippet to the trash. The row is kept, so the snippet can
+// be restored until it's purged.
+func (m *SnippetModel) Delete(id int) error {
+	stmt := `UPDATE snippets SET deleted = UTC_TIMESTAMP() WHERE id = ? AND deleted IS NULL`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will take a snippet back out of the trash. Only the user who owns the
+// snippet can restore it; if the snippet isn't in that user's trash then
+// ErrNoRecord is returned.
+func (m *SnippetModel) Restore(id int, userID int) error {
+	stmt := `UPDATE snippets SET deleted = NULL
+    WHERE id = ? AND user_id = ? AND deleted IS NOT NULL`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will return the snippets in a user's trash, most recently deleted
+// first.
+func (m *SnippetModel) Trashed(userID int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE user_id = ? AND deleted IS NOT NULL ORDER BY deleted DESC`
+
+	return m.querySnippets(stmt, userID)
+}
+
+// This will permanently delete every snippet which has been in the trash for
+// longer than the retention period, returning the number of snippets removed.
+func (m *SnippetModel) Purge(retention time.Duration) (int, error) {
+	stmt := `DELETE FROM snippets
+    WHERE deleted < DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)`
+
+	result, err := m.DB.Exec(stmt, int(retention.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// This will permanently delete up to limit snippets which expired before the
+// given time, returning the number deleted. Deleting a few at a time keeps
+// each statement short, so that it doesn't hold locks on the table for long.
+// The snippets which expired first are deleted first, using the index on the
+// expires column.
+func (m *SnippetModel) DeleteExpired(before time.Time, limit int) (int, error) {
+	stmt := `DELETE FROM snippets WHERE expires <= ? ORDER BY expires, id LIMIT ?`
+
+	result, err := m.DB.Exec(stmt, before.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+// This will return a page of the public snippets which haven't expired, sorted as
+// requested. Pages are located using keyset pagination: rather than using an
+// OFFSET, which gets slower the further through the listing you go, each
+// cursor records the sort key of the snippet at the edge of a page and the
+// next query picks up from there using an index.
+func (m *SnippetModel) Browse(q SnippetQuery) (SnippetPage, error) {
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+
+	spec, ok := sortSpecs[q.Sort]
+	if !ok {
+		return SnippetPage{}, fmt.Errorf("models: unknown sort order %q", q.Sort)
+	}
+
+	limit := q.Limit
+	if limit < 1 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	where := listedSnippets
+	var args []any
+	backward := false
+
+	if q.Tag != "" {
+		where += ` AND id IN (SELECT st.snippet_id FROM snippet_tags st
+        INNER JOIN tags t ON t.id = st.tag_id WHERE t.name = ?)`
+		args = append(args, q.Tag)
+	}
+
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor, q.Sort)
+		if err != nil {
+			return SnippetPage{}, err
+		}
+		backward = c.direction == cursorBefore
+
+		key, err := c.key()
+		if err != nil {
+			return SnippetPage{}, ErrInvalidCursor
+		}
+
+		// Moving forwards through an ascending sort (or backwards through a
+		// descending one) means looking for larger keys.
+		op := "<"
+		if spec.descending == backward {
+			op = ">"
+		}
+
+		if spec.column == "id" {
+			where += ` AND id ` + op + ` ?`
+			args = append(args, c.id)
+		} else {
+			where += fmt.Sprintf(` AND (%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))`, spec.column, op)
+			args = append(args, key, key, c.id)
+		}
+	}
+
+	// When moving backwards we read the rows in reverse order, so that the
+	// LIMIT picks the ones closest to the cursor, and then flip them round.
+	direction := "ASC"
+	if spec.descending != backward {
+		direction = "DESC"
+	}
+
+	order := spec.column + " " + direction
+	if spec.column != "id" {
+		order += ", id " + direction
+	}
+
+	// Fetch one more row than we need so we know whether there's another
+	// page after this one.
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE ` + where + ` ORDER BY ` + order + ` LIMIT ?`
+	args = append(args, limit+1)
+
+	snippets, err := m.querySnippets(stmt, args...)
+	if err != nil {
+		return SnippetPage{}, err
+	}
+
+	more := len(snippets) > limit
+	if more {
+		snippets = snippets[:limit]
+	}
+	if backward {
+		slices.Reverse(snippets)
+	}
+
+	page := SnippetPage{Snippets: snippets}
+
+	if len(snippets) > 0 {
+		first, last := snippets[0], snippets[len(snippets)-1]
+
+		// We only get to a page by moving away from another one, so there's
+		// always a page in the direction we came from.
+		if backward {
+			page.Next = spec.cursorFor(q.Sort, cursorAfter, last)
+			if more {
+				page.Prev = spec.cursorFor(q.Sort, cursorBefore, first)
+			}
+		} else {
+			if more {
+				page.Next = spec.cursorFor(q.Sort, cursorAfter, last)
+			}
+			if q.Cursor != "" {
+				page.Prev = spec.cursorFor(q.Sort, cursorBefore, first)
+			}
+		}
+	}
+
+	return page, nil
+}
+
+// This will return a page of the unexpired public snippets matching a search, most
+// relevant first. It uses the FULLTEXT index on the title and content
+// columns. Because the relevance score is worked out for each query there's
+// no index to seek on, so unlike Browse() this uses plain OFFSET pagination.
+// Password-protected and view-limited snippets are left out, because
+// otherwise their content could be worked out by searching for it, and so
+// are encrypted snippets, whose content is meaningless ciphertext.
+func (m *SnippetModel) Search(q SearchQuery) (SearchPage, error) {
+	page, limit := q.Bounds()
+
+	if q.Terms.Empty() {
+		return SearchPage{Page: page}, nil
+	}
+
+	expr := q.Terms.booleanQuery()
+
+	// Fetch one more row than we need so we know whether there's another
+	// page after this one.
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+    WHERE MATCH(title, content) AGAINST(? IN BOOLEAN MODE)
+    AND ` + listedSnippets + ` AND hashed_password IS NULL AND views_left IS NULL
+    AND format <> 'encrypted'
+    ORDER BY MATCH(title, content) AGAINST(? IN BOOLEAN MODE) DESC, id DESC
+    LIMIT ? OFFSET ?`
+
+	snippets, err := m.querySnippets(stmt, expr, expr, limit+1, (page-1)*limit)
+	if err != nil {
+		return SearchPage{}, err
+	}
+
+	more := len(snippets) > limit
+	if more {
+		snippets = snippets[:limit]
+	}
+
+	return SearchPage{Snippets: snippets, Page: page, HasNext: more}, nil
+}
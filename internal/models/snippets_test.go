@@ -0,0 +1,508 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestSnippetVisibleTo(t *testing.T) {
+	tests := []struct {
+		name       string
+		visibility string
+		userID     int
+		want       bool
+	}{
+		{
+			name:       "Public to anonymous user",
+			visibility: VisibilityPublic,
+			userID:     0,
+			want:       true,
+		},
+		{
+			name:       "Unlisted to anonymous user",
+			visibility: VisibilityUnlisted,
+			userID:     0,
+			want:       true,
+		},
+		{
+			name:       "Private to author",
+			visibility: VisibilityPrivate,
+			userID:     1,
+			want:       true,
+		},
+		{
+			name:       "Private to another user",
+			visibility: VisibilityPrivate,
+			userID:     2,
+			want:       false,
+		},
+		{
+			name:       "Private to anonymous user",
+			visibility: VisibilityPrivate,
+			userID:     0,
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Snippet{UserID: 1, Visibility: tt.visibility}
+
+			assert.Equal(t, s.VisibleTo(tt.userID), tt.want)
+		})
+	}
+}
+
+func TestSnippetModelGetVisible(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+	expires := time.Now().Add(7 * 24 * time.Hour)
+
+	public, publicSlug, err := m.Insert(SnippetEdit{Title: "Public", Content: "Public...", Format: FormatCode, Visibility: VisibilityPublic, Expires: &expires}, 1)
+	assert.NilError(t, err)
+	private, privateSlug, err := m.Insert(SnippetEdit{Title: "Private", Content: "Private...", Format: FormatCode, Visibility: VisibilityPrivate, Expires: &expires}, 1)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name     string
+		slug     string
+		viewerID int
+		wantID   int
+		wantErr  error
+	}{
+		{
+			name:     "Public to anonymous user",
+			slug:     publicSlug,
+			viewerID: 0,
+			wantID:   public,
+		},
+		{
+			name:     "Private to author",
+			slug:     privateSlug,
+			viewerID: 1,
+			wantID:   private,
+		},
+		{
+			name:     "Private to another user",
+			slug:     privateSlug,
+			viewerID: 2,
+			wantErr:  ErrNoRecord,
+		},
+		{
+			name:     "Private to anonymous user",
+			slug:     privateSlug,
+			viewerID: 0,
+			wantErr:  ErrNoRecord,
+		},
+		{
+			name:     "Slug with different case",
+			slug:     strings.ToUpper(publicSlug),
+			viewerID: 0,
+			wantErr:  ErrNoRecord,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := m.GetVisible(tt.slug, tt.viewerID)
+
+			assert.Equal(t, errors.Is(err, tt.wantErr), true)
+			if tt.wantErr == nil {
+				assert.Equal(t, s.ID, tt.wantID)
+			}
+		})
+	}
+
+	// Only the public snippet should be listed.
+	snippets, err := m.Latest()
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].ID, public)
+}
+
+func TestSnippetModelInsert(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+
+	id, _, err := m.Insert(SnippetEdit{Title: "Secret", Content: "Secret...", Format: FormatPlain, Visibility: VisibilityPublic, Tags: []string{"go"}, Password: "open sesame", ViewLimit: 3}, 1)
+	assert.NilError(t, err)
+
+	// The snippet is protected and its views are limited as soon as it
+	// exists.
+	s, err := m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Protected, true)
+	assert.Equal(t, s.ViewsLeft, 3)
+	assert.Equal(t, errors.Is(m.Unlock(id, "wrong"), ErrInvalidCredentials), true)
+	assert.NilError(t, m.Unlock(id, "open sesame"))
+
+	tags := TagModel{db}
+	tagList, err := tags.ForSnippet(id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tagList), 1)
+	assert.Equal(t, tagList[0], "go")
+
+	// If any part of the snippet can't be saved, none of it is. Here the
+	// files have the same name.
+	_, _, err = m.Insert(SnippetEdit{
+		Title:      "Broken",
+		Content:    "Broken...",
+		Format:     FormatCode,
+		Visibility: VisibilityPublic,
+		Tags:       []string{"broken"},
+		Files:      []SnippetFile{{Name: "main.go", Content: "a"}, {Name: "main.go", Content: "b"}},
+	}, 1)
+	assert.Equal(t, err != nil, true)
+
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM snippets WHERE title = 'Broken'`).Scan(&n)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+
+	err = db.QueryRow(`SELECT COUNT(*) FROM tags WHERE name = 'broken'`).Scan(&n)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+}
+
+func TestSnippetModelInsertSlugCollision(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+	expires := time.Now().Add(7 * 24 * time.Hour)
+
+	// Hand out the same slug twice before falling back to random ones, so
+	// that the second snippet has to retry.
+	slugs := []string{"aaaaaaaaaa", "aaaaaaaaaa"}
+	newSlug = func() (string, error) {
+		if len(slugs) > 0 {
+			slug := slugs[0]
+			slugs = slugs[1:]
+			return slug, nil
+		}
+		return randomSlug()
+	}
+	t.Cleanup(func() { newSlug = randomSlug })
+
+	_, first, err := m.Insert(SnippetEdit{Title: "First", Content: "First...", Format: FormatCode, Visibility: VisibilityPublic, Expires: &expires}, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, first, "aaaaaaaaaa")
+
+	_, second, err := m.Insert(SnippetEdit{Title: "Second", Content: "Second...", Format: FormatCode, Visibility: VisibilityPublic, Expires: &expires}, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, second != first, true)
+}
+
+func TestRandomSlug(t *testing.T) {
+	seen := make(map[string]bool)
+
+	for range 1000 {
+		slug, err := randomSlug()
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(slug), slugLength)
+		assert.Equal(t, strings.Trim(slug, slugAlphabet), "")
+		assert.Equal(t, strings.Trim(slug, "0123456789") != "", true)
+		assert.Equal(t, seen[slug], false)
+
+		seen[slug] = true
+	}
+}
+
+func TestSnippetModelView(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+	expires := time.Now().Add(7 * 24 * time.Hour)
+
+	id, _, err := m.Insert(SnippetEdit{Title: "Burn", Content: "Burn...", Format: FormatPlain, Visibility: VisibilityUnlisted, Expires: &expires, ViewLimit: 2}, 1)
+	assert.NilError(t, err)
+
+	// Each view returns the snippet as it was before the view.
+	s, err := m.View(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.ViewsLeft, 2)
+
+	s, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.ViewsLeft, 1)
+
+	// When two people take the last view at the same time, only one of them
+	// gets it.
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = m.View(id)
+		}()
+	}
+	wg.Wait()
+
+	viewed := 0
+	for _, err := range errs {
+		if err == nil {
+			viewed++
+		} else {
+			assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+		}
+	}
+	assert.Equal(t, viewed, 1)
+
+	_, err = m.Get(id)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestSnippetModelUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	m := SnippetModel{db}
+	tags := TagModel{db}
+	files := SnippetFileModel{db}
+	expires := time.Now().Add(7 * 24 * time.Hour)
+
+	id, _, err := m.Insert(SnippetEdit{Title: "First", Content: "First...", Format: FormatCode, Visibility: VisibilityPublic, Expires: &expires}, 1)
+	assert.NilError(t, err)
+
+	edit := SnippetEdit{
+		Title:           "Second",
+		Content:         "Second...",
+		Format:          FormatCode,
+		Visibility:      VisibilityUnlisted,
+		Expires:         &expires,
+		Tags:            []string{"go"},
+		Files:           []SnippetFile{{Name: "main.go", Content: "package main"}},
+		Password:        "open sesame",
+		ViewLimit:       3,
+		ChangeViewLimit: true,
+	}
+	assert.NilError(t, m.Update(id, edit, 1))
+
+	s, err := m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Title, "Second")
+	assert.Equal(t, s.Version, 2)
+	assert.Equal(t, s.Protected, true)
+	assert.Equal(t, s.ViewsLeft, 3)
+
+	// If any part of an edit fails, none of it is saved, so it can be tried
+	// again with the same version. Here the files have the same name.
+	edit.Title = "Third"
+	edit.Tags = []string{"golang"}
+	edit.Files = []SnippetFile{{Name: "main.go", Content: "a"}, {Name: "main.go", Content: "b"}}
+	edit.RemovePassword = true
+	assert.Equal(t, m.Update(id, edit, 2) != nil, true)
+
+	s, err = m.Get(id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Title, "Second")
+	assert.Equal(t, s.Version, 2)
+	assert.Equal(t, s.Protected, true)
+
+	list, err := tags.ForSnippet(id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 1)
+	assert.Equal(t, list[0], "go")
+
+	fileList, err := files.ForSnippet(id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(fileList), 1)
+
+	// A stale version is still reported as a conflict.
+	edit.Files = nil
+	err = m.Update(id, edit, 1)
+	assert.Equal(t, errors.Is(err, ErrEditConflict), true)
+}
+
+func TestSnippetModelNeverExpires(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+	expires := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+
+	never, _, err := m.Insert(SnippetEdit{Title: "Never", Content: "Never...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+	soon, _, err := m.Insert(SnippetEdit{Title: "Soon", Content: "Soon...", Format: FormatCode, Visibility: VisibilityPublic, Expires: &expires}, 1)
+	assert.NilError(t, err)
+
+	s, err := m.Get(never)
+	assert.NilError(t, err)
+	assert.Equal(t, s.NeverExpires(), true)
+	assert.Equal(t, s.Expired(), false)
+
+	s, err = m.Get(soon)
+	assert.NilError(t, err)
+	assert.Equal(t, s.NeverExpires(), false)
+	assert.Equal(t, s.Expires.Equal(expires), true)
+
+	// Snippets which never expire are sorted after all the others.
+	page, err := m.Browse(SnippetQuery{Sort: SortExpiring})
+	assert.NilError(t, err)
+	assert.Equal(t, len(page.Snippets), 2)
+	assert.Equal(t, page.Snippets[0].ID, soon)
+	assert.Equal(t, page.Snippets[1].ID, never)
+}
+
+func TestSnippetModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+	now := time.Now().Truncate(time.Second)
+
+	for i := range 5 {
+		expires := now.Add(-time.Duration(i+1) * time.Hour)
+		_, _, err := m.Insert(SnippetEdit{Title: "Expired", Content: "Expired...", Format: FormatCode, Visibility: VisibilityPublic, Expires: &expires}, 1)
+		assert.NilError(t, err)
+	}
+	expires := now.Add(time.Hour)
+	current, _, err := m.Insert(SnippetEdit{Title: "Current", Content: "Current...", Format: FormatCode, Visibility: VisibilityPublic, Expires: &expires}, 1)
+	assert.NilError(t, err)
+	never, _, err := m.Insert(SnippetEdit{Title: "Never", Content: "Never...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+
+	// Only the snippets which expired before the given time are deleted, so
+	// the ones which expired more recently are still on their author's
+	// list.
+	before := now.Add(-150 * time.Minute)
+
+	n, err := m.DeleteExpired(before, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 3)
+
+	n, err = m.DeleteExpired(before, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+
+	snippets, err := m.ByUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 4)
+
+	// The expired snippets are deleted a batch at a time.
+	n, err = m.DeleteExpired(now, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	n, err = m.DeleteExpired(now, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	snippets, err = m.ByUser(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 2)
+
+	for _, id := range []int{current, never} {
+		_, err := m.Get(id)
+		assert.NilError(t, err)
+	}
+}
+
+func TestSnippetModelFork(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	m := SnippetModel{newTestDB(t)}
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	original, _, err := m.Insert(SnippetEdit{Title: "Original", Content: "Original...", Format: FormatMarkdown, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+	unlisted, _, err := m.Insert(SnippetEdit{Title: "Unlisted", Content: "Unlisted...", Format: FormatCode, Language: "go", Visibility: VisibilityUnlisted}, 1)
+	assert.NilError(t, err)
+	protected, _, err := m.Insert(SnippetEdit{
+		Title:      "Protected",
+		Content:    "Protected...",
+		Format:     FormatCode,
+		Visibility: VisibilityPublic,
+		Tags:       []string{"go"},
+		Files:      []SnippetFile{{Name: "main.go", Content: "package main"}},
+		Password:   "open sesame",
+	}, 1)
+	assert.NilError(t, err)
+
+	fork, slug, err := m.Fork(original, 1, &expires)
+	assert.NilError(t, err)
+
+	s, err := m.Get(fork)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Slug, slug)
+	assert.Equal(t, s.Title, "Original")
+	assert.Equal(t, s.Content, "Original...")
+	assert.Equal(t, s.Format, FormatMarkdown)
+	assert.Equal(t, s.ForkedFrom, original)
+	assert.Equal(t, s.Expires.Equal(expires), true)
+
+	// Forks keep the visibility of the original, and unlisted forks aren't
+	// listed on the original's page.
+	hidden, _, err := m.Fork(unlisted, 1, nil)
+	assert.NilError(t, err)
+	s, err = m.Get(hidden)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Visibility, VisibilityUnlisted)
+	assert.Equal(t, s.Language, "go")
+
+	forks, err := m.Forks(original)
+	assert.NilError(t, err)
+	assert.Equal(t, len(forks), 1)
+	assert.Equal(t, forks[0].ID, fork)
+
+	forks, err = m.Forks(unlisted)
+	assert.NilError(t, err)
+	assert.Equal(t, len(forks), 0)
+
+	// Forks get the tags and files of the original, but not its password,
+	// so the fork of a protected snippet is private.
+	copied, _, err := m.Fork(protected, 2, nil)
+	assert.NilError(t, err)
+	s, err = m.Get(copied)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Visibility, VisibilityPrivate)
+	assert.Equal(t, s.Protected, false)
+
+	tags := TagModel{m.DB}
+	tagList, err := tags.ForSnippet(copied)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tagList), 1)
+	assert.Equal(t, tagList[0], "go")
+
+	files := SnippetFileModel{m.DB}
+	fileList, err := files.ForSnippet(copied)
+	assert.NilError(t, err)
+	assert.Equal(t, len(fileList), 1)
+	assert.Equal(t, fileList[0].Name, "main.go")
+
+	// Snippets in the trash can't be forked.
+	err = m.Delete(original)
+	assert.NilError(t, err)
+	_, _, err = m.Fork(original, 1, nil)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	// Once the original has gone for good, the fork no longer refers to it.
+	_, err = m.DB.Exec("DELETE FROM snippets WHERE id = ?", original)
+	assert.NilError(t, err)
+	s, err = m.Get(fork)
+	assert.NilError(t, err)
+	assert.Equal(t, s.ForkedFrom, 0)
+}
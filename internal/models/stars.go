@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type StarModelInterface interface {
+	Insert(userID int, snippetID int) error
+	Delete(userID int, snippetID int) error
+	Exists(userID int, snippetID int) (bool, error)
+}
+
+// Define a StarModel type which wraps a sql.DB connection pool. A star is a
+// user's bookmark of a snippet. The number of stars on each snippet is kept
+// in its star_count column, so that the listings don't have to count them.
+type StarModel struct {
+	DB *sql.DB
+}
+
+// This will star a snippet for a user. Starring a snippet which the user has
+// already starred does nothing.
+func (m *StarModel) Insert(userID int, snippetID int) error {
+	// The star and the count have to change together, so we run both
+	// statements in a transaction.
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// If the star already exists the UPDATE leaves the row as it was, which
+	// MySQL reports as 0 rows affected, so the count isn't changed.
+	stmt := `INSERT INTO stars (user_id, snippet_id, created) VALUES (?, ?, UTC_TIMESTAMP())
+    ON DUPLICATE KEY UPDATE user_id = user_id`
+
+	result, err := tx.Exec(stmt, userID, snippetID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 1 {
+		_, err = tx.Exec(`UPDATE snippets SET star_count = star_count + 1 WHERE id = ?`, snippetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// This will remove a user's star from a snippet. Removing a star which
+// doesn't exist does nothing.
+func (m *StarModel) Delete(userID int, snippetID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM stars WHERE user_id = ? AND snippet_id = ?`, userID, snippetID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 1 {
+		_, err = tx.Exec(`UPDATE snippets SET star_count = star_count - 1 WHERE id = ?`, snippetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// This will return true if the user has starred the snippet.
+func (m *StarModel) Exists(userID int, snippetID int) (bool, error) {
+	var exists bool
+
+	stmt := "SELECT EXISTS(SELECT true FROM stars WHERE user_id = ? AND snippet_id = ?)"
+
+	err := m.DB.QueryRow(stmt, userID, snippetID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestStarModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	snippets := SnippetModel{db}
+	users := UserModel{db}
+	m := StarModel{db}
+
+	err := users.Insert("Bob", "bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+	bob, err := users.Authenticate("bob@example.com", "pa$$word")
+	assert.NilError(t, err)
+
+	first, _, err := snippets.Insert(SnippetEdit{Title: "First", Content: "First...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+	second, _, err := snippets.Insert(SnippetEdit{Title: "Second", Content: "Second...", Format: FormatCode, Visibility: VisibilityUnlisted}, 1)
+	assert.NilError(t, err)
+
+	// Starring a snippet twice only counts once.
+	for range 2 {
+		err = m.Insert(bob, first)
+		assert.NilError(t, err)
+	}
+	err = m.Insert(1, first)
+	assert.NilError(t, err)
+	err = m.Insert(bob, second)
+	assert.NilError(t, err)
+
+	s, err := snippets.Get(first)
+	assert.NilError(t, err)
+	assert.Equal(t, s.StarCount, 2)
+
+	starred, err := m.Exists(bob, first)
+	assert.NilError(t, err)
+	assert.Equal(t, starred, true)
+
+	list, err := snippets.Starred(bob)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 2)
+	assert.Equal(t, list[0].ID, second)
+	assert.Equal(t, list[1].ID, first)
+
+	// Removing a star twice only counts once.
+	for range 2 {
+		err = m.Delete(bob, first)
+		assert.NilError(t, err)
+	}
+
+	s, err = snippets.Get(first)
+	assert.NilError(t, err)
+	assert.Equal(t, s.StarCount, 1)
+
+	starred, err = m.Exists(bob, first)
+	assert.NilError(t, err)
+	assert.Equal(t, starred, false)
+
+	list, err = snippets.Starred(bob)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 1)
+	assert.Equal(t, list[0].ID, second)
+
+	// Other users' snippets drop out of the list once they're made private,
+	// or moved to the trash.
+	err = m.Insert(bob, first)
+	assert.NilError(t, err)
+	_, err = db.Exec("UPDATE snippets SET visibility = 'private' WHERE id = ?", second)
+	assert.NilError(t, err)
+	err = snippets.Delete(first)
+	assert.NilError(t, err)
+	list, err = snippets.Starred(bob)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 0)
+}
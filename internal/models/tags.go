@@ -0,0 +1,146 @@
+package models
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+)
+
+type TagModelInterface interface {
+	ForSnippet(snippetID int) ([]string, error)
+	Cloud(limit int) ([]TagCount, error)
+	Suggest(prefix string, limit int) ([]string, error)
+}
+
+// Define a TagCount type to hold a tag along with the number of current
+// snippets which use it.
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// Define a TagModel type which wraps a sql.DB connection pool.
+type TagModel struct {
+	DB *sql.DB
+}
+
+// setTags replaces the tags on a snippet as part of a transaction, so that
+// SnippetModel.Insert() and Update() can save them along with the rest of the
+// snippet. The tags should already have been normalized (see
+// validator.NormalizeList()). Any tags which don't exist yet are created.
+func setTags(tx *sql.Tx, snippetID int, tags []string) error {
+	_, err := tx.Exec(`DELETE FROM snippet_tags WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		// Insert the tag if it's new. For an existing tag the
+		// LAST_INSERT_ID(id) trick makes LastInsertId() return its ID, so
+		// either way we get the ID in a single statement.
+		result, err := tx.Exec(`INSERT INTO tags (name) VALUES (?)
+        ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`, tag)
+		if err != nil {
+			return err
+		}
+
+		tagID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO snippet_tags (snippet_id, tag_id) VALUES (?, ?)`, snippetID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This will return the tags on a snippet in alphabetical order.
+func (m *TagModel) ForSnippet(snippetID int) ([]string, error) {
+	stmt := `SELECT t.name FROM tags t
+    INNER JOIN snippet_tags st ON st.tag_id = t.id
+    WHERE st.snippet_id = ? ORDER BY t.name`
+
+	return m.queryNames(stmt, snippetID)
+}
+
+// This will return the most used tags on current public snippets, along with how
+// many snippets use each one. The result is sorted by name.
+func (m *TagModel) Cloud(limit int) ([]TagCount, error) {
+	stmt := `SELECT t.name, COUNT(*) AS uses FROM tags t
+    INNER JOIN snippet_tags st ON st.tag_id = t.id
+    INNER JOIN snippets ON snippets.id = st.snippet_id
+    WHERE ` + listedSnippets + `
+    GROUP BY t.id, t.name ORDER BY uses DESC, t.name LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []TagCount
+
+	for rows.Next() {
+		var tc TagCount
+		err = rows.Scan(&tc.Name, &tc.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tc)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(tags, func(a, b TagCount) int { return strings.Compare(a.Name, b.Name) })
+
+	return tags, nil
+}
+
+// This will return up to limit tags on current public snippets which start
+// with the prefix, in alphabetical order. Tags which are only used by private,
+// unlisted, expired or trashed snippets are left out, so that the suggestions
+// don't give them away.
+func (m *TagModel) Suggest(prefix string, limit int) ([]string, error) {
+	// Escape the LIKE wildcards so that they match literally.
+	prefix = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+
+	stmt := `SELECT DISTINCT t.name FROM tags t
+    INNER JOIN snippet_tags st ON st.tag_id = t.id
+    INNER JOIN snippets ON snippets.id = st.snippet_id
+    WHERE t.name LIKE CONCAT(?, '%') AND ` + listedSnippets + `
+    ORDER BY t.name LIMIT ?`
+
+	return m.queryNames(stmt, prefix, limit)
+}
+
+// queryNames runs a query which selects a single column of tag names.
+func (m *TagModel) queryNames(stmt string, args ...any) ([]string, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestTagModelSuggest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	snippets := SnippetModel{db}
+	m := TagModel{db}
+
+	_, _, err := snippets.Insert(SnippetEdit{Title: "Public", Content: "Public...", Format: FormatCode, Visibility: VisibilityPublic, Tags: []string{"golang", "go_test"}}, 1)
+	assert.NilError(t, err)
+	_, _, err = snippets.Insert(SnippetEdit{Title: "Private", Content: "Private...", Format: FormatCode, Visibility: VisibilityPrivate, Tags: []string{"golang", "gossip"}}, 1)
+	assert.NilError(t, err)
+	trashed, _, err := snippets.Insert(SnippetEdit{Title: "Trashed", Content: "Trashed...", Format: FormatCode, Visibility: VisibilityPublic, Tags: []string{"gotcha"}}, 1)
+	assert.NilError(t, err)
+	assert.NilError(t, snippets.Delete(trashed))
+
+	// A tag used by several snippets is only suggested once, and tags which
+	// are only used by private or trashed snippets aren't suggested at all.
+	tags, err := m.Suggest("go", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tags), 2)
+	assert.Equal(t, tags[0], "go_test")
+	assert.Equal(t, tags[1], "golang")
+
+	// LIKE wildcards in the prefix match literally.
+	tags, err = m.Suggest("go_", 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(tags), 1)
+	assert.Equal(t, tags[0], "go_test")
+}
@@ -1,12 +1,32 @@
 CREATE TABLE snippets (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    slug CHAR(10) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+    user_id INTEGER,
     title VARCHAR(100) NOT NULL,
     content TEXT NOT NULL,
+    format VARCHAR(10) NOT NULL DEFAULT 'code',
+    language VARCHAR(20) NOT NULL DEFAULT '',
+    visibility VARCHAR(10) NOT NULL DEFAULT 'public',
+    hashed_password CHAR(60),
+    views_left INTEGER,
+    forked_from INTEGER,
+    star_count INTEGER NOT NULL DEFAULT 0,
+    view_count INTEGER NOT NULL DEFAULT 0,
     created DATETIME NOT NULL,
-    expires DATETIME NOT NULL
+    updated DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted DATETIME
 );
 
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_slug UNIQUE (slug);
 CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_deleted ON snippets(deleted);
+CREATE INDEX idx_snippets_expires_id ON snippets(expires, id);
+CREATE INDEX idx_snippets_title_id ON snippets(title, id);
+CREATE INDEX idx_snippets_visibility_expires_id ON snippets(visibility, expires, id);
+CREATE FULLTEXT INDEX idx_snippets_fulltext ON snippets(title, content);
+ALTER TABLE snippets ADD CONSTRAINT fk_snippets_forked_from FOREIGN KEY (forked_from) REFERENCES snippets(id) ON DELETE SET NULL;
 
 CREATE TABLE users (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
@@ -18,6 +38,106 @@ CREATE TABLE users (
 
 ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
 
+ALTER TABLE snippets ADD CONSTRAINT fk_snippets_user_id FOREIGN KEY (user_id) REFERENCES users(id);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+
+CREATE TABLE snippet_revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT snippet_revisions_uc_version UNIQUE (snippet_id, version),
+    CONSTRAINT fk_snippet_revisions_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE TABLE tags (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(30) NOT NULL,
+    CONSTRAINT tags_uc_name UNIQUE (name)
+);
+
+CREATE TABLE snippet_tags (
+    snippet_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, tag_id),
+    CONSTRAINT fk_snippet_tags_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT fk_snippet_tags_tag_id FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE TABLE snippet_files (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    CONSTRAINT snippet_files_uc_name UNIQUE (snippet_id, name),
+    CONSTRAINT fk_snippet_files_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE TABLE comments (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    parent_id INTEGER,
+    line_start INTEGER,
+    line_end INTEGER,
+    version INTEGER,
+    body TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    updated DATETIME NOT NULL,
+    CONSTRAINT fk_comments_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT fk_comments_user_id FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_comments_parent_id FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_comments_snippet_id_id ON comments(snippet_id, id);
+
+CREATE TABLE stars (
+    user_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (user_id, snippet_id),
+    CONSTRAINT fk_stars_user_id FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_stars_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE TABLE collections (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    slug CHAR(10) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+    user_id INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL,
+    visibility VARCHAR(10) NOT NULL DEFAULT 'public',
+    created DATETIME NOT NULL,
+    updated DATETIME NOT NULL,
+    CONSTRAINT collections_uc_slug UNIQUE (slug),
+    CONSTRAINT fk_collections_user_id FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_collections_user_id ON collections(user_id);
+CREATE INDEX idx_collections_visibility_id ON collections(visibility, id);
+
+CREATE TABLE collection_snippets (
+    collection_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (collection_id, snippet_id),
+    CONSTRAINT fk_collection_snippets_collection_id FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+    CONSTRAINT fk_collection_snippets_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE TABLE snippet_views (
+    snippet_id INTEGER NOT NULL,
+    hour DATETIME NOT NULL,
+    views INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, hour),
+    CONSTRAINT fk_snippet_views_snippet_id FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_views_hour ON snippet_views(hour);
+
 INSERT INTO users (name, email, hashed_password, created) VALUES (
     'Alice Jones',
     'alice@example.com',
@@ -1,3 +1,21 @@
-DROP TABLE users;
+DROP TABLE snippet_views;
+
+DROP TABLE collection_snippets;
+
+DROP TABLE collections;
+
+DROP TABLE stars;
+
+DROP TABLE comments;
+
+DROP TABLE snippet_files;
+
+DROP TABLE snippet_tags;
+
+DROP TABLE tags;
+
+DROP TABLE snippet_revisions;
 
 DROP TABLE snippets;
+
+DROP TABLE users;
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+type ViewModelInterface interface {
+	Record(views map[int]int, at time.Time) error
+	DeleteBefore(before time.Time) (int, error)
+}
+
+// The periods which SnippetModel.Trending() can rank snippets over.
+const (
+	TrendingDay  = "day"
+	TrendingWeek = "week"
+)
+
+// TrendingPeriods lists the permitted periods for SnippetModel.Trending().
+var TrendingPeriods = []string{TrendingDay, TrendingWeek}
+
+// A trendingSpec describes how views are weighted for a trending period.
+// Only the views within the window count, and each view's weight halves
+// every halfLife, so that a snippet which is being read now ranks above one
+// which was read just as much a few days ago.
+type trendingSpec struct {
+	window   time.Duration
+	halfLife time.Duration
+}
+
+var trendingSpecs = map[string]trendingSpec{
+	TrendingDay:  {window: 24 * time.Hour, halfLife: 6 * time.Hour},
+	TrendingWeek: {window: 7 * 24 * time.Hour, halfLife: 2 * 24 * time.Hour},
+}
+
+// ViewRetention is how long the hourly view counts are kept for. It's the
+// window of the longest trending period, as older counts aren't used.
+const ViewRetention = 7 * 24 * time.Hour
+
+// Define a ViewModel type which wraps a sql.DB connection pool. Views are
+// counted in two places: the total for each snippet is kept in its
+// view_count column, and the snippet_views table holds a count for each hour,
+// which is used to work out which snippets are trending.
+type ViewModel struct {
+	DB *sql.DB
+}
+
+// This will add a batch of views to the counts, where views maps each
+// snippet's ID to the number of times it was viewed. The views are counted
+// in the hour containing at. Views of snippets which have since been deleted
+// are dropped.
+func (m *ViewModel) Record(views map[int]int, at time.Time) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	// The batch is passed to both statements as a derived table, one row for
+	// each snippet. Sorting the IDs means the rows are always locked in the
+	// same order.
+	ids := slices.Sorted(maps.Keys(views))
+	args := make([]any, 0, 2*len(ids))
+	for _, id := range ids {
+		args = append(args, id, views[id])
+	}
+	batch := `(SELECT ? AS snippet_id, ? AS views` + strings.Repeat(" UNION ALL SELECT ?, ?", len(ids)-1) + `)`
+
+	// The hourly counts and the totals have to change together, so we run
+	// both statements in a transaction.
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Joining the snippets table leaves out any snippets which have been
+	// deleted since they were viewed, which would otherwise break the foreign
+	// key and lose the whole batch.
+	stmt := `INSERT INTO snippet_views (snippet_id, hour, views)
+    SELECT v.snippet_id, ?, v.views FROM ` + batch + ` v
+    INNER JOIN snippets s ON s.id = v.snippet_id
+    ON DUPLICATE KEY UPDATE views = snippet_views.views + v.views`
+
+	_, err = tx.Exec(stmt, append([]any{at.UTC().Truncate(time.Hour)}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	stmt = `UPDATE snippets INNER JOIN ` + batch + ` v ON v.snippet_id = snippets.id
+    SET snippets.view_count = snippets.view_count + v.views`
+
+	_, err = tx.Exec(stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// This will delete the hourly view counts from before the given time,
+// returning how many were deleted. The totals aren't affected.
+func (m *ViewModel) DeleteBefore(before time.Time) (int, error) {
+	stmt := `DELETE FROM snippet_views WHERE hour < ?`
+
+	result, err := m.DB.Exec(stmt, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
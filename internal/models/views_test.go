@@ -0,0 +1,75 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestViewModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+	snippets := SnippetModel{db}
+	m := ViewModel{db}
+
+	first, _, err := snippets.Insert(SnippetEdit{Title: "First", Content: "First...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+	second, _, err := snippets.Insert(SnippetEdit{Title: "Second", Content: "Second...", Format: FormatCode, Visibility: VisibilityPublic}, 1)
+	assert.NilError(t, err)
+	unlisted, _, err := snippets.Insert(SnippetEdit{Title: "Unlisted", Content: "Unlisted...", Format: FormatCode, Visibility: VisibilityUnlisted}, 1)
+	assert.NilError(t, err)
+
+	now := time.Now()
+
+	// The second snippet was viewed more, but days ago, so the first snippet
+	// is trending today and the second this week.
+	err = m.Record(map[int]int{first: 3, unlisted: 10}, now)
+	assert.NilError(t, err)
+	err = m.Record(map[int]int{first: 2}, now)
+	assert.NilError(t, err)
+	err = m.Record(map[int]int{second: 20}, now.Add(-3*24*time.Hour))
+	assert.NilError(t, err)
+
+	// Views of a snippet which doesn't exist any more are dropped, without
+	// losing the rest of the batch.
+	err = m.Record(map[int]int{second: 1, 9999: 1}, now)
+	assert.NilError(t, err)
+
+	s, err := snippets.Get(first)
+	assert.NilError(t, err)
+	assert.Equal(t, s.ViewCount, 5)
+
+	s, err = snippets.Get(second)
+	assert.NilError(t, err)
+	assert.Equal(t, s.ViewCount, 21)
+
+	// Unlisted snippets are never trending.
+	list, err := snippets.Trending(TrendingDay, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 2)
+	assert.Equal(t, list[0].ID, first)
+	assert.Equal(t, list[1].ID, second)
+
+	list, err = snippets.Trending(TrendingWeek, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(list), 2)
+	assert.Equal(t, list[0].ID, second)
+	assert.Equal(t, list[1].ID, first)
+
+	// Deleting the old hourly counts leaves the totals alone.
+	n, err := m.DeleteBefore(now.Add(-24 * time.Hour))
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	list, err = snippets.Trending(TrendingWeek, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, list[0].ID, first)
+
+	s, err = snippets.Get(second)
+	assert.NilError(t, err)
+	assert.Equal(t, s.ViewCount, 21)
+}
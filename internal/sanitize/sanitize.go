@@ -0,0 +1,307 @@
+// Package sanitize cleans up untrusted HTML so that it's safe to include in
+// a page. It works from an allowlist: elements and attributes which aren't
+// known to be safe are removed, URLs are restricted to safe schemes, and the
+// output always has balanced tags.
+package sanitize
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// allowedElements maps each element which is kept to the attributes which
+// are kept on it.
+var allowedElements = map[string][]string{
+	"a":          {"href", "title"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       {"class"},
+	"dd":         nil,
+	"del":        nil,
+	"details":    nil,
+	"div":        nil,
+	"dl":         nil,
+	"dt":         nil,
+	"em":         nil,
+	"h1":         {"id"},
+	"h2":         {"id"},
+	"h3":         {"id"},
+	"h4":         {"id"},
+	"h5":         {"id"},
+	"h6":         {"id"},
+	"hr":         nil,
+	"i":          nil,
+	"img":        {"src", "alt", "title"},
+	"kbd":        nil,
+	"li":         nil,
+	"mark":       nil,
+	"ol":         {"start"},
+	"p":          nil,
+	"pre":        {"class"},
+	"s":          nil,
+	"span":       {"class"},
+	"strong":     nil,
+	"sub":        nil,
+	"summary":    nil,
+	"sup":        nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"align"},
+	"th":         {"align"},
+	"thead":      nil,
+	"tr":         nil,
+	"ul":         nil,
+}
+
+// commentElements maps the elements which are kept in comments to the
+// attributes which are kept on them. Comments only have paragraphs, code
+// blocks and inline formatting, so everything else is removed.
+var commentElements = map[string][]string{
+	"a":      {"href", "title"},
+	"b":      nil,
+	"br":     nil,
+	"code":   {"class"},
+	"del":    nil,
+	"em":     nil,
+	"i":      nil,
+	"p":      nil,
+	"pre":    {"class"},
+	"s":      nil,
+	"span":   {"class"},
+	"strong": nil,
+}
+
+// voidElements never have any content or an end tag.
+var voidElements = []string{"br", "hr", "img"}
+
+// droppedElements are removed along with everything inside them, rather than
+// just having their tags removed.
+var droppedElements = []string{"script", "style", "iframe", "object", "embed", "noscript", "template", "textarea", "title", "svg", "math"}
+
+// safeSchemes are the URL schemes which are allowed in links and images.
+// URLs without a scheme (relative URLs and fragments) are always allowed.
+var safeSchemes = []string{"http", "https", "mailto"}
+
+var (
+	tagRX   = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9-]*)((?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*)\s*(/?)>`)
+	attrRX  = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?`)
+	idRX    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	classRX = regexp.MustCompile(`^(hl-[a-z]+|highlight|language-[a-z0-9+#._-]+)$`)
+	alignRX = regexp.MustCompile(`^(left|center|right)$`)
+	digitRX = regexp.MustCompile(`^[0-9]{1,9}$`)
+)
+
+// HTML returns a sanitized copy of s.
+func HTML(s string) string {
+	return clean(s, allowedElements)
+}
+
+// Comment returns a sanitized copy of s, keeping only the elements which are
+// allowed in comments.
+func Comment(s string) string {
+	return clean(s, commentElements)
+}
+
+// clean sanitizes s, keeping only the elements in allowed, and the allowed
+// attributes on them.
+func clean(s string, allowed map[string][]string) string {
+	var b strings.Builder
+	var open []string
+
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			writeText(&b, s)
+			break
+		}
+		writeText(&b, s[:i])
+		s = s[i:]
+
+		// Comments, doctypes and processing instructions are dropped.
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s[4:], "-->")
+			if end < 0 {
+				break
+			}
+			s = s[4+end+3:]
+			continue
+		}
+		if strings.HasPrefix(s, "<!") || strings.HasPrefix(s, "<?") {
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				break
+			}
+			s = s[end+1:]
+			continue
+		}
+
+		m := tagRX.FindStringSubmatch(s)
+		if m == nil {
+			// A < which doesn't start a tag is just text.
+			writeText(&b, "<")
+			s = s[1:]
+			continue
+		}
+		s = s[len(m[0]):]
+
+		closing, name, attrs := m[1] == "/", strings.ToLower(m[2]), m[3]
+
+		if slices.Contains(droppedElements, name) {
+			if !closing {
+				s = skipElement(s, name)
+			}
+			continue
+		}
+
+		allowedAttrs, ok := allowed[name]
+		if !ok {
+			continue
+		}
+
+		if closing {
+			// Close the element, along with any elements opened inside it
+			// which weren't closed. End tags for elements which aren't open
+			// are dropped, so that they can't close anything outside of the
+			// sanitized HTML.
+			if i := lastIndex(open, name); i >= 0 {
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+			}
+			continue
+		}
+
+		b.WriteString("<" + name)
+		writeAttrs(&b, name, attrs, allowedAttrs)
+		b.WriteString(">")
+
+		if !slices.Contains(voidElements, name) {
+			open = append(open, name)
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+
+	return b.String()
+}
+
+// lastIndex returns the index of the last occurrence of name in open, or -1
+// if it isn't there.
+func lastIndex(open []string, name string) int {
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeText writes text, making sure that it's escaped exactly once.
+func writeText(b *strings.Builder, s string) {
+	b.WriteString(html.EscapeString(html.UnescapeString(s)))
+}
+
+// skipElement returns s with everything up to and including the end tag for
+// the named element removed. If there's no end tag, everything is removed.
+func skipElement(s string, name string) string {
+	end := strings.Index(strings.ToLower(s), "</"+name)
+	if end < 0 {
+		return ""
+	}
+	s = s[end:]
+
+	if i := strings.IndexByte(s, '>'); i >= 0 {
+		return s[i+1:]
+	}
+	return ""
+}
+
+func writeAttrs(b *strings.Builder, element string, attrs string, allowed []string) {
+	seen := map[string]bool{}
+
+	for _, m := range attrRX.FindAllStringSubmatch(attrs, -1) {
+		name := strings.ToLower(m[1])
+		if !slices.Contains(allowed, name) || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		value := m[2]
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+			value = value[1 : len(value)-1]
+		}
+		value = html.UnescapeString(value)
+
+		value, ok := cleanAttr(name, value)
+		if !ok {
+			continue
+		}
+
+		b.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+	}
+
+	// Links to other sites shouldn't pass on any ranking to them.
+	if element == "a" {
+		b.WriteString(` rel="nofollow noopener"`)
+	}
+}
+
+// cleanAttr checks the value of an allowed attribute, returning the value to
+// use and whether the attribute should be kept at all.
+func cleanAttr(name string, value string) (string, bool) {
+	switch name {
+	case "href", "src":
+		return value, SafeURL(value)
+	case "id":
+		return value, idRX.MatchString(value)
+	case "class":
+		// Only the classes used for syntax highlighting are kept, so that
+		// the page's own styles can't be borrowed.
+		var classes []string
+		for _, c := range strings.Fields(value) {
+			if classRX.MatchString(c) {
+				classes = append(classes, c)
+			}
+		}
+		return strings.Join(classes, " "), len(classes) > 0
+	case "align":
+		return value, alignRX.MatchString(value)
+	case "start":
+		return value, digitRX.MatchString(value)
+	default:
+		return value, true
+	}
+}
+
+// SafeURL reports whether a URL is safe to use in a link or image. Relative
+// URLs are safe, and absolute URLs are safe if they use one of the safe
+// schemes.
+func SafeURL(u string) bool {
+	// Browsers ignore whitespace and control characters in the scheme, so
+	// they need to be removed before checking it (otherwise something like
+	// "java\tscript:" would slip through).
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+
+	colon := strings.IndexByte(u, ':')
+	if colon < 0 {
+		return true
+	}
+
+	// A colon after the first /, ? or # isn't part of a scheme.
+	if i := strings.IndexAny(u, "/?#"); i >= 0 && i < colon {
+		return true
+	}
+
+	return slices.Contains(safeSchemes, strings.ToLower(u[:colon]))
+}
@@ -0,0 +1,125 @@
+package sanitize
+
+import (
+	"testing"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Allowed elements",
+			input: `<p>Hello <strong>world</strong></p>`,
+			want:  `<p>Hello <strong>world</strong></p>`,
+		},
+		{
+			name:  "Scripts",
+			input: `<p>a</p><script>alert("x")</script><SCRIPT src="x.js"></SCRIPT><p>b</p>`,
+			want:  `<p>a</p><p>b</p>`,
+		},
+		{
+			name:  "Event handlers",
+			input: `<div onclick="steal()" onmouseover='x'>hi</div>`,
+			want:  `<div>hi</div>`,
+		},
+		{
+			name:  "Unknown elements",
+			input: `<form action="/x"><input name="a">text</form>`,
+			want:  `text`,
+		},
+		{
+			name:  "Unsafe link",
+			input: `<a href="javascript:alert(1)">x</a>`,
+			want:  `<a rel="nofollow noopener">x</a>`,
+		},
+		{
+			name:  "Obfuscated scheme",
+			input: `<a href="jav&#x09;ascript:alert(1)">x</a><img src=" data:image/png;base64,xx">`,
+			want:  `<a rel="nofollow noopener">x</a><img>`,
+		},
+		{
+			name:  "Safe links",
+			input: `<a href="https://example.com/?a=1&amp;b=2" title="T">x</a><a href="/snippet/view/1#intro">y</a>`,
+			want:  `<a href="https://example.com/?a=1&amp;b=2" title="T" rel="nofollow noopener">x</a><a href="/snippet/view/1#intro" rel="nofollow noopener">y</a>`,
+		},
+		{
+			name:  "Classes",
+			input: `<span class="hl-keyword flash">if</span><p class="flash">x</p>`,
+			want:  `<span class="hl-keyword">if</span><p>x</p>`,
+		},
+		{
+			name:  "Unbalanced tags",
+			input: `<em>a</div><ul><li>b</em>`,
+			want:  `<em>a<ul><li>b</li></ul></em>`,
+		},
+		{
+			name:  "Comments and text",
+			input: `<!-- hidden --> 1 < 2 & 3 > 2 &amp; done`,
+			want:  ` 1 &lt; 2 &amp; 3 &gt; 2 &amp; done`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, HTML(tt.input), tt.want)
+		})
+	}
+}
+
+func TestComment(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Inline formatting",
+			input: `<p>Use <code>rows.Close()</code>, <em>not</em> <a href="https://example.com">this</a></p>`,
+			want:  `<p>Use <code>rows.Close()</code>, <em>not</em> <a href="https://example.com" rel="nofollow noopener">this</a></p>`,
+		},
+		{
+			name:  "Block elements",
+			input: `<h1>Big</h1><table><tr><td>cell</td></tr></table><img src="x.png">`,
+			want:  `Bigcell`,
+		},
+		{
+			name:  "Scripts",
+			input: `<p>a<script>alert("x")</script></p>`,
+			want:  `<p>a</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Comment(tt.input), tt.want)
+		})
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com", true},
+		{"mailto:alice@example.com", true},
+		{"/relative/path:with-colon", true},
+		{"#anchor", true},
+		{"javascript:alert(1)", false},
+		{"JavaScript:alert(1)", false},
+		{" java\nscript:alert(1)", false},
+		{"vbscript:x", false},
+		{"data:text/html,x", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.Equal(t, SafeURL(tt.url), tt.want)
+		})
+	}
+}
@@ -0,0 +1,316 @@
+// Package search provides an in-process full-text search index for snippets.
+// It implements models.SearchIndex without needing MySQL FULLTEXT support,
+// which makes it handy for local development and tests.
+package search
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/models"
+)
+
+// The BM25 tuning parameters. These are the commonly used defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// titleWeight is how many times more a term counts when it appears in a
+// snippet's title rather than its content.
+const titleWeight = 2
+
+// Index is an in-memory inverted index of snippets, ranked using BM25. It is
+// safe for concurrent use.
+type Index struct {
+	mu sync.RWMutex
+	// docs maps snippet IDs to the indexed documents.
+	docs map[int]*document
+	// postings maps each term to the weighted number of times it appears in
+	// each document which contains it.
+	postings map[string]map[int]int
+	// totalLength is the sum of the weighted lengths of all documents.
+	totalLength int
+	// now returns the current time. It can be replaced in tests.
+	now func() time.Time
+}
+
+// document holds an indexed snippet along with its terms: those from the
+// title first, followed by those from the content.
+type document struct {
+	snippet     models.Snippet
+	terms       []string
+	titleLength int
+}
+
+// length returns the weighted length of the document.
+func (d *document) length() int {
+	return len(d.terms) + (titleWeight-1)*d.titleLength
+}
+
+// NewIndex returns a new, empty index.
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[int]*document),
+		postings: make(map[string]map[int]int),
+		now:      time.Now,
+	}
+}
+
+// Index adds a snippet to the index, replacing any previous version of it.
+// Snippets which have already expired or been deleted are removed instead.
+func (idx *Index) Index(s models.Snippet) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(s.ID)
+
+	if !s.Deleted.IsZero() || !s.Expires.After(idx.now()) {
+		return nil
+	}
+
+	title := Tokenize(s.Title)
+	doc := &document{
+		snippet:     s,
+		terms:       append(title, Tokenize(s.Content)...),
+		titleLength: len(title),
+	}
+
+	for i, term := range doc.terms {
+		weight := 1
+		if i < doc.titleLength {
+			weight = titleWeight
+		}
+
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[int]int)
+		}
+		idx.postings[term][s.ID] += weight
+	}
+
+	idx.docs[s.ID] = doc
+	idx.totalLength += doc.length()
+
+	return nil
+}
+
+// Delete removes a snippet from the index. It isn't an error if the snippet
+// wasn't indexed.
+func (idx *Index) Delete(id int) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+	return nil
+}
+
+// remove deletes a document and its postings. The caller must hold the write
+// lock.
+func (idx *Index) remove(id int) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+
+	idx.totalLength -= doc.length()
+	delete(idx.docs, id)
+}
+
+// Len returns the number of snippets in the index.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Rebuild replaces the contents of the index with every current snippet from
+// the snippet model, which it reads a page at a time.
+func (idx *Index) Rebuild(snippets models.SnippetModelInterface) error {
+	fresh := NewIndex()
+	fresh.now = idx.now
+
+	q := models.SnippetQuery{Sort: models.SortOldest, Limit: models.MaxPageSize}
+	for {
+		page, err := snippets.Browse(q)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range page.Snippets {
+			// The content of password-protected and view-limited snippets
+			// mustn't be searchable, and encrypted snippets only have
+			// ciphertext, so they're all left out.
+			if s.Protected || s.ViewsLeft > 0 || s.Encrypted() {
+				continue
+			}
+			fresh.Index(s)
+		}
+
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.docs = fresh.docs
+	idx.postings = fresh.postings
+	idx.totalLength = fresh.totalLength
+
+	return nil
+}
+
+// Query returns a page of the snippets matching the search terms, most
+// relevant first. A snippet matches if it contains every term and phrase and
+// none of the excluded terms. Matching is done on stemmed terms, so a search
+// for "ponds" also finds "pond".
+func (idx *Index) Query(q models.SearchQuery) (models.SearchPage, error) {
+	page, limit := q.Bounds()
+	result := models.SearchPage{Page: page}
+
+	var required []string
+	for _, t := range q.Terms.Terms {
+		required = append(required, Tokenize(t)...)
+	}
+
+	var phrases [][]string
+	for _, p := range q.Terms.Phrases {
+		if terms := Tokenize(p); len(terms) > 0 {
+			phrases = append(phrases, terms)
+			required = append(required, terms...)
+		}
+	}
+
+	var excluded []string
+	for _, t := range q.Terms.Excluded {
+		excluded = append(excluded, Tokenize(t)...)
+	}
+
+	// If the query was made up entirely of stop words there's nothing to
+	// match.
+	if len(required) == 0 {
+		return result, nil
+	}
+
+	slices.Sort(required)
+	required = slices.Compact(required)
+
+	type hit struct {
+		snippet models.Snippet
+		score   float64
+	}
+
+	var hits []hit
+	var expired []int
+
+	idx.mu.RLock()
+
+	// Start from the term with the fewest postings, so that we look at as
+	// few candidate documents as possible.
+	rarest := slices.MinFunc(required, func(a, b string) int {
+		return len(idx.postings[a]) - len(idx.postings[b])
+	})
+
+	now := idx.now()
+	avgLength := float64(idx.totalLength) / float64(max(len(idx.docs), 1))
+
+candidates:
+	for id := range idx.postings[rarest] {
+		doc := idx.docs[id]
+
+		if !doc.snippet.Expires.After(now) {
+			expired = append(expired, id)
+			continue
+		}
+
+		for _, t := range required {
+			if idx.postings[t][id] == 0 {
+				continue candidates
+			}
+		}
+		for _, t := range excluded {
+			if idx.postings[t][id] > 0 {
+				continue candidates
+			}
+		}
+		for _, p := range phrases {
+			if !doc.containsPhrase(p) {
+				continue candidates
+			}
+		}
+
+		// Work out the BM25 score for the document.
+		var score float64
+		length := float64(doc.length())
+		for _, t := range required {
+			df := float64(len(idx.postings[t]))
+			tf := float64(idx.postings[t][id])
+
+			idf := math.Log(1 + (float64(len(idx.docs))-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/avgLength))
+		}
+
+		hits = append(hits, hit{snippet: doc.snippet, score: score})
+	}
+
+	idx.mu.RUnlock()
+
+	// Drop any snippets which we found had expired since they were indexed.
+	if len(expired) > 0 {
+		idx.mu.Lock()
+		for _, id := range expired {
+			if doc, ok := idx.docs[id]; ok && !doc.snippet.Expires.After(now) {
+				idx.remove(id)
+			}
+		}
+		idx.mu.Unlock()
+	}
+
+	// Order by score, breaking ties with the newest snippet first.
+	slices.SortFunc(hits, func(a, b hit) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		default:
+			return b.snippet.ID - a.snippet.ID
+		}
+	})
+
+	start := min((page-1)*limit, len(hits))
+	end := min(start+limit, len(hits))
+
+	for _, h := range hits[start:end] {
+		result.Snippets = append(result.Snippets, h.snippet)
+	}
+	result.HasNext = end < len(hits)
+
+	return result, nil
+}
+
+// containsPhrase reports whether the phrase appears as a run of consecutive
+// terms, entirely within either the title or the content.
+func (d *document) containsPhrase(phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(d.terms); i++ {
+		if i < d.titleLength && i+len(phrase) > d.titleLength {
+			continue
+		}
+		if slices.Equal(d.terms[i:i+len(phrase)], phrase) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package search
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+	"github.com/AguilaMike/snippetbox/internal/models"
+	"github.com/AguilaMike/snippetbox/internal/models/mocks"
+)
+
+func newTestIndex(t *testing.T, now time.Time) *Index {
+	idx := NewIndex()
+	idx.now = func() time.Time { return now }
+
+	snippets := []models.Snippet{
+		{ID: 1, Title: "An old silent pond", Content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again."},
+		{ID: 2, Title: "Over the wintry forest", Content: "Over the wintry\nforest, winds howl in rage\nwith no leaves to blow."},
+		{ID: 3, Title: "First autumn morning", Content: "First autumn morning\nthe mirror I stare into\nshows my father's face."},
+		{ID: 4, Title: "Ponds", Content: "Frogs live in ponds."},
+	}
+
+	for _, s := range snippets {
+		s.Expires = now.Add(time.Hour)
+		err := idx.Index(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return idx
+}
+
+// ids returns the IDs of the snippets on a page of search results.
+func ids(page models.SearchPage) []int {
+	var ids []int
+	for _, s := range page.Snippets {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func TestIndexQuery(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	idx := newTestIndex(t, now)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{
+			name:  "Single term",
+			query: "forest",
+			want:  []int{2},
+		},
+		{
+			name:  "Stemmed term ranked by relevance",
+			query: "pond",
+			want:  []int{4, 1},
+		},
+		{
+			name:  "All terms required",
+			query: "frog splash",
+			want:  []int{1},
+		},
+		{
+			name:  "Excluded term",
+			query: "pond -splash",
+			want:  []int{4},
+		},
+		{
+			name:  "Phrase",
+			query: `"silent pond"`,
+			want:  []int{1},
+		},
+		{
+			name:  "Phrase out of order",
+			query: `"pond silent"`,
+			want:  nil,
+		},
+		{
+			name:  "Stop words only",
+			query: "the",
+			want:  nil,
+		},
+		{
+			name:  "No match",
+			query: "mountain",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := idx.Query(models.SearchQuery{Terms: models.ParseSearch(tt.query)})
+
+			assert.NilError(t, err)
+			assert.Equal(t, slices.Equal(ids(page), tt.want), true)
+		})
+	}
+}
+
+func TestIndexPagination(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	idx := newTestIndex(t, now)
+
+	q := models.SearchQuery{Terms: models.ParseSearch("pond"), Limit: 1}
+
+	page, err := idx.Query(q)
+	assert.NilError(t, err)
+	assert.Equal(t, slices.Equal(ids(page), []int{4}), true)
+	assert.Equal(t, page.HasNext, true)
+
+	q.Page = 2
+	page, err = idx.Query(q)
+	assert.NilError(t, err)
+	assert.Equal(t, slices.Equal(ids(page), []int{1}), true)
+	assert.Equal(t, page.HasNext, false)
+}
+
+func TestIndexUpdateDeleteExpire(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	idx := newTestIndex(t, now)
+	q := models.SearchQuery{Terms: models.ParseSearch("pond")}
+
+	// Updating a snippet replaces its terms.
+	idx.Index(models.Snippet{ID: 4, Title: "Lakes", Content: "Frogs live in lakes.", Expires: now.Add(time.Hour)})
+	page, _ := idx.Query(q)
+	assert.Equal(t, slices.Equal(ids(page), []int{1}), true)
+
+	// Deleted snippets are no longer found.
+	idx.Delete(1)
+	page, _ = idx.Query(q)
+	assert.Equal(t, len(page.Snippets), 0)
+	assert.Equal(t, idx.Len(), 3)
+
+	// And expired snippets are skipped and dropped from the index.
+	idx.now = func() time.Time { return now.Add(2 * time.Hour) }
+	page, _ = idx.Query(models.SearchQuery{Terms: models.ParseSearch("lakes")})
+	assert.Equal(t, len(page.Snippets), 0)
+	assert.Equal(t, idx.Len(), 2)
+}
+
+func TestIndexRebuild(t *testing.T) {
+	idx := NewIndex()
+
+	err := idx.Rebuild(&mocks.SnippetModel{})
+	assert.NilError(t, err)
+	assert.Equal(t, idx.Len(), 1)
+
+	page, err := idx.Query(models.SearchQuery{Terms: models.ParseSearch("silent")})
+	assert.NilError(t, err)
+	assert.Equal(t, len(page.Snippets), 1)
+}
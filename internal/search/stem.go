@@ -0,0 +1,258 @@
+package search
+
+import "strings"
+
+// Stem returns the stem of a lowercase English word, using the algorithm
+// described in M.F. Porter, "An algorithm for suffix stripping", 1980. Words
+// of two letters or fewer, and words containing anything other than the
+// letters a-z, are returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	b := []byte(word)
+	b = step1a(b)
+	b = step1b(b)
+	b = step1c(b)
+	b = step2(b)
+	b = step3(b)
+	b = step4(b)
+	b = step5(b)
+
+	return string(b)
+}
+
+// consonant reports whether b[i] is a consonant. The letter y is a consonant
+// unless it follows another consonant.
+func consonant(b []byte, i int) bool {
+	switch b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !consonant(b, i-1)
+	default:
+		return true
+	}
+}
+
+// measure returns m, the number of vowel-consonant sequences in b, where b
+// has the form [C](VC){m}[V].
+func measure(b []byte) int {
+	n, i := 0, 0
+
+	for i < len(b) && consonant(b, i) {
+		i++
+	}
+	for i < len(b) {
+		for i < len(b) && !consonant(b, i) {
+			i++
+		}
+		if i == len(b) {
+			break
+		}
+		n++
+		for i < len(b) && consonant(b, i) {
+			i++
+		}
+	}
+
+	return n
+}
+
+// hasVowel reports whether b contains a vowel.
+func hasVowel(b []byte) bool {
+	for i := range b {
+		if !consonant(b, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleConsonant reports whether b ends with a double consonant.
+func doubleConsonant(b []byte) bool {
+	n := len(b)
+	return n >= 2 && b[n-1] == b[n-2] && consonant(b, n-1)
+}
+
+// cvc reports whether b ends consonant-vowel-consonant, where the final
+// consonant isn't w, x or y.
+func cvc(b []byte) bool {
+	n := len(b)
+	if n < 3 || !consonant(b, n-3) || consonant(b, n-2) || !consonant(b, n-1) {
+		return false
+	}
+	switch b[n-1] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// replaceSuffix replaces suffix with replacement if b ends with suffix and
+// the measure of the remaining stem is greater than minMeasure. The second
+// result reports whether b ended with suffix at all.
+func replaceSuffix(b []byte, suffix, replacement string, minMeasure int) ([]byte, bool) {
+	if !strings.HasSuffix(string(b), suffix) {
+		return b, false
+	}
+
+	stem := b[:len(b)-len(suffix)]
+	if measure(stem) > minMeasure {
+		return append(stem, replacement...), true
+	}
+
+	return b, true
+}
+
+func step1a(b []byte) []byte {
+	s := string(b)
+	switch {
+	case strings.HasSuffix(s, "sses"):
+		return b[:len(b)-2]
+	case strings.HasSuffix(s, "ies"):
+		return b[:len(b)-2]
+	case strings.HasSuffix(s, "ss"):
+		return b
+	case strings.HasSuffix(s, "s"):
+		return b[:len(b)-1]
+	}
+	return b
+}
+
+func step1b(b []byte) []byte {
+	s := string(b)
+
+	if strings.HasSuffix(s, "eed") {
+		if measure(b[:len(b)-3]) > 0 {
+			return b[:len(b)-1]
+		}
+		return b
+	}
+
+	var stem []byte
+	switch {
+	case strings.HasSuffix(s, "ed") && hasVowel(b[:len(b)-2]):
+		stem = b[:len(b)-2]
+	case strings.HasSuffix(s, "ing") && hasVowel(b[:len(b)-3]):
+		stem = b[:len(b)-3]
+	default:
+		return b
+	}
+
+	t := string(stem)
+	switch {
+	case strings.HasSuffix(t, "at"), strings.HasSuffix(t, "bl"), strings.HasSuffix(t, "iz"):
+		return append(stem, 'e')
+	case doubleConsonant(stem):
+		switch stem[len(stem)-1] {
+		case 'l', 's', 'z':
+			return stem
+		}
+		return stem[:len(stem)-1]
+	case measure(stem) == 1 && cvc(stem):
+		return append(stem, 'e')
+	}
+
+	return stem
+}
+
+func step1c(b []byte) []byte {
+	if b[len(b)-1] == 'y' && hasVowel(b[:len(b)-1]) {
+		b[len(b)-1] = 'i'
+	}
+	return b
+}
+
+// The suffix lists for steps 2 to 4. Within each step only the longest
+// matching suffix is considered, so the lists are tried in order.
+var step2Suffixes = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+}
+
+var step3Suffixes = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+var step4Suffixes = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+// longestSuffix returns the index of the longest entry in suffixes which b
+// ends with, or -1 if there isn't one.
+func longestSuffix(b []byte, suffixes func(i int) string, n int) int {
+	best := -1
+	for i := 0; i < n; i++ {
+		if strings.HasSuffix(string(b), suffixes(i)) && (best < 0 || len(suffixes(i)) > len(suffixes(best))) {
+			best = i
+		}
+	}
+	return best
+}
+
+func step2(b []byte) []byte {
+	i := longestSuffix(b, func(i int) string { return step2Suffixes[i][0] }, len(step2Suffixes))
+	if i < 0 {
+		return b
+	}
+	b, _ = replaceSuffix(b, step2Suffixes[i][0], step2Suffixes[i][1], 0)
+	return b
+}
+
+func step3(b []byte) []byte {
+	i := longestSuffix(b, func(i int) string { return step3Suffixes[i][0] }, len(step3Suffixes))
+	if i < 0 {
+		return b
+	}
+	b, _ = replaceSuffix(b, step3Suffixes[i][0], step3Suffixes[i][1], 0)
+	return b
+}
+
+func step4(b []byte) []byte {
+	i := longestSuffix(b, func(i int) string { return step4Suffixes[i] }, len(step4Suffixes))
+	if i < 0 {
+		return b
+	}
+
+	suffix := step4Suffixes[i]
+	stem := b[:len(b)-len(suffix)]
+
+	// The "ion" suffix is only removed after an s or a t.
+	if suffix == "ion" && (len(stem) == 0 || (stem[len(stem)-1] != 's' && stem[len(stem)-1] != 't')) {
+		return b
+	}
+
+	if measure(stem) > 1 {
+		return stem
+	}
+	return b
+}
+
+func step5(b []byte) []byte {
+	// Step 5a: remove a final e.
+	if b[len(b)-1] == 'e' {
+		stem := b[:len(b)-1]
+		if m := measure(stem); m > 1 || (m == 1 && !cvc(stem)) {
+			b = stem
+		}
+	}
+
+	// Step 5b: reduce a final double l.
+	if measure(b) > 1 && doubleConsonant(b) && b[len(b)-1] == 'l' {
+		b = b[:len(b)-1]
+	}
+
+	return b
+}
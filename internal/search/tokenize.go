@@ -0,0 +1,37 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopWords holds common English words which carry too little meaning to be
+// worth indexing. They're dropped from both documents and queries.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// Tokenize splits text into lowercase, stemmed terms. Words are made up of
+// letters, digits and underscores; everything else is treated as a word
+// break. Stop words are removed.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		w = strings.ToLower(w)
+		if stopWords[w] {
+			continue
+		}
+		tokens = append(tokens, Stem(w))
+	}
+
+	return tokens
+}
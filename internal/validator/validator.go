@@ -1,9 +1,11 @@
 package validator
 
 import (
+	"encoding/base64"
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -18,6 +20,15 @@ var HasUpper = regexp.MustCompile(`[A-Z]`)
 var HasLower = regexp.MustCompile(`[a-z]`)
 var HasDigit = regexp.MustCompile(`[0-9]`)
 
+// TagRX matches a normalized tag: lowercase letters, digits and a few symbols
+// which turn up in technology names (like "c++", "c#" or "node.js").
+var TagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9+#._-]*$`)
+
+// FilenameRX matches a safe file name: letters, digits, dots, underscores and
+// hyphens, not starting with a dot (so no hidden files, and no "..") and
+// with no path separators.
+var FilenameRX = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9._-]*$`)
+
 // Define a new Validator struct which contains a map of validation error messages
 // for our form fields.
 // Add a new NonFieldErrors []string field to the struct, which we will use to
@@ -88,3 +99,74 @@ func MinChars(value string, n int) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// MaxItems() returns true if a slice contains no more than n items.
+func MaxItems[T any](values []T, n int) bool {
+	return len(values) <= n
+}
+
+// AllMatch() returns true if every value in a slice matches a provided
+// compiled regular expression pattern.
+func AllMatch(values []string, rx *regexp.Regexp) bool {
+	for _, value := range values {
+		if !rx.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllMaxChars() returns true if every value in a slice contains no more than
+// n characters.
+func AllMaxChars(values []string, n int) bool {
+	for _, value := range values {
+		if !MaxChars(value, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// DurationBetween() returns true if a duration is no shorter than least and no
+// longer than most.
+func DurationBetween(d, least, most time.Duration) bool {
+	return d >= least && d <= most
+}
+
+// TimeBetween() returns true if a time is no earlier than earliest and no
+// later than latest.
+func TimeBetween(t, earliest, latest time.Time) bool {
+	return !t.Before(earliest) && !t.After(latest)
+}
+
+// Base64Size() returns true if a value is standard, padded base64 which
+// decodes to between least and most bytes. Values which are obviously too long
+// are rejected before they're decoded.
+func Base64Size(value string, least, most int) bool {
+	if base64.StdEncoding.DecodedLen(len(value)) > most+2 {
+		return false
+	}
+
+	decoded, err := base64.StdEncoding.Strict().DecodeString(value)
+	if err != nil {
+		return false
+	}
+
+	return len(decoded) >= least && len(decoded) <= most
+}
+
+// NormalizeList() splits a comma-separated value into its items, trimming
+// surrounding whitespace and converting them to lowercase. Blank and
+// duplicate items are dropped.
+func NormalizeList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" && !slices.Contains(items, item) {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
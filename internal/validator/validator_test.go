@@ -0,0 +1,131 @@
+package validator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AguilaMike/snippetbox/internal/assert"
+)
+
+func TestDurationBetween(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+		want bool
+	}{
+		{
+			name: "Too short",
+			d:    9 * time.Minute,
+			want: false,
+		},
+		{
+			name: "Shortest",
+			d:    10 * time.Minute,
+			want: true,
+		},
+		{
+			name: "Longest",
+			d:    time.Hour,
+			want: true,
+		},
+		{
+			name: "Too long",
+			d:    time.Hour + time.Nanosecond,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, DurationBetween(tt.d, 10*time.Minute, time.Hour), tt.want)
+		})
+	}
+}
+
+func TestTimeBetween(t *testing.T) {
+	earliest := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	latest := earliest.Add(24 * time.Hour)
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{
+			name: "Too early",
+			t:    earliest.Add(-time.Second),
+			want: false,
+		},
+		{
+			name: "Earliest",
+			t:    earliest,
+			want: true,
+		},
+		{
+			name: "Latest in another time zone",
+			t:    latest.In(time.FixedZone("CET", 60*60)),
+			want: true,
+		},
+		{
+			name: "Too late",
+			t:    latest.Add(time.Second),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, TimeBetween(tt.t, earliest, latest), tt.want)
+		})
+	}
+}
+
+func TestBase64Size(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{
+			name:  "Valid",
+			value: "aGVsbG8=",
+			want:  true,
+		},
+		{
+			name:  "Too short",
+			value: "aGk=",
+			want:  false,
+		},
+		{
+			name:  "Too long",
+			value: "aGVsbG8sIHdvcmxk",
+			want:  false,
+		},
+		{
+			name:  "Missing padding",
+			value: "aGVsbG8",
+			want:  false,
+		},
+		{
+			name:  "URL encoding",
+			value: "-_-_",
+			want:  false,
+		},
+		{
+			name:  "Whitespace",
+			value: "aGVs bG8=",
+			want:  false,
+		},
+		{
+			name:  "Empty",
+			value: "",
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Base64Size(tt.value, 3, 8), tt.want)
+		})
+	}
+}
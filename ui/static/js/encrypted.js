@@ -0,0 +1,150 @@
+// End-to-end encryption for encrypted snippets. The content is encrypted in
+// the browser with AES-GCM before the form is sent, using a new random key
+// which is added to the snippet's URL after the #. Browsers never send that
+// part of a URL to the server, so the server only ever sees the ciphertext:
+// the base64 encoding of the 12-byte nonce, followed by the encrypted content
+// and its authentication tag.
+
+var encryptForms = document.querySelectorAll("form[data-encrypt]");
+for (var i = 0; i < encryptForms.length; i++) {
+	encryptForm(encryptForms[i]);
+}
+
+var encryptedSnippets = document.querySelectorAll("pre[data-ciphertext]");
+for (var i = 0; i < encryptedSnippets.length; i++) {
+	decryptSnippet(encryptedSnippets[i]);
+}
+
+// The last view of a "burn after reading" snippet is shown in the response to
+// a form, so the key has to be added to the form's action to keep it.
+var keepKeyForms = document.querySelectorAll("form[data-keep-key]");
+for (var i = 0; i < keepKeyForms.length; i++) {
+	keepKeyForms[i].action = keepKeyForms[i].getAttribute("action") + window.location.hash;
+}
+
+function encryptForm(form) {
+	var plaintext = form.querySelector("textarea[data-plaintext]");
+	var ciphertext = form.querySelector("input[data-ciphertext]");
+
+	// When the form is sent back with errors, the content comes back as
+	// ciphertext and the key is still in the URL, so it's decrypted again
+	// rather than having to be typed in again.
+	if (ciphertext.value !== "" && window.location.hash.length > 1) {
+		importKey(window.location.hash.slice(1))
+			.then(function(key) { return decrypt(key, ciphertext.value); })
+			.then(function(text) { plaintext.value = text; })
+			.catch(function() {});
+	}
+
+	form.addEventListener("submit", function(event) {
+		event.preventDefault();
+
+		// Blank content is left blank, so that the server can report it.
+		if (plaintext.value === "") {
+			ciphertext.value = "";
+			form.submit();
+			return;
+		}
+
+		var key;
+		crypto.subtle.generateKey({name: "AES-GCM", length: 256}, true, ["encrypt", "decrypt"])
+			.then(function(k) {
+				key = k;
+				return encrypt(key, plaintext.value);
+			})
+			.then(function(data) {
+				ciphertext.value = data;
+				return crypto.subtle.exportKey("raw", key);
+			})
+			.then(function(raw) {
+				// The server redirects to the new snippet's page, and the
+				// browser keeps the key from the action URL when it follows
+				// the redirect. Calling submit() doesn't fire this handler
+				// again.
+				form.action = form.getAttribute("action").split("#")[0] + "#" + encodeBase64URL(new Uint8Array(raw));
+				form.submit();
+			})
+			.catch(function() {
+				alert("Your browser couldn't encrypt the snippet.");
+			});
+	});
+}
+
+function decryptSnippet(pre) {
+	var error = document.querySelector("[data-decrypt-error]");
+
+	function fail(message) {
+		error.textContent = message;
+		error.hidden = false;
+	}
+
+	if (window.location.hash.length <= 1) {
+		fail("This snippet is encrypted, and the link is missing the key after the #.");
+		return;
+	}
+
+	importKey(window.location.hash.slice(1))
+		.then(function(key) { return decrypt(key, pre.dataset.ciphertext); })
+		.then(function(text) {
+			// Using textContent means that the content is never treated as
+			// HTML.
+			pre.querySelector("code").textContent = text;
+		})
+		.catch(function() {
+			fail("This snippet couldn't be decrypted. Check that you have the whole link, including the key after the #.");
+		});
+}
+
+function importKey(encoded) {
+	return crypto.subtle.importKey("raw", decodeBase64URL(encoded), {name: "AES-GCM"}, false, ["decrypt"]);
+}
+
+function encrypt(key, text) {
+	var nonce = crypto.getRandomValues(new Uint8Array(12));
+
+	return crypto.subtle.encrypt({name: "AES-GCM", iv: nonce}, key, new TextEncoder().encode(text))
+		.then(function(encrypted) {
+			var data = new Uint8Array(nonce.length + encrypted.byteLength);
+			data.set(nonce);
+			data.set(new Uint8Array(encrypted), nonce.length);
+			return encodeBase64(data);
+		});
+}
+
+function decrypt(key, encoded) {
+	var data = decodeBase64(encoded);
+
+	return crypto.subtle.decrypt({name: "AES-GCM", iv: data.slice(0, 12)}, key, data.slice(12))
+		.then(function(decrypted) { return new TextDecoder().decode(decrypted); });
+}
+
+function encodeBase64(bytes) {
+	var binary = "";
+	for (var i = 0; i < bytes.length; i++) {
+		binary += String.fromCharCode(bytes[i]);
+	}
+	return btoa(binary);
+}
+
+function decodeBase64(encoded) {
+	var binary = atob(encoded);
+	var bytes = new Uint8Array(binary.length);
+	for (var i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i);
+	}
+	return bytes;
+}
+
+// The key uses the URL-safe base64 alphabet without padding, so that it
+// doesn't need escaping in the URL.
+function encodeBase64URL(bytes) {
+	return encodeBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function decodeBase64URL(encoded) {
+	var base64 = encoded.replace(/-/g, "+").replace(/_/g, "/");
+	while (base64.length % 4 !== 0) {
+		base64 += "=";
+	}
+	return decodeBase64(base64);
+}
@@ -5,4 +5,237 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Suggest existing tags while the tags field is being filled in. The field
+// holds a comma-separated list, so suggestions are fetched for the tag after
+// the last comma, and each suggestion keeps the tags before it.
+var tagInputs = document.querySelectorAll("input[data-suggest]");
+for (var i = 0; i < tagInputs.length; i++) {
+	suggestTags(tagInputs[i]);
+}
+
+function suggestTags(input) {
+	var list = document.getElementById(input.getAttribute("list"));
+	var timer = null;
+
+	input.addEventListener("input", function() {
+		clearTimeout(timer);
+		timer = setTimeout(function() {
+			var value = input.value;
+			var comma = value.lastIndexOf(",");
+			var before = comma < 0 ? "" : value.slice(0, comma + 1) + " ";
+			var prefix = value.slice(comma + 1).trim();
+
+			if (prefix === "") {
+				list.innerHTML = "";
+				return;
+			}
+
+			fetch(input.dataset.suggest + "?prefix=" + encodeURIComponent(prefix))
+				.then(function(response) { return response.ok ? response.json() : []; })
+				.then(function(tags) {
+					list.innerHTML = "";
+					for (var j = 0; j < tags.length; j++) {
+						var option = document.createElement("option");
+						option.value = before + tags[j];
+						list.appendChild(option);
+					}
+				})
+				.catch(function() {});
+		}, 200);
+	});
+}
+
+// Add and remove the extra file entries in the snippet form. A new entry is a
+// copy of the last one with its values cleared, and the entries are numbered
+// again after every change so that the names stay in order.
+var fileSections = document.querySelectorAll("div.files");
+for (var i = 0; i < fileSections.length; i++) {
+	manageFiles(fileSections[i]);
+}
+
+function manageFiles(section) {
+	function renumber() {
+		var entries = section.querySelectorAll("fieldset.file");
+		for (var j = 0; j < entries.length; j++) {
+			var fields = entries[j].querySelectorAll("input, textarea");
+			for (var k = 0; k < fields.length; k++) {
+				fields[k].name = fields[k].name.replace(/^files\[\d+\]/, "files[" + j + "]");
+			}
+		}
+	}
+
+	section.addEventListener("click", function(event) {
+		var button = event.target;
+
+		if (button.hasAttribute("data-add-file")) {
+			var entries = section.querySelectorAll("fieldset.file");
+			var last = entries[entries.length - 1];
+			var entry = last.cloneNode(true);
+
+			var fields = entry.querySelectorAll("input, textarea");
+			for (var j = 0; j < fields.length; j++) {
+				fields[j].value = "";
+			}
+			var errors = entry.querySelectorAll(".error");
+			for (var j = 0; j < errors.length; j++) {
+				errors[j].remove();
+			}
+
+			last.after(entry);
+			renumber();
+		}
+
+		if (button.hasAttribute("data-remove-file")) {
+			var entry = button.closest("fieldset.file");
+
+			// Keep at least one entry around to copy when adding a file.
+			if (section.querySelectorAll("fieldset.file").length > 1) {
+				entry.remove();
+			} else {
+				var fields = entry.querySelectorAll("input, textarea");
+				for (var j = 0; j < fields.length; j++) {
+					fields[j].value = "";
+				}
+			}
+			renumber();
+		}
+	});
+}
+
+// Highlight the lines of a snippet picked out by the URL, which can be a
+// single line like #L12 or a range like #L12-L20. Clicking a line number picks
+// that line, and shift-clicking another one picks the range between them. The
+// picked lines are also filled in on the form for a new comment.
+var codeLines = document.querySelector("pre.lines");
+if (codeLines) {
+	pickLines(codeLines);
+}
+
+function pickLines(pre) {
+	var form = document.querySelector("form[data-line-comment]");
+
+	function parse(hash) {
+		var match = /^#L(\d+)(?:-L(\d+))?$/.exec(hash);
+		if (!match) {
+			return null;
+		}
+		var start = parseInt(match[1], 10);
+		var end = match[2] ? parseInt(match[2], 10) : start;
+		return {start: Math.min(start, end), end: Math.max(start, end)};
+	}
+
+	function highlight(scroll) {
+		var selected = pre.querySelectorAll(".line.selected");
+		for (var i = 0; i < selected.length; i++) {
+			selected[i].classList.remove("selected");
+		}
+
+		var range = parse(window.location.hash);
+		if (!range) {
+			return;
+		}
+
+		for (var n = range.start; n <= range.end; n++) {
+			var line = document.getElementById("L" + n);
+			if (line) {
+				line.classList.add("selected");
+			}
+		}
+
+		if (form) {
+			form.elements["line_start"].value = range.start;
+			form.elements["line_end"].value = range.end;
+		}
+
+		// Browsers only scroll to single lines by themselves, as ranges
+		// aren't the ID of any element.
+		var first = document.getElementById("L" + range.start);
+		if (scroll && first) {
+			first.scrollIntoView({block: "center"});
+		}
+	}
+
+	pre.addEventListener("click", function(event) {
+		var link = event.target.closest("a.line-number");
+		var range = parse(window.location.hash);
+		if (!link || !event.shiftKey || !range) {
+			return;
+		}
+
+		// Replacing the state doesn't fire a hashchange event, or scroll
+		// the page.
+		event.preventDefault();
+		var n = parseInt(link.textContent, 10);
+		history.replaceState(null, "", "#L" + Math.min(range.start, n) + "-L" + Math.max(range.start, n));
+		highlight(false);
+	});
+
+	window.addEventListener("hashchange", function() {
+		highlight(false);
+	});
+
+	highlight(true);
+}
+
+// Let the owner of a collection drag its snippets into a new order. Each time
+// a snippet is dropped, the new order is posted as a snippet_id value for each
+// snippet, along with the CSRF token from the list.
+var collection = document.querySelector("ol[data-reorder]");
+if (collection) {
+	reorderCollection(collection);
+}
+
+function reorderCollection(list) {
+	var dragged = null;
+
+	list.addEventListener("dragstart", function(event) {
+		dragged = event.target.closest("li");
+		event.dataTransfer.effectAllowed = "move";
+		event.dataTransfer.setData("text/plain", dragged.dataset.id);
+		dragged.classList.add("dragging");
+	});
+
+	list.addEventListener("dragover", function(event) {
+		var item = event.target.closest("li");
+		if (!dragged || !item || item == dragged) {
+			return;
+		}
+		event.preventDefault();
+
+		// Drop the snippet before or after the one under the pointer,
+		// depending on which half of it the pointer is over.
+		var box = item.getBoundingClientRect();
+		if (event.clientY < box.top + box.height / 2) {
+			list.insertBefore(dragged, item);
+		} else {
+			list.insertBefore(dragged, item.nextSibling);
+		}
+	});
+
+	list.addEventListener("drop", function(event) {
+		event.preventDefault();
+	});
+
+	list.addEventListener("dragend", function() {
+		dragged.classList.remove("dragging");
+		dragged = null;
+
+		var body = new URLSearchParams();
+		body.append("csrf_token", list.dataset.csrfToken);
+		var items = list.querySelectorAll("li");
+		for (var i = 0; i < items.length; i++) {
+			body.append("snippet_id", items[i].dataset.id);
+		}
+
+		fetch(list.dataset.reorder, {method: "POST", body: body}).then(function(response) {
+			if (!response.ok) {
+				throw new Error(response.statusText);
+			}
+		}).catch(function() {
+			// Reload the page so that it shows the order which was saved.
+			window.location.reload();
+		});
+	});
+}